@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/duplicates"
+	"github.com/ryex/go-broadcaster/internal/importer"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/organise"
+	"github.com/ryex/go-broadcaster/internal/playlists"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// progressInterval is how often the progress of a running import is logged
+const progressInterval = 10 * time.Second
+
+// jobUpdateInterval is how often the counters of the job of a running
+// import are written
+const jobUpdateInterval = 2 * time.Second
+
+// Importer holds what is needed to index a single library path
+type Importer struct {
+	LibPath models.LibraryPath
+	Db      *pg.DB
+	Cfg     config.Config
+	// Job is the job the import reports to, one is started if it's nil
+	Job *models.ImportJob
+}
+
+// ProcessImport runs the import pipeline over the library path of the
+// importer, storing every media file found as a track. The library path is
+// flagged as indexing for the duration of the import and it's LastIndex is
+// stamped when the import finishes without being cancelled. The progress is
+// written to the job of the import, which is marked done or failed at the
+// end.
+func ProcessImport(ctx context.Context, imp Importer) error {
+	ijq := models.ImportJobQuery{
+		DB: imp.Db,
+	}
+
+	job := imp.Job
+	if job == nil {
+		var err error
+		job, err = ijq.StartJob(imp.LibPath.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	progress := new(importer.Progress)
+	err := imp.process(ctx, job, progress)
+	setJobCounters(job, progress.Snapshot())
+	if ferr := ijq.FinishJob(job, err); ferr != nil && err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (imp Importer) process(ctx context.Context, job *models.ImportJob, progress *importer.Progress) error {
+	lpq := models.LibraryPathQuery{
+		DB: imp.Db,
+	}
+
+	rootPath, err := imp.LibPath.Root()
+	if err != nil {
+		logutils.Log.Error("could not get an absolute path for", imp.LibPath.Path)
+		return err
+	}
+
+	ignore, err := imp.LibPath.IgnoreRules()
+	if err != nil {
+		logutils.Log.Error("bad ignore patterns for", imp.LibPath.Path, err)
+		return err
+	}
+
+	err = lpq.StartIndexing(&imp.LibPath)
+	if err != nil {
+		return err
+	}
+
+	logutils.Log.Infof("Indexing library path '%s' as job %d", rootPath, job.ID)
+
+	pipeline := importer.NewPipeline(imp.Db, &imp.Cfg)
+	pipeline.Walk.Ignore = ignore
+	pipeline.Progress = progress
+	done := make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		imp.reportProgress(rootPath, job, progress, done)
+	}()
+	perr := pipeline.Run(ctx, rootPath)
+	close(done)
+	// the job must not be written after it's finished
+	<-reported
+
+	p := progress.Snapshot()
+	logutils.Log.Infof("Indexed '%s': %d seen, %d imported, %d updated, %d skipped, %d errored, %d unsupported",
+		rootPath, p.Seen, p.Imported, p.Updated, p.Skipped, p.Errored, p.Unsupported)
+
+	if perr != nil {
+		logutils.Log.Error("error indexing library path", rootPath, perr)
+		err = lpq.AbortIndexing(&imp.LibPath)
+		if err != nil {
+			return err
+		}
+		return perr
+	}
+
+	// only trust the walk to tell what is missing if it finished, and not
+	// below the parts of the tree it couldn't read
+	exists, err := imp.presence(ctx, pipeline.Storage, rootPath)
+	if err != nil {
+		logutils.Log.Errorf("Could not list library path '%s': %s", rootPath, err)
+	} else {
+		if werrs := pipeline.WalkErrors(); len(werrs) > 0 {
+			logutils.Log.Errorf("Could not read %d parts of library path '%s', not marking tracks there missing", len(werrs), rootPath)
+			exists = unlessCovered(exists, werrs)
+		}
+		imp.markMissing(rootPath, ignore, exists)
+		imp.pruneErrors(ignore, exists)
+	}
+	imp.pruneWaveforms(pipeline)
+
+	// the entries of playlist files are matched to the tracks just stored
+	imp.importPlaylists(ctx, rootPath, pipeline.Walk)
+
+	if imp.LibPath.Managed && imp.LibPath.Organise && !imp.LibPath.Remote() {
+		imp.organise(ctx)
+	}
+
+	return lpq.FinishIndexing(&imp.LibPath)
+}
+
+// reportProgress logs the counters of a running import and writes them to
+// it's job until done is closed
+func (imp Importer) reportProgress(root string, job *models.ImportJob, progress *importer.Progress, done <-chan struct{}) {
+	ijq := models.ImportJobQuery{
+		DB: imp.Db,
+	}
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	jobTicker := time.NewTicker(jobUpdateInterval)
+	defer jobTicker.Stop()
+	// the job is only written here while the import runs, it's final
+	// counters are set once done is closed
+	counters := *job
+	for {
+		select {
+		case <-jobTicker.C:
+			setJobCounters(&counters, progress.Snapshot())
+			ijq.UpdateProgress(&counters)
+		case <-ticker.C:
+			p := progress.Snapshot()
+			logutils.Log.Infof("Indexing '%s': %d seen, %d imported, %d updated, %d skipped, %d errored, %d unsupported",
+				root, p.Seen, p.Imported, p.Updated, p.Skipped, p.Errored, p.Unsupported)
+		case <-done:
+			return
+		}
+	}
+}
+
+// organise moves the files of the library path into it's layout, or only
+// logs the moves when organising is a dry run
+func (imp Importer) organise(ctx context.Context) {
+	o := organise.Organiser{
+		DB:     imp.Db,
+		DryRun: imp.Cfg.OrganiseDryRun,
+	}
+	moves, err := o.Organise(ctx, &imp.LibPath)
+	if err != nil {
+		logutils.Log.Errorf("Error organising library path '%s': %s", imp.LibPath.Path, err)
+		return
+	}
+	if o.DryRun {
+		for _, m := range moves {
+			logutils.Log.Infof("Would move '%s' to '%s'", m.From, m.To)
+		}
+	}
+}
+
+// importPlaylists imports the playlist files in the library path, files
+// that failed are logged and left for the next scan
+func (imp Importer) importPlaylists(ctx context.Context, rootPath string, opts utils.WalkOptions) {
+	pi := playlists.NewImporter(imp.Db, &imp.Cfg)
+	paths, err := pi.Find(ctx, rootPath, opts)
+	if err != nil {
+		logutils.Log.Errorf("Error looking for playlist files in '%s': %s", rootPath, err)
+		return
+	}
+	imported, unresolved := 0, 0
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		res, ierr := pi.ImportFile(ctx, path)
+		if ierr != nil {
+			logutils.Log.Errorf("Error importing playlist file '%s': %s", path, ierr)
+			continue
+		}
+		if !res.Unchanged {
+			imported++
+		}
+		unresolved += len(res.Unresolved)
+	}
+	if len(paths) > 0 {
+		logutils.Log.Infof("Imported %d playlist files in '%s', %d entries unresolved", imported, rootPath, unresolved)
+	}
+}
+
+// setJobCounters copies the counters of an import to it's job
+func setJobCounters(job *models.ImportJob, p importer.Progress) {
+	job.Seen = p.Seen
+	job.Imported = p.Imported
+	job.Updated = p.Updated
+	job.Skipped = p.Skipped
+	job.Errored = p.Errored
+	job.Unsupported = p.Unsupported
+}
+
+// presence returns a test telling if the file at a path under the library
+// path at rootPath is there. Remote library paths are listed once up front
+// rather than looking up each of their objects.
+func (imp Importer) presence(ctx context.Context, res *storage.Resolver, rootPath string) (func(path string) bool, error) {
+	if !imp.LibPath.Remote() {
+		return func(path string) bool {
+			_, err := os.Stat(path)
+			return !os.IsNotExist(err)
+		}, nil
+	}
+	st, prefix, err := res.ResolveDir(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := storage.Snapshot(ctx, st, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return func(path string) bool {
+		_, key, rerr := res.Resolve(path)
+		if rerr != nil {
+			return true
+		}
+		_, ok := objects[key]
+		return ok
+	}, nil
+}
+
+// unlessCovered wraps exists so paths below the parts of the tree in werrs
+// count as there
+func unlessCovered(exists func(string) bool, werrs utils.WalkErrors) func(string) bool {
+	return func(path string) bool {
+		return werrs.Covers(path) || exists(path)
+	}
+}
+
+// markMissing flags the tracks of the library path whose files are gone,
+// tracks whose files are ignored now count as gone too
+func (imp Importer) markMissing(rootPath string, ignore *utils.Ignore, exists func(string) bool) {
+	tq := models.TrackQuery{
+		DB: imp.Db,
+	}
+
+	tracks, err := tq.GetPresentTracksUnderDir(rootPath)
+	if err != nil {
+		return
+	}
+
+	var gone []int64
+	for _, t := range tracks {
+		if !exists(t.Path) || ignore.Ignored(t.Path, false) {
+			gone = append(gone, t.ID)
+		}
+	}
+
+	count, err := tq.MarkMissingByIDs(gone)
+	if err != nil {
+		return
+	}
+	if count > 0 {
+		logutils.Log.Infof("Marked %d tracks missing in '%s'", count, rootPath)
+	}
+}
+
+// pruneErrors drops the import errors of the library path whose files are
+// gone or ignored now
+func (imp Importer) pruneErrors(ignore *utils.Ignore, exists func(string) bool) {
+	ieq := models.ImportErrorQuery{
+		DB: imp.Db,
+	}
+
+	errs, err := ieq.GetImportErrorsByIDs(imp.LibPath.ID, nil)
+	if err != nil {
+		return
+	}
+
+	var gone []int64
+	for _, ie := range errs {
+		if !exists(ie.Path) || ignore.Ignored(ie.Path, false) {
+			gone = append(gone, ie.ID)
+		}
+	}
+
+	count, err := ieq.ClearByIDs(gone)
+	if err != nil {
+		return
+	}
+	if count > 0 {
+		logutils.Log.Infof("Cleared %d import errors of gone files in '%s'", count, imp.LibPath.Path)
+	}
+}
+
+// pruneWaveforms removes the waveforms no track uses anymore, like those of
+// deleted tracks
+func (imp Importer) pruneWaveforms(pipeline *importer.Pipeline) {
+	count, err := pipeline.PruneWaveforms()
+	if err != nil {
+		logutils.Log.Error("Could not prune waveforms", err)
+		return
+	}
+	if count > 0 {
+		logutils.Log.Infof("Removed %d unused waveforms", count)
+	}
+}
+
+// RunQueuedJobs runs the queued import jobs one after the other until none
+// are left or ctx is cancelled
+func RunQueuedJobs(ctx context.Context, db *pg.DB, cfg *config.Config) error {
+	ijq := models.ImportJobQuery{
+		DB: db,
+	}
+	lpq := models.LibraryPathQuery{
+		DB: db,
+	}
+
+	for ctx.Err() == nil {
+		job, err := ijq.ClaimJob()
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return nil
+		}
+
+		lp, err := lpq.GetLibraryPathByID(job.LibraryPathID)
+		if err != nil {
+			logutils.Log.Errorf("Could not load library path %d of job %d: %s", job.LibraryPathID, job.ID, err)
+			ijq.FinishJob(job, err)
+			continue
+		}
+
+		imp := Importer{
+			LibPath: *lp,
+			Db:      db,
+			Cfg:     *cfg,
+			Job:     job,
+		}
+		err = ProcessImport(ctx, imp)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logutils.Log.Errorf("Error running import job %d for '%s': %s", job.ID, lp.Path, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// ScanLibraries runs an import for every library path in the database,
+// stopping early if ctx is cancelled
+func ScanLibraries(ctx context.Context, db *pg.DB, cfg *config.Config) error {
+	lpq := models.LibraryPathQuery{
+		DB: db,
+	}
+
+	paths, err := lpq.GetAllLibraryPaths()
+	if err != nil {
+		return err
+	}
+
+	for _, lp := range paths {
+		imp := Importer{
+			LibPath: lp,
+			Db:      db,
+			Cfg:     *cfg,
+		}
+		err = ProcessImport(ctx, imp)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logutils.Log.Errorf("Error importing library path '%s': %s", lp.Path, err)
+		}
+	}
+
+	// duplicates can be in different library paths so they are looked for
+	// once all are scanned
+	err = FindDuplicates(ctx, db, cfg)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		logutils.Log.Errorf("Error finding duplicate tracks: %s", err)
+	}
+	return nil
+}
+
+// FindDuplicates searches the library for duplicate tracks, replacing the
+// duplicate groups found by the last search
+func FindDuplicates(ctx context.Context, db *pg.DB, cfg *config.Config) error {
+	f := duplicates.Finder{
+		DB:              db,
+		LengthTolerance: cfg.DuplicateLengthTolerance.Duration,
+	}
+	groups, err := f.Find(ctx)
+	if err != nil {
+		return err
+	}
+	logutils.Log.Infof("found %d groups of duplicate tracks", len(groups))
+	return nil
+}
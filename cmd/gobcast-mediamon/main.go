@@ -1,57 +1,407 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/go-pg/pg"
+
 	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/feeds"
 	"github.com/ryex/go-broadcaster/internal/logutils"
 	"github.com/ryex/go-broadcaster/internal/models"
-	taglib "github.com/wtolson/go-taglib"
+	"github.com/ryex/go-broadcaster/internal/tags"
 )
 
-type Importer struct {
-	LibPath models.LibraryPath
-	Db      *pg.DB
-	Cfg     config.Config
-}
+const usageText = `Runs the media library monitor of go-broadcaster.
+Every library path in the database is indexed on start and then again
+every scan interval, storing the media files found as tracks. Scans queued
+through the web API are picked up every job poll interval.
+Between scans the library paths are watched for changes so new, changed
+and removed files show up within seconds.
+When a feed directory is configured the subscribed podcast feeds are
+polled every feed poll interval and their new episodes downloaded into it.
+Configuration:
+	If a file 'config.json' is present in the workign directory it will be loaded
+	alternatively the path to 'config.json' can be provided as a command line flag
+
+	additionally the values in 'config.json' can be overridden from the environment
+		- GOBROADCASTER_DBURI
+		- GOBROADCASTER_DBHOST
+		- GOBROADCASTER_DBPORT
+		- GOBROADCASTER_DBNAME
+		- GOBROADCASTER_DBUSER
+		- GOBROADCASTER_DBPASS
+		- GOBROADCASTER_DEBUG
+		- GOBROADCASTER_SCANINTERVAL
+		- GOBROADCASTER_WATCHDEBOUNCE
+
+	additionally the values in 'config.json' and from the environment
+	can be overridden by passing additional command line flags
+
+Usage:
+  gobcast-mediamon [args]
+Arguments:
+`
+
+// defaultScanInterval is used when no scan interval is configured
+const defaultScanInterval = time.Hour
+
+// defaultJobPollInterval is used when no job poll interval is configured
+const defaultJobPollInterval = 5 * time.Second
+
+// defaultJobRetention is used when no job retention is configured
+const defaultJobRetention = 7 * 24 * time.Hour
+
+var cfgFlag string
+
+var dbURIFlag string
+var dbHostFlag string
+var dbPortFlag int
+var dbNameFlag string
+var dbUserFlag string
+var dbPassFlag string
+
+var scanIntervalFlag time.Duration
+var onceFlag bool
+var organiseDryRunFlag bool
+
+var debugFlag bool
+
+func init() {
+	flag.Usage = usage
+	root, _ := os.Getwd()
+	cfgPath := filepath.Join(root, "config.json")
+	flag.StringVar(&cfgFlag, "config", cfgPath, "Path to the config.json file")
+	flag.StringVar(&cfgFlag, "c", cfgPath, "Path to the config.json file")
+
+	flag.StringVar(&dbURIFlag, "dburi", "", "URI to the database")
+	flag.StringVar(&dbURIFlag, "U", "", "URI to the database")
+
+	flag.StringVar(&dbHostFlag, "dbhost", "", "Database host name. Can contain :<port>")
+	flag.StringVar(&dbHostFlag, "H", "", "Database host name. Can contain :<port>")
+
+	flag.IntVar(&dbPortFlag, "dbport", 0, "Database port")
+	flag.IntVar(&dbPortFlag, "P", 0, "Database port")
+
+	flag.StringVar(&dbNameFlag, "dbname", "", "Database name to connect to")
+	flag.StringVar(&dbNameFlag, "d", "", "Database name to connect to")
+
+	flag.StringVar(&dbUserFlag, "dbuser", "", "Username to use connecting to the database")
+
+	flag.StringVar(&dbPassFlag, "dbpass", "", "Password to use connecting to the database")
+
+	flag.DurationVar(&scanIntervalFlag, "scaninterval", 0,
+		"Time between full scans of the library paths")
+
+	flag.BoolVar(&onceFlag, "once", false, "scan the library paths once and exit")
+
+	flag.BoolVar(&organiseDryRunFlag, "organise-dryrun", false,
+		"log the moves organising managed library paths would make without making them")
+
+	flag.BoolVar(&debugFlag, "debug", false, "enable debug mode")
 
-func ProcessImport(imp Importer) error {
-	logutils.Log.Info("Searching for extensions", imp.Cfg.MediaExts)
-	imp.LibPath.SearchWalk(imp.Cfg.MediaExts, getMediaInfo)
-	return nil
 }
 
-func getMediaInfo(path string) error {
-	logutils.Log.Info("Getting metadata for ", path)
-	file, err := taglib.Read(path)
+func configParseFlags(cfg *config.Config) *config.Config {
+
+	flag.Parse()
+
+	cfgPath := cfgFlag
+
+	dbURI := dbURIFlag
+	dbHost := dbHostFlag
+	dbPort := dbPortFlag
+	dbName := dbNameFlag
+	dbUser := dbUserFlag
+	dbPass := dbPassFlag
+
+	scanInterval := scanIntervalFlag
+
+	debug := debugFlag
+
+	cfgPath, pathErr := filepath.Abs(cfgPath)
+	if pathErr != nil {
+		fmt.Println("could not get absolute path for config", pathErr)
+	}
+
+	fmt.Println("Loading config from: ", cfgPath)
+	cfg, err := config.LoadConfig(cfgPath)
 	if err != nil {
-		logutils.Log.Error("Could not open file", err)
-		return err
-	}
-	defer file.Close()
-
-	track := new(models.Track)
-	track.Path = path
-	track.Title = file.Title()
-	track.Album = file.Album()
-	track.Artist = file.Artist()
-	track.Genre = file.Genre()
-	track.Year = file.Year()
-	track.Bitrate = file.Bitrate()
-	track.Channels = file.Channels()
-	track.Length = file.Length()
-	track.Samplerate = file.Samplerate()
-
-	//file.Track()
-
-	logutils.Log.Info(fmt.Sprintf("%v+", track))
-	//logutils.Log.Info("Raw Metadata: ", meta.Raw())
-	logutils.Log.Info("Track Comment: ", file.Comment())
-
-	return nil
+		fmt.Println("Error when loading configuration", err)
+	}
+
+	cfg = populateConfigEnv(cfg)
+
+	if dbURI != "" {
+		cfg.DBURI = dbURI
+	}
+	if dbHost != "" {
+		cfg.DBHost = dbHost
+	}
+	if dbPort != 0 {
+		cfg.DBPort = dbPort
+	}
+	if dbName != "" {
+		cfg.DBName = dbName
+	}
+	if dbUser != "" {
+		cfg.DBUser = dbUser
+	}
+	if dbPass != "" {
+		cfg.DBPassword = dbPass
+	}
+
+	if scanInterval != 0 {
+		cfg.ScanInterval = config.Duration{Duration: scanInterval}
+	}
+
+	if organiseDryRunFlag {
+		cfg.OrganiseDryRun = true
+	}
+
+	if !cfg.Debug && debug {
+		cfg.Debug = debug
+	}
+	return cfg
+}
+
+func populateConfigEnv(cfg *config.Config) *config.Config {
+	pre := "GOBROADCASTER_"
+	if dbURI, ok := os.LookupEnv(pre + "DBURI"); ok {
+		cfg.DBURI = dbURI
+	}
+	if dbHost, ok := os.LookupEnv(pre + "DBHOST"); ok {
+		cfg.DBHost = dbHost
+	}
+	if dbPortStr, ok := os.LookupEnv(pre + "DBPORT"); ok {
+		if dbPort, err := strconv.Atoi(dbPortStr); err != nil {
+			fmt.Println("Error parsing DBPORT from env, bad format: ", dbPortStr)
+		} else {
+			cfg.DBPort = dbPort
+		}
+	}
+	if dbName, ok := os.LookupEnv(pre + "DBNAME"); ok {
+		cfg.DBName = dbName
+	}
+	if dbUser, ok := os.LookupEnv(pre + "DBUSER"); ok {
+		cfg.DBUser = dbUser
+	}
+	if dbPass, ok := os.LookupEnv(pre + "DBPASS"); ok {
+		cfg.DBPassword = dbPass
+	}
+	if debugStr, ok := os.LookupEnv(pre + "DEBUG"); ok {
+		if debug, err := strconv.ParseBool(debugStr); err != nil {
+			fmt.Println("Error parsing DEBUG from env, bad format: ", debugStr, err.Error())
+		} else {
+			cfg.Debug = debug
+		}
+	}
+	if scanIntervalStr, ok := os.LookupEnv(pre + "SCANINTERVAL"); ok {
+		if scanInterval, err := time.ParseDuration(scanIntervalStr); err != nil {
+			fmt.Println("Error parsing SCANINTERVAL from env, bad format: ", scanIntervalStr, err.Error())
+		} else {
+			cfg.ScanInterval = config.Duration{Duration: scanInterval}
+		}
+	}
+	if watchDebounceStr, ok := os.LookupEnv(pre + "WATCHDEBOUNCE"); ok {
+		if watchDebounce, err := time.ParseDuration(watchDebounceStr); err != nil {
+			fmt.Println("Error parsing WATCHDEBOUNCE from env, bad format: ", watchDebounceStr, err.Error())
+		} else {
+			cfg.WatchDebounce = config.Duration{Duration: watchDebounce}
+		}
+	}
+	return cfg
 }
 
 func main() {
 
+	cfg := &config.Config{}
+	// load config from flags and Env
+	cfg = configParseFlags(cfg)
+
+	logutils.SetupLogging("broadcaster-mediamon", cfg.Debug, os.Stdout)
+	logutils.Log.Debug(fmt.Sprintf("Using config: %+v", cfg))
+
+	err := cfg.FillEmptyFromURI()
+	if err != nil {
+		logutils.Log.Errorf("Error loading database settings from URI: %s", err)
+	}
+
+	// the default of everything splitting tags, set before anything runs
+	if len(cfg.TagSeparators) > 0 {
+		tags.Separators = cfg.TagSeparators
+	}
+
+	db := pg.Connect(&pg.Options{
+		Addr:     cfg.DBHost + ":" + strconv.Itoa(cfg.DBPort),
+		Database: cfg.DBName,
+		User:     cfg.DBUser,
+		Password: cfg.DBPassword,
+	})
+	defer db.Close()
+
+	if cfg.Debug {
+		SetupDatabaseQueryLogging(db)
+	}
+
+	interval := cfg.ScanInterval.Duration
+	if interval <= 0 {
+		interval = defaultScanInterval
+	}
+	pollInterval := cfg.JobPollInterval.Duration
+	if pollInterval <= 0 {
+		pollInterval = defaultJobPollInterval
+	}
+	jobRetention := cfg.JobRetention.Duration
+	if jobRetention <= 0 {
+		jobRetention = defaultJobRetention
+	}
+	feedInterval := cfg.FeedPollInterval.Duration
+	if feedInterval <= 0 {
+		feedInterval = feeds.DefaultPollInterval
+	}
+
+	// jobs left running by a previous run will never finish
+	ijq := models.ImportJobQuery{
+		DB: db,
+	}
+	count, err := ijq.FailRunningJobs("interrupted")
+	if err != nil {
+		logutils.Log.Errorf("Error failing interrupted import jobs: %s", err)
+	} else if count > 0 {
+		logutils.Log.Infof("Failed %d interrupted import jobs", count)
+	}
+
+	// every scan adds a job, old ones are only history
+	pruneJobs := func() {
+		pruned, perr := ijq.PruneJobs(time.Now().Add(-jobRetention))
+		if perr != nil {
+			logutils.Log.Errorf("Error deleting old import jobs: %s", perr)
+		} else if pruned > 0 {
+			logutils.Log.Infof("Deleted %d import jobs older than %s", pruned, jobRetention)
+		}
+	}
+	pruneJobs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		logutils.Log.Infof("received %s, shutting down", sig)
+		cancel()
+	}()
+
+	if onceFlag {
+		err = ScanLibraries(ctx, db, cfg)
+		if err != nil {
+			logutils.Log.Errorf("Error scanning library paths: %s", err)
+		}
+		return
+	}
+
+	watcher, err := NewWatcher(db, *cfg)
+	if err != nil {
+		logutils.Log.Errorf("Error creating file watcher: %s", err)
+		return
+	}
+	defer watcher.Close()
+
+	go watcher.Run(ctx.Done())
+
+	watch := func() {
+		// watch before scanning so changes made during the scan are caught
+		werr := watcher.WatchLibraries()
+		if werr != nil {
+			logutils.Log.Errorf("Error watching library paths: %s", werr)
+		}
+	}
+
+	scan := func() {
+		watch()
+		serr := ScanLibraries(ctx, db, cfg)
+		if serr != nil {
+			logutils.Log.Errorf("Error scanning library paths: %s", serr)
+		}
+		pruneJobs()
+		if ctx.Err() == nil {
+			logutils.Log.Infof("next scan in %s", interval)
+		}
+	}
+
+	runJobs := func() {
+		// queued scans may be of library paths added since the last scan
+		watch()
+		jerr := RunQueuedJobs(ctx, db, cfg)
+		if jerr != nil && ctx.Err() == nil {
+			logutils.Log.Errorf("Error running import jobs: %s", jerr)
+		}
+	}
+
+	poller := feeds.NewPoller(db, cfg)
+	pollFeeds := func() {
+		if cfg.FeedDir == "" {
+			return
+		}
+		ferr := poller.PollAll(ctx)
+		if ferr != nil && ctx.Err() == nil {
+			logutils.Log.Errorf("Error polling feeds: %s", ferr)
+		}
+	}
+
+	scan()
+	pollFeeds()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pollTicker := time.NewTicker(pollInterval)
+	defer pollTicker.Stop()
+	feedTicker := time.NewTicker(feedInterval)
+	defer feedTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			scan()
+		case <-pollTicker.C:
+			runJobs()
+		case <-feedTicker.C:
+			pollFeeds()
+		case <-ctx.Done():
+			return
+		}
+	}
+
+}
+
+func usage() {
+	fmt.Print(usageText)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+type dbLogger struct{}
+
+func (d dbLogger) BeforeQuery(q *pg.QueryEvent) {}
+
+func (d dbLogger) AfterQuery(q *pg.QueryEvent) {
+	query, err := q.FormattedQuery()
+	if err != nil {
+		panic(err)
+	}
+
+	logutils.Log.Debugf("%s", query)
+}
+
+func SetupDatabaseQueryLogging(db *pg.DB) {
+	db.AddQueryHook(dbLogger{})
 }
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/importer"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/playlists"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// defaultWatchDebounce is used when no watch debounce is configured
+const defaultWatchDebounce = 2 * time.Second
+
+// defaultStoragePollInterval is used when no storage poll interval is
+// configured
+const defaultStoragePollInterval = time.Minute
+
+// Watcher watches the directories of the library paths for changes and
+// keeps the tracks in the database in sync with the files on disk.
+// Events for a path are debounced so a file that is still being written
+// is only imported once it has settled. Library paths in object stores
+// can't be watched and are listed every PollInterval instead.
+type Watcher struct {
+	Db           *pg.DB
+	Cfg          config.Config
+	Debounce     time.Duration
+	PollInterval time.Duration
+
+	fsw       *fsnotify.Watcher
+	pipeline  *importer.Pipeline
+	playlists *playlists.Importer
+	mu        sync.Mutex
+	pending   map[string]*time.Timer
+	// ignores are the ignore rules of each library path
+	ignores []*utils.Ignore
+	// polls stop the polling of each remote library path by it's root
+	polls map[string]context.CancelFunc
+	// roots are the roots of the local library paths that are watched
+	roots map[string]bool
+	// dirs are the directories that are watched
+	dirs map[string]bool
+}
+
+// NewWatcher creates a Watcher, it must be closed when no longer used
+func NewWatcher(db *pg.DB, cfg config.Config) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	debounce := cfg.WatchDebounce.Duration
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+	pollInterval := cfg.StoragePollInterval.Duration
+	if pollInterval <= 0 {
+		pollInterval = defaultStoragePollInterval
+	}
+
+	w := &Watcher{
+		Db:           db,
+		Cfg:          cfg,
+		Debounce:     debounce,
+		PollInterval: pollInterval,
+		fsw:          fsw,
+		pipeline:     importer.NewPipeline(db, &cfg),
+		playlists:    playlists.NewImporter(db, &cfg),
+		pending:      make(map[string]*time.Timer),
+		polls:        make(map[string]context.CancelFunc),
+		roots:        make(map[string]bool),
+		dirs:         make(map[string]bool),
+	}
+	return w, nil
+}
+
+// WatchLibraries adds watches for every library path in the database.
+// Paths that are already watched are left as is so this can be called
+// again to pick up newly added library paths and changed ignore patterns,
+// library paths that were removed since are no longer watched or polled.
+func (w *Watcher) WatchLibraries() error {
+	lpq := models.LibraryPathQuery{
+		DB: w.Db,
+	}
+
+	paths, err := lpq.GetAllLibraryPaths()
+	if err != nil {
+		return err
+	}
+
+	var ignores []*utils.Ignore
+	for _, lp := range paths {
+		ig, ierr := lp.IgnoreRules()
+		if ierr != nil {
+			logutils.Log.Errorf("Bad ignore patterns for library path '%s': %s", lp.Path, ierr)
+			continue
+		}
+		ignores = append(ignores, ig)
+	}
+	w.mu.Lock()
+	w.ignores = ignores
+	w.mu.Unlock()
+
+	remote := make(map[string]bool)
+	local := make(map[string]bool)
+	for _, lp := range paths {
+		rootPath, aerr := lp.Root()
+		if aerr != nil {
+			logutils.Log.Error("could not get an absolute path for", lp.Path)
+			continue
+		}
+		if !lp.Remote() {
+			local[rootPath] = true
+			continue
+		}
+		remote[rootPath] = true
+		if err = w.poll(rootPath); err != nil {
+			logutils.Log.Errorf("Error polling library path '%s': %s", rootPath, err)
+		}
+	}
+	w.stopPolls(remote)
+	// the roots are known before watching so their events aren't dropped
+	w.unwatch(local)
+	for rootPath := range local {
+		if err = w.watchTree(rootPath); err != nil {
+			logutils.Log.Errorf("Error watching library path '%s': %s", rootPath, err)
+		}
+	}
+	return nil
+}
+
+// watchTree adds a watch for root and every directory below it that isn't
+// ignored
+func (w *Watcher) watchTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logutils.Log.Error("error walking", path, err)
+			return nil
+		}
+		if info.IsDir() {
+			if w.ignored(path, true) {
+				return filepath.SkipDir
+			}
+			if werr := w.fsw.Add(path); werr != nil {
+				logutils.Log.Error("could not watch directory", path, werr)
+				return nil
+			}
+			w.mu.Lock()
+			w.dirs[path] = true
+			w.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// Run handles file system events until stop is closed
+func (w *Watcher) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(ev)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			logutils.Log.Error("file watcher error", err)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// poll starts listing the remote library path at root for changes, library
+// paths that are already polled are left as is
+func (w *Watcher) poll(root string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.polls[root]; ok {
+		return nil
+	}
+	st, prefix, err := w.pipeline.Storage.ResolveDir(root)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.polls[root] = cancel
+	events := storage.Poll(ctx, st, prefix, w.PollInterval)
+	go func() {
+		for ev := range events {
+			w.handleObjectEvent(ctx, st, ev)
+		}
+	}()
+	return nil
+}
+
+// stopPolls stops polling the remote library paths whose roots are not in
+// keep
+func (w *Watcher) stopPolls(keep map[string]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root, cancel := range w.polls {
+		if keep[root] {
+			continue
+		}
+		cancel()
+		delete(w.polls, root)
+		logutils.Log.Infof("Stopped polling removed library path '%s'", root)
+	}
+}
+
+// unwatch makes keep the local library path roots and removes the watches
+// of directories that are under none of them
+func (w *Watcher) unwatch(keep map[string]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root := range w.roots {
+		if !keep[root] {
+			logutils.Log.Infof("Stopped watching removed library path '%s'", root)
+		}
+	}
+	w.roots = keep
+	for dir := range w.dirs {
+		if w.inRoots(dir) {
+			continue
+		}
+		// the watch of a directory that was deleted is already gone
+		w.fsw.Remove(dir)
+		delete(w.dirs, dir)
+	}
+}
+
+// inRoots tests if path is under one of the watched local library paths,
+// w.mu must be held
+func (w *Watcher) inRoots(path string) bool {
+	for root := range w.roots {
+		if within(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// within tests if path is root or below it
+func within(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// Close stops watching and drops any pending changes
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	for path, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, path)
+	}
+	for root, cancel := range w.polls {
+		cancel()
+		delete(w.polls, root)
+	}
+	w.mu.Unlock()
+	return w.fsw.Close()
+}
+
+func (w *Watcher) handleEvent(ev fsnotify.Event) {
+	if ev.Op == fsnotify.Chmod {
+		return
+	}
+
+	if filepath.Base(ev.Name) == utils.IgnoreFileName {
+		w.ignoreFileChanged(filepath.Dir(ev.Name))
+		return
+	}
+
+	info, err := os.Stat(ev.Name)
+	isDir := err == nil && info.IsDir()
+	if w.ignored(ev.Name, isDir) {
+		return
+	}
+
+	if ev.Op&fsnotify.Create == fsnotify.Create && isDir {
+		// watch new directories right away so files written into
+		// them straight after they are made are not missed
+		w.watchNewDir(ev.Name)
+		return
+	}
+
+	w.schedule(ev.Name)
+}
+
+// handleObjectEvent brings the database in line with a change found by
+// polling a remote library path. Listings only hold objects that are there
+// in full so there is nothing to debounce.
+func (w *Watcher) handleObjectEvent(ctx context.Context, st storage.Storage, ev storage.Event) {
+	path := st.Path(ev.Object.Key)
+	if strings.HasSuffix(ev.Object.Key, "/") || w.ignored(path, false) {
+		return
+	}
+	if ev.Op == storage.Removed {
+		w.gone(path)
+		return
+	}
+	if playlists.IsPlaylist(path) {
+		w.importPlaylist(path)
+		return
+	}
+	ti, err := w.pipeline.ImportObject(ctx, st, ev.Object)
+	w.logImport(path, ti, err)
+}
+
+// ignoreFor returns the ignore rules of the library path holding path, or
+// nil if it's in none of them
+func (w *Watcher) ignoreFor(path string) *utils.Ignore {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var found *utils.Ignore
+	for _, ig := range w.ignores {
+		root := ig.Root()
+		if !within(path, root) {
+			continue
+		}
+		// library paths may be nested, the innermost one applies
+		if found == nil || len(root) > len(found.Root()) {
+			found = ig
+		}
+	}
+	return found
+}
+
+// ignored tests if path is ignored by the rules of it's library path
+func (w *Watcher) ignored(path string, isDir bool) bool {
+	ig := w.ignoreFor(path)
+	return ig != nil && ig.Ignored(path, isDir)
+}
+
+// ignoreFileChanged reads the ignore file of dir again and looks for files
+// under dir it may no longer ignore. Files it ignores now are marked
+// missing by the next scan.
+func (w *Watcher) ignoreFileChanged(dir string) {
+	ig := w.ignoreFor(dir)
+	if ig == nil {
+		return
+	}
+	ig.Forget(dir)
+	if ig.Ignored(dir, true) {
+		return
+	}
+	w.watchNewDir(dir)
+}
+
+// watchNewDir watches a directory that appeared under a library path
+// and queues any files that were already moved in with it
+func (w *Watcher) watchNewDir(dir string) {
+	err := w.watchTree(dir)
+	if err != nil {
+		logutils.Log.Errorf("Error watching directory '%s': %s", dir, err)
+	}
+	fw := utils.NewFileWalker(context.Background(), dir, w.walkOptions(dir))
+	for fw.Next() {
+		w.schedule(fw.Path())
+	}
+	for _, werr := range fw.Errors() {
+		logutils.Log.Errorf("Error searching directory '%s': %s", dir, werr)
+	}
+}
+
+func (w *Watcher) walkOptions(dir string) utils.WalkOptions {
+	return utils.WalkOptions{
+		FollowSymlinks: w.Cfg.FollowSymlinks,
+		Ignore:         w.ignoreFor(dir),
+	}
+}
+
+// schedule queues a sync of path, pushing back any sync already queued
+func (w *Watcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if timer, ok := w.pending[path]; ok {
+		timer.Reset(w.Debounce)
+		return
+	}
+	w.pending[path] = time.AfterFunc(w.Debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, path)
+		w.mu.Unlock()
+		w.sync(path)
+	})
+}
+
+// sync brings the database in line with the current state of path, paths
+// of library paths that were removed while they were queued are dropped
+func (w *Watcher) sync(path string) {
+	w.mu.Lock()
+	watched := w.inRoots(path)
+	w.mu.Unlock()
+	if !watched {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		w.mu.Lock()
+		delete(w.dirs, path)
+		w.mu.Unlock()
+		w.gone(path)
+		return
+	}
+	if err != nil {
+		logutils.Log.Error("Could not stat", path, err)
+		return
+	}
+
+	if info.IsDir() {
+		return
+	}
+	if playlists.IsPlaylist(path) {
+		w.importPlaylist(path)
+		return
+	}
+
+	ti, err := w.pipeline.ImportFile(context.Background(), path)
+	w.logImport(path, ti, err)
+}
+
+// importPlaylist imports the playlist file at path, the playlist of a file
+// that is removed is kept
+func (w *Watcher) importPlaylist(path string) {
+	res, err := w.playlists.ImportFile(context.Background(), path)
+	if err != nil {
+		logutils.Log.Error("Could not import playlist file", path, err)
+		return
+	}
+	if !res.Unchanged {
+		logutils.Log.Infof("Imported playlist '%s' from '%s', %d entries unresolved",
+			res.Playlist.Name, path, len(res.Unresolved))
+	}
+}
+
+// gone marks the tracks of a path that was removed or renamed away missing,
+// it could have been a file or a whole directory. The tracks are kept so
+// they can be relinked if the files show up somewhere else.
+func (w *Watcher) gone(path string) {
+	tq := models.TrackQuery{
+		DB: w.Db,
+	}
+	count, err := tq.MarkMissingByPath(path)
+	if err != nil {
+		logutils.Log.Error("Could not mark tracks missing for", path, err)
+		return
+	}
+	if count > 0 {
+		logutils.Log.Infof("Marked %d tracks missing for '%s'", count, path)
+	}
+	ieq := models.ImportErrorQuery{
+		DB: w.Db,
+	}
+	ieq.ClearPath(path)
+}
+
+// logImport logs the outcome of importing the file at path
+func (w *Watcher) logImport(path string, ti *models.TrackImport, err error) {
+	if err == importer.ErrNotMedia {
+		return
+	}
+	if err != nil {
+		logutils.Log.Error("Could not import file", path, err)
+		return
+	}
+	switch ti.Status {
+	case models.ImportCreated:
+		logutils.Log.Info("Added track", ti.Track)
+	case models.ImportUpdated:
+		logutils.Log.Info("Updated track", ti.Track)
+	case models.ImportRelinked:
+		logutils.Log.Info("Relinked moved track", ti.Track)
+	default:
+		logutils.Log.Debug("Unchanged track", path)
+	}
+}
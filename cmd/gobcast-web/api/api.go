@@ -8,12 +8,19 @@ import (
 	"github.com/labstack/echo/middleware"
 
 	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/tus"
 )
 
 type Api struct {
 	DB          *pg.DB
 	AuthTimeout time.Duration
 	Cfg         *config.Config
+	// Uploads holds the partial resumable uploads, they are refused if
+	// it's nil
+	Uploads *tus.Store
+	// Storage finds the storage the files of tracks are read from
+	Storage *storage.Resolver
 }
 
 type H map[string]interface{}
@@ -27,6 +34,11 @@ func RegisterRoutes(e *echo.Echo, a *Api, cfg *config.Config) {
 
 	e.POST("/auth", a.Login)
 
+	// tus clients ask what the server supports without credentials
+	e.OPTIONS("/api/uploads", a.TusOptions)
+	e.OPTIONS("/api/uploads/", a.TusOptions)
+	e.OPTIONS("/api/uploads/:id", a.TusOptions)
+
 	g := e.Group("/api")
 
 	g.Use(middleware.JWTWithConfig(middleware.JWTConfig{
@@ -55,13 +67,70 @@ func RegisterRoutes(e *echo.Echo, a *Api, cfg *config.Config) {
 	// Library Path
 	g.GET("/library", a.GetLibraryPaths)
 	g.GET("/library/id/:id", a.GetLibraryPathByID)
+	g.GET("/library/id/:id/ignore", a.GetLibraryPathIgnore)
+	g.PUT("/library/id/:id/ignore", a.SetLibraryPathIgnore)
+	g.GET("/library/id/:id/errors", a.GetLibraryPathErrors)
+	g.POST("/library/id/:id/errors/retry", a.RetryLibraryPathErrors)
+	g.POST("/library/id/:id/scan", a.ScanLibraryPath)
+	g.GET("/library/id/:id/organise", a.GetLibraryPathOrganise)
+	g.PUT("/library/id/:id/organise", a.SetLibraryPathOrganise)
+	g.PUT("/library/id/:id/writetags", a.SetLibraryPathWriteTags)
+	g.GET("/library/duplicates", a.GetDuplicates)
+	g.POST("/library/duplicates/:id/resolve", a.ResolveDuplicates)
 	g.POST("/library", a.PutLibraryPath)
 	g.DELETE("/library/:id", a.DeleteLibraryPath)
 
+	// Import Job
+	g.GET("/jobs", a.GetImportJobs)
+	g.GET("/jobs/:id", a.GetImportJobByID)
+
 	// Track
 	g.GET("/track/id/:id", a.GetTrackByID)
+	g.PUT("/track/id/:id", a.UpdateTrackByID)
+	g.GET("/track/id/:id/waveform", a.GetTrackWaveform)
+	g.GET("/track/id/:id/art", a.GetTrackArt)
+	g.GET("/track/id/:id/audio", a.GetTrackAudio)
+	g.PUT("/track/id/:id/cue", a.SetTrackCue)
+	g.DELETE("/track/id/:id/cue", a.ResetTrackCue)
 	g.GET("/track", a.GetTracks)
 	g.POST("/track", a.AddTrack)
 	g.DELETE("/track/:id", a.DeleteTrack)
 
+	// Playlist
+	g.GET("/playlist", a.GetPlaylists)
+	g.GET("/playlist/id/:id", a.GetPlaylistByID)
+	g.DELETE("/playlist/id/:id", a.DeletePlaylist)
+	g.POST("/playlist/id/:id/unresolved/:entry", a.MatchUnresolvedEntry)
+	g.POST("/playlist/upload", a.UploadPlaylist)
+
+	// Feed
+	g.GET("/feed", a.GetFeeds)
+	g.GET("/feed/id/:id", a.GetFeedByID)
+	g.POST("/feed", a.AddFeed)
+	g.PUT("/feed/id/:id", a.UpdateFeedByID)
+	g.DELETE("/feed/id/:id", a.DeleteFeed)
+
+	// Upload
+	g.POST("/upload", a.UploadTrack)
+	g.POST("/uploads", a.CreateUpload)
+	g.POST("/uploads/", a.CreateUpload)
+	g.HEAD("/uploads/:id", a.HeadUpload)
+	g.PATCH("/uploads/:id", a.PatchUpload)
+	g.DELETE("/uploads/:id", a.DeleteUpload)
+	g.GET("/uploads/:id", a.GetUpload)
+
+	// Artist
+	g.GET("/artist", a.GetArtists)
+	g.GET("/artist/id/:id", a.GetArtistByID)
+	g.POST("/artist/id/:id/merge", a.MergeArtists)
+
+	// Album
+	g.GET("/album", a.GetAlbums)
+	g.GET("/album/id/:id", a.GetAlbumByID)
+	g.POST("/album/id/:id/merge", a.MergeAlbums)
+
+	// Genre
+	g.GET("/genre", a.GetGenres)
+	g.GET("/genre/id/:id", a.GetGenreByID)
+
 }
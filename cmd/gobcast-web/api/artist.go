@@ -0,0 +1,247 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// GET /api/artist
+func (a *Api) GetArtists(c echo.Context) error {
+	q := models.ArtistQuery{
+		DB: a.DB,
+	}
+
+	artists, count, err := q.GetArtists(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"artists": artists,
+			"count":   count,
+		},
+	})
+}
+
+// GET /api/artist/id/:id
+func (a *Api) GetArtistByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.ArtistQuery{
+		DB: a.DB,
+	}
+	artist, err := q.GetArtistByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"artist": artist,
+		},
+	})
+}
+
+// POST /api/artist/id/:id/merge
+// merges the artists listed in the form value from, which may be repeated,
+// into the artist
+func (a *Api) MergeArtists(c echo.Context) error {
+	id, from, err := mergeParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.ArtistQuery{
+		DB: a.DB,
+	}
+	artist, err := q.MergeArtists(id, from)
+	if err != nil {
+		return c.JSON(mergeErrorStatus(err), Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"artist": artist,
+			"merged": from,
+		},
+	})
+}
+
+// GET /api/album
+func (a *Api) GetAlbums(c echo.Context) error {
+	q := models.AlbumQuery{
+		DB: a.DB,
+	}
+
+	albums, count, err := q.GetAlbums(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"albums": albums,
+			"count":  count,
+		},
+	})
+}
+
+// GET /api/album/id/:id
+func (a *Api) GetAlbumByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.AlbumQuery{
+		DB: a.DB,
+	}
+	album, err := q.GetAlbumByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"album": album,
+		},
+	})
+}
+
+// POST /api/album/id/:id/merge
+// merges the albums listed in the form value from, which may be repeated,
+// into the album
+func (a *Api) MergeAlbums(c echo.Context) error {
+	id, from, err := mergeParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.AlbumQuery{
+		DB: a.DB,
+	}
+	album, err := q.MergeAlbums(id, from)
+	if err != nil {
+		return c.JSON(mergeErrorStatus(err), Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"album":  album,
+			"merged": from,
+		},
+	})
+}
+
+// mergeParams reads the id to merge into and the ids to merge from a merge
+// request
+func mergeParams(c echo.Context) (id int64, from []int64, err error) {
+	id, err = strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return
+	}
+	values, err := c.FormParams()
+	if err != nil {
+		return
+	}
+	for _, v := range values["from"] {
+		var fid int64
+		fid, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			logutils.Log.Error("cant parse id", err)
+			return
+		}
+		from = append(from, fid)
+	}
+	return
+}
+
+func mergeErrorStatus(err error) int {
+	switch err {
+	case pg.ErrNoRows:
+		return http.StatusNotFound
+	case models.ErrMergeSelf:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GET /api/genre
+func (a *Api) GetGenres(c echo.Context) error {
+	q := models.GenreQuery{
+		DB: a.DB,
+	}
+
+	genres, count, err := q.GetGenres(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"genres": genres,
+			"count":  count,
+		},
+	})
+}
+
+// GET /api/genre/id/:id
+func (a *Api) GetGenreByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.GenreQuery{
+		DB: a.DB,
+	}
+	genre, err := q.GetGenreByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"genre": genre,
+		},
+	})
+}
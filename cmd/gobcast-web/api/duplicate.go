@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// GET /api/library/duplicates
+// lists the groups of duplicate tracks found by the media monitor's last
+// search, ?kind= is content or metadata
+func (a *Api) GetDuplicates(c echo.Context) error {
+	q := models.DuplicateGroupQuery{
+		DB: a.DB,
+	}
+
+	groups, count, err := q.GetDuplicateGroups(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"groups": groups,
+			"count":  count,
+		},
+	})
+}
+
+// POST /api/library/duplicates/:id/resolve
+// keeps the track in the form value keep and retires the other tracks of
+// the group, playlists holding them get the kept track instead
+func (a *Api) ResolveDuplicates(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	keep, err := strconv.ParseInt(c.FormValue("keep"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse keep", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.DuplicateGroupQuery{
+		DB: a.DB,
+	}
+
+	retired, err := q.Resolve(id, keep)
+	switch {
+	case err == pg.ErrNoRows:
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	case err == models.ErrNotInGroup:
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"kept":    keep,
+			"retired": retired,
+		},
+	})
+}
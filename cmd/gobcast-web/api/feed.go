@@ -0,0 +1,215 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/feeds"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// feedCheckTimeout is how long checking a feed when subscribing may take
+const feedCheckTimeout = 30 * time.Second
+
+// GET /api/feed
+func (a *Api) GetFeeds(c echo.Context) error {
+	q := models.FeedQuery{
+		DB: a.DB,
+	}
+
+	subs, count, err := q.GetFeeds(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"feeds": subs,
+			"count": count,
+		},
+	})
+}
+
+// GET /api/feed/id/:id
+// returns the feed subscription with it's episodes, newest first
+func (a *Api) GetFeedByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.FeedQuery{
+		DB: a.DB,
+	}
+	sub, err := q.GetFeedByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"feed": sub,
+		},
+	})
+}
+
+// POST /api/feed
+// subscribes to the RSS or Atom feed at the form value url, keeping the
+// newest retention episodes or feeds.DefaultRetention when it's not given.
+// The feed is fetched first so feeds that can't be read are refused, it's
+// episodes are downloaded by the media monitor.
+func (a *Api) AddFeed(c echo.Context) error {
+	if a.Cfg.FeedDir == "" {
+		return c.JSON(http.StatusServiceUnavailable, Responce{
+			Err: feeds.ErrFeedsDisabled,
+		})
+	}
+	retention := feeds.DefaultRetention
+	if value := c.FormValue("retention"); value != "" {
+		var err error
+		retention, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+
+	sub := &models.FeedSubscription{URL: c.FormValue("url")}
+	poller := &feeds.Poller{
+		Client: &http.Client{Timeout: feedCheckTimeout},
+	}
+	feed, err := poller.Fetch(c.Request().Context(), sub)
+	if err != nil {
+		logutils.Log.Error("Could not fetch feed", sub.URL, err)
+		return c.JSON(http.StatusUnprocessableEntity, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.FeedQuery{
+		DB: a.DB,
+	}
+	sub, err = q.AddFeed(sub.URL, feed.Title, retention)
+	if err == models.ErrBadRetention {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusCreated, Responce{
+		Data: H{
+			"feed":     sub,
+			"episodes": len(feed.Items),
+		},
+	})
+}
+
+// PUT /api/feed/id/:id
+// sets how many episodes of the feed are kept from the form value
+// retention and if it's polled from enabled, those not given are left as
+// they are
+func (a *Api) UpdateFeedByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.FeedQuery{
+		DB: a.DB,
+	}
+	sub, err := q.GetFeedByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	retention, enabled := sub.Retention, sub.Enabled
+	if value := c.FormValue("retention"); value != "" {
+		retention, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+	if value := c.FormValue("enabled"); value != "" {
+		enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+
+	sub, err = q.UpdateFeed(id, retention, enabled)
+	if err == models.ErrBadRetention {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	if err == pg.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"feed": sub,
+		},
+	})
+}
+
+// DELETE /api/feed/id/:id
+// unsubscribes from the feed, the tracks of it's downloaded episodes stay
+// in the library
+func (a *Api) DeleteFeed(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.FeedQuery{
+		DB: a.DB,
+	}
+	err = q.DeleteFeedByID(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"deleted": id,
+		},
+	})
+}
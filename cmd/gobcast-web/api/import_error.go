@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// GET /api/library/id/:id/errors
+// lists the files of the library path that failed to import, ?class= limits
+// them to a class of error
+func (a *Api) GetLibraryPathErrors(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.ImportErrorQuery{
+		DB: a.DB,
+	}
+
+	errs, count, err := q.GetImportErrors(id, c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"errors": errs,
+			"count":  count,
+		},
+	})
+}
+
+// POST /api/library/id/:id/errors/retry
+// queues a scan of the library path for the media monitor, which imports
+// it's failed files again and drops the errors of those that are gone. The
+// job is returned to be followed through /api/jobs/:id.
+func (a *Api) RetryLibraryPathErrors(c echo.Context) error {
+	// files without a track, like those that failed, are read by every scan
+	return a.ScanLibraryPath(c)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// POST /api/library/id/:id/scan
+// queues a scan of the library path for the media monitor, if one is
+// already queued that job is returned
+func (a *Api) ScanLibraryPath(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.ImportJobQuery{
+		DB: a.DB,
+	}
+
+	job, err := q.QueueJob(id)
+	if err == pg.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, Responce{
+		Data: H{
+			"job": job,
+		},
+	})
+}
+
+// GET /api/jobs
+func (a *Api) GetImportJobs(c echo.Context) error {
+	q := models.ImportJobQuery{
+		DB: a.DB,
+	}
+
+	jobs, count, err := q.GetImportJobs(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"jobs":  jobs,
+			"count": count,
+		},
+	})
+}
+
+// GET /api/jobs/:id
+func (a *Api) GetImportJobByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.ImportJobQuery{
+		DB: a.DB,
+	}
+
+	job, err := q.GetImportJobByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"job": job,
+		},
+	})
+}
@@ -5,9 +5,12 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-pg/pg"
 	"github.com/labstack/echo"
 	"github.com/ryex/go-broadcaster/internal/logutils"
 	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/organise"
+	"github.com/ryex/go-broadcaster/internal/utils"
 )
 
 // GET /api/library/id/:id
@@ -119,3 +122,232 @@ func (a *Api) DeleteLibraryPath(c echo.Context) error {
 		},
 	})
 }
+
+// GET /api/library/id/:id/ignore
+func (a *Api) GetLibraryPathIgnore(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+
+	libp, err := q.GetLibraryPathByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	patterns := libp.Ignore
+	if patterns == nil {
+		patterns = []string{}
+	}
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"ignore": patterns,
+		},
+	})
+}
+
+// PUT /api/library/id/:id/ignore
+// replaces the ignore patterns of the library path with the form value
+// pattern, which may be repeated. Sending none clears them.
+func (a *Api) SetLibraryPathIgnore(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	values, err := c.FormParams()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	patterns := values["pattern"]
+	err = utils.ValidateIgnorePatterns(patterns)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+
+	libp, err := q.SetIgnore(id, patterns)
+	if err == pg.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"path": libp,
+		},
+	})
+}
+
+// GET /api/library/id/:id/organise
+// returns the organise settings of the library path and the moves
+// organising it would make now
+func (a *Api) GetLibraryPathOrganise(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+
+	libp, err := q.GetLibraryPathByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	layout, err := organise.LayoutOf(libp)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	moves := []organise.Move{}
+	if libp.Managed {
+		o := organise.Organiser{
+			DB:     a.DB,
+			DryRun: true,
+		}
+		moves, err = o.Organise(c.Request().Context(), libp)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Responce{
+				Err: err,
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"organise": libp.Organise,
+			"layout":   layout.String(),
+			"moves":    moves,
+		},
+	})
+}
+
+// PUT /api/library/id/:id/organise
+// sets the form values organise, true or false, and layout of a managed
+// library path. An empty layout uses the default one.
+func (a *Api) SetLibraryPathOrganise(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	enabled, err := strconv.ParseBool(c.FormValue("organise"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	layout := c.FormValue("layout")
+	if layout != "" {
+		if _, err = organise.ParseLayout(layout); err != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+
+	q := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+
+	libp, err := q.SetOrganise(id, enabled, layout)
+	switch {
+	case err == pg.ErrNoRows:
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	case err == models.ErrNotManaged:
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"path": libp,
+		},
+	})
+}
+
+// PUT /api/library/id/:id/writetags
+// sets the form value write_tags, true or false, deciding if tag edits to the
+// tracks of the library path are written back to their files
+func (a *Api) SetLibraryPathWriteTags(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	enabled, err := strconv.ParseBool(c.FormValue("write_tags"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+
+	libp, err := q.SetWriteTags(id, enabled)
+	switch {
+	case err == pg.ErrNoRows:
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"path": libp,
+		},
+	})
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/playlists"
+)
+
+// GET /api/playlist
+func (a *Api) GetPlaylists(c echo.Context) error {
+	q := models.PlaylistQuery{
+		DB: a.DB,
+	}
+
+	playlists, count, err := q.GetPlaylists(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"playlists": playlists,
+			"count":     count,
+		},
+	})
+}
+
+// GET /api/playlist/id/:id
+// returns the playlist with it's entries in order and the entries of the
+// file it was imported from that matched no track
+func (a *Api) GetPlaylistByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.PlaylistQuery{
+		DB: a.DB,
+	}
+	p, err := q.GetPlaylistByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"playlist": p,
+		},
+	})
+}
+
+// DELETE /api/playlist/id/:id
+func (a *Api) DeletePlaylist(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.PlaylistQuery{
+		DB: a.DB,
+	}
+	err = q.DeletePlaylistByID(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"deleted": id,
+		},
+	})
+}
+
+// POST /api/playlist/upload
+// imports the M3U, PLS or XSPF playlist file in the multipart form value
+// file as a new playlist named after the form value name, the title in the
+// file or the file name. The entries that matched no track are returned to
+// be matched by hand.
+func (a *Api) UploadPlaylist(c echo.Context) error {
+	req := c.Request()
+	// leave room for the rest of the form around the file
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, playlists.MaxFileSize+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: errNoUploadFile,
+		})
+	}
+	if !playlists.IsPlaylist(fh.Filename) {
+		return c.JSON(http.StatusUnsupportedMediaType, Responce{
+			Err: playlists.ErrUnknownFormat,
+		})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	defer f.Close()
+
+	file, err := playlists.Parse(f, fh.Filename)
+	if err != nil {
+		logutils.Log.Error("Rejected playlist upload", fh.Filename, err)
+		return c.JSON(http.StatusUnprocessableEntity, Responce{
+			Err: err,
+		})
+	}
+	name := c.FormValue("name")
+	if name == "" && file.Title == "" {
+		name = strings.TrimSuffix(filepath.Base(fh.Filename), filepath.Ext(fh.Filename))
+	}
+
+	imp := playlists.NewImporter(a.DB, a.Cfg)
+	res, err := imp.Import(file, name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusCreated, Responce{
+		Data: H{
+			"playlist":   res.Playlist,
+			"resolved":   res.Resolved,
+			"unresolved": res.Unresolved,
+		},
+	})
+}
+
+// POST /api/playlist/id/:id/unresolved/:entry
+// matches the unresolved entry to the track in the form value track, which
+// takes the entry's place in the playlist and keeps it when the playlist
+// file changes
+func (a *Api) MatchUnresolvedEntry(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	entry, err := strconv.ParseInt(c.Param("entry"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse entry", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	trackID, err := strconv.ParseInt(c.FormValue("track"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("cant parse track", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	tq := models.TrackQuery{
+		DB: a.DB,
+	}
+	if _, err = tq.GetTrackByID(trackID); err != nil {
+		if err == pg.ErrNoRows {
+			err = errors.New("no such track")
+		}
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.PlaylistQuery{
+		DB: a.DB,
+	}
+	pt, err := q.MatchUnresolved(id, entry, trackID, true)
+	if err == pg.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"entry": pt,
+		},
+	})
+}
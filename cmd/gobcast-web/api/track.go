@@ -1,13 +1,26 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/go-pg/pg"
 	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/artwork"
+	"github.com/ryex/go-broadcaster/internal/audio"
 	"github.com/ryex/go-broadcaster/internal/logutils"
 	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
 )
 
 // GET /api/track/id/:id
@@ -147,3 +160,375 @@ func (a *Api) DeleteTrack(c echo.Context) error {
 		},
 	})
 }
+
+// PUT /api/track/id/:id
+// Edits the tags of a track given as form values named after
+// models.TrackEditFields, fields left out are kept. When the track's library
+// path has write_tags set the tags the file can hold are written back to it.
+func (a *Api) UpdateTrackByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	form, err := c.FormParams()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	edits := make(map[string]string)
+	for _, field := range models.TrackEditFields {
+		if _, ok := form[field]; ok {
+			edits[field] = form.Get(field)
+		}
+	}
+
+	q := models.TrackQuery{
+		DB: a.DB,
+	}
+	te, err := q.EditTrack(id, edits)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(*models.EditError); ok || err == models.ErrNoEdits {
+			status = http.StatusBadRequest
+		} else if err == pg.ErrNoRows {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"track":       te.Track,
+			"written":     te.Written,
+			"not_written": te.NotWritten,
+		},
+	})
+}
+
+// PUT /api/track/id/:id/cue
+// Overrides the detected cue points with the form values cue_in and cue_out,
+// given as durations like "1.5s"
+func (a *Api) SetTrackCue(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	in, err := time.ParseDuration(c.FormValue("cue_in"))
+	if err != nil {
+		logutils.Log.Error("Error parsing cue_in", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	out, err := time.ParseDuration(c.FormValue("cue_out"))
+	if err != nil {
+		logutils.Log.Error("Error parsing cue_out", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.TrackQuery{
+		DB: a.DB,
+	}
+
+	t, err := q.GetTrackByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	// the length read from the tags is cut down to whole seconds
+	if in < 0 || out <= in || (t.Length > 0 && out > t.Length+time.Second) {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: fmt.Errorf("cue points %s to %s are outside the track", in, out),
+		})
+	}
+
+	t, err = q.SetCue(id, in, out)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"track": t,
+		},
+	})
+}
+
+// DELETE /api/track/id/:id/cue
+// Drops the cue points set by hand, mediamon detects them again on it's next
+// scan
+func (a *Api) ResetTrackCue(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.TrackQuery{
+		DB: a.DB,
+	}
+
+	t, err := q.ResetCue(id)
+	if err == pg.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"track": t,
+		},
+	})
+}
+
+// GET /api/track/id/:id/waveform
+// Serves the waveform peaks of a track in the audiowaveform JSON format, or
+// the binary format with ?format=dat, so they can be handed straight to a
+// waveform viewer. ?samples_per_pixel zooms out to a multiple of the stored
+// resolution.
+func (a *Api) GetTrackWaveform(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	q := models.TrackQuery{
+		DB: a.DB,
+	}
+	t, err := q.GetTrackByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if t.Waveform == "" {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: errors.New("the waveform of the track has not been generated"),
+		})
+	}
+
+	format := c.QueryParam("format")
+	spp := c.QueryParam("samples_per_pixel")
+
+	// the waveform is named by the content of the track so it is only
+	// replaced along with the file
+	etag := fmt.Sprintf(`"%s-%s-%s"`, filepath.Base(t.Waveform), spp, format)
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	f, err := os.Open(a.Cfg.DataPath(t.Waveform))
+	if err != nil {
+		logutils.Log.Error("Could not open waveform", t.Waveform, err)
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	defer f.Close()
+
+	peaks, err := audio.ReadPeaks(bufio.NewReader(f))
+	if err != nil {
+		logutils.Log.Error("Could not read waveform", t.Waveform, err)
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+
+	if spp != "" {
+		n, perr := strconv.Atoi(spp)
+		if perr != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: perr,
+			})
+		}
+		peaks, err = peaks.Resample(n)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+
+	if format == "dat" {
+		var buf bytes.Buffer
+		peaks.WriteTo(&buf)
+		return c.Blob(http.StatusOK, "application/octet-stream", buf.Bytes())
+	}
+	return c.JSON(http.StatusOK, peaks)
+}
+
+// GET /api/track/id/:id/audio
+// Streams the file of a track from the storage it's kept in, ranges are
+// served so players can seek.
+func (a *Api) GetTrackAudio(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	tq := models.TrackQuery{
+		DB: a.DB,
+	}
+	t, err := tq.GetTrackByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if t.Missing {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: errors.New("the file of the track is missing"),
+		})
+	}
+
+	st, key, err := a.Storage.Resolve(t.Path)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Responce{
+			Err: err,
+		})
+	}
+	ctx := c.Request().Context()
+	obj, err := st.Stat(ctx, key)
+	if err == nil {
+		var f storage.File
+		f, err = st.Open(ctx, key)
+		if err == nil {
+			defer f.Close()
+			http.ServeContent(c.Response(), c.Request(), path.Base(key), obj.ModTime, f)
+			return nil
+		}
+	}
+	if storage.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	logutils.Log.Error("Could not open file of track", t.Path, err)
+	return c.JSON(http.StatusInternalServerError, Responce{
+		Err: err,
+	})
+}
+
+// defaultArtSize is the thumbnail size served when none is asked for
+const defaultArtSize = 256
+
+// GET /api/track/id/:id/art
+// Serves the cover art of a track as a JPEG thumbnail ?size pixels square,
+// rounded up to one of the sizes thumbnails are cached at. ?size=0 serves
+// the image as it was found.
+func (a *Api) GetTrackArt(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logutils.Log.Error("Error parsing id", err)
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+
+	size := defaultArtSize
+	if s := c.QueryParam("size"); s != "" {
+		size, err = strconv.Atoi(s)
+		if err != nil || size < 0 {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: fmt.Errorf("invalid size '%s'", s),
+			})
+		}
+	}
+	if size > 0 {
+		size = artwork.ThumbnailSize(size)
+	}
+
+	tq := models.TrackQuery{
+		DB: a.DB,
+	}
+	t, err := tq.GetTrackByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+	if t.ArtworkID == 0 {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: errors.New("the track has no artwork"),
+		})
+	}
+
+	aq := models.ArtworkQuery{
+		DB: a.DB,
+	}
+	art, err := aq.GetArtworkByID(t.ArtworkID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Responce{
+			Err: err,
+		})
+	}
+
+	// artwork is stored by it's hash so it never changes under the same tag
+	etag := fmt.Sprintf(`"%s-%d"`, art.Hash, size)
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	original := a.Cfg.DataPath(art.Path)
+	if size == 0 {
+		return c.File(original)
+	}
+
+	thumb := a.Cfg.DataPath("artwork", "thumbs", art.Hash[:2], fmt.Sprintf("%s_%d.jpg", art.Hash, size))
+	if !utils.FileExists(thumb) {
+		err = makeThumbnail(thumb, original, size)
+		if err != nil {
+			logutils.Log.Error("Could not make thumbnail of", original, err)
+			return c.JSON(http.StatusInternalServerError, Responce{
+				Err: err,
+			})
+		}
+	}
+	return c.File(thumb)
+}
+
+// makeThumbnail scales the image at original down into a JPEG at thumb
+func makeThumbnail(thumb, original string, size int) error {
+	f, err := os.Open(original)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return utils.WriteFileAtomic(thumb, 0644, func(w io.Writer) error {
+		return artwork.Thumbnail(w, bufio.NewReader(f), size)
+	})
+}
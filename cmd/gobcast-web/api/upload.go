@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultUploadMaxSize is used when no upload size limit is configured
+const DefaultUploadMaxSize = 2 << 30
+
+var (
+	errUploadsDisabled = errors.New("uploads are not configured")
+	errUploadTooLarge  = errors.New("upload too large")
+	errNoUploadFile    = errors.New("no file in upload")
+)
+
+// uploadMaxSize returns the largest file that may be uploaded
+func (a *Api) uploadMaxSize() int64 {
+	if a.Cfg.UploadMaxSize > 0 {
+		return a.Cfg.UploadMaxSize
+	}
+	return DefaultUploadMaxSize
+}
+
+// uploadTempDir returns the directory uploads are written to before they
+// are moved into the library, it's kept out of the library so half written
+// files are never seen by the media monitor
+func (a *Api) uploadTempDir() (string, error) {
+	dir := a.Cfg.DataPath("uploads")
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// POST /api/upload
+// stores the audio file in the multipart form value file in the upload
+// directory, it's imported by the media monitor through the job returned
+func (a *Api) UploadTrack(c echo.Context) error {
+	if a.Cfg.UploadDir == "" {
+		return c.JSON(http.StatusServiceUnavailable, Responce{
+			Err: errUploadsDisabled,
+		})
+	}
+
+	max := a.uploadMaxSize()
+	req := c.Request()
+	// leave room for the rest of the form around the file
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, max+1<<20)
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Responce{
+			Err: err,
+		})
+	}
+	var name string
+	var tmp string
+	for tmp == "" {
+		part, perr := reader.NextPart()
+		if perr == io.EOF {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: errNoUploadFile,
+			})
+		}
+		if perr != nil {
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: perr,
+			})
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		name = part.FileName()
+		tmp, err = a.receiveUpload(part, max)
+		part.Close()
+		if err == errUploadTooLarge {
+			return c.JSON(http.StatusRequestEntityTooLarge, Responce{
+				Err: err,
+			})
+		}
+		if err != nil {
+			logutils.Log.Error("Could not receive upload", err)
+			return c.JSON(http.StatusBadRequest, Responce{
+				Err: err,
+			})
+		}
+	}
+	defer os.Remove(tmp)
+
+	path, job, status, err := a.storeUpload(tmp, name)
+	if err != nil {
+		return c.JSON(status, Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, Responce{
+		Data: H{
+			"path": path,
+			"job":  job,
+		},
+	})
+}
+
+// receiveUpload writes r to a temporary file, refusing more than max bytes
+func (a *Api) receiveUpload(r io.Reader, max int64) (path string, err error) {
+	dir, err := a.uploadTempDir()
+	if err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(dir, "upload")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	n, err := io.Copy(f, io.LimitReader(r, max+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > max {
+		err = errUploadTooLarge
+	}
+	return f.Name(), err
+}
+
+// storeUpload checks the uploaded file at tmp is audio, moves it into the
+// upload directory named after name and queues a scan of the directory for
+// the media monitor to import it. It returns the path the file was stored at
+// and the job, or on failure the status to respond with.
+func (a *Api) storeUpload(tmp, name string) (string, *models.ImportJob, int, error) {
+	format, err := audio.Validate(tmp)
+	if err != nil {
+		logutils.Log.Error("Rejected upload", name, err)
+		return "", nil, http.StatusUnsupportedMediaType, err
+	}
+
+	lpq := models.LibraryPathQuery{
+		DB: a.DB,
+	}
+	lp, err := lpq.FindOrAddManaged(a.Cfg.UploadDir)
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+	root, err := filepath.Abs(lp.Path)
+	if err == nil {
+		err = os.MkdirAll(root, 0755)
+	}
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+
+	name = utils.SanitizeFileName(filepath.Base(name))
+	if filepath.Ext(name) == "" {
+		name += format.Ext()
+	}
+	path, err := utils.MoveFileUnique(tmp, filepath.Join(root, name))
+	if err != nil {
+		logutils.Log.Error("Could not store upload", name, err)
+		return "", nil, http.StatusInternalServerError, err
+	}
+	logutils.Log.Info("Stored upload", path)
+
+	// importing decodes the whole file, that is left to the media monitor
+	ijq := models.ImportJobQuery{
+		DB: a.DB,
+	}
+	job, err := ijq.QueueJob(lp.ID)
+	if err != nil {
+		return path, nil, http.StatusInternalServerError, err
+	}
+	return path, job, 0, nil
+}
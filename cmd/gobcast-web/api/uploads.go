@@ -0,0 +1,228 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/tus"
+)
+
+// tusStatus maps the errors of the upload store to response statuses
+func tusStatus(err error) int {
+	switch err {
+	case tus.ErrNotFound:
+		return http.StatusNotFound
+	case tus.ErrExpired:
+		return http.StatusGone
+	case tus.ErrOffsetMismatch:
+		return http.StatusConflict
+	case tus.ErrLocked:
+		return http.StatusLocked
+	case tus.ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case tus.ErrBadMetadata, tus.ErrEmpty:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// tusCheck sets the headers every tus response carries and checks the
+// request speaks the protocol version implemented and uploads are enabled,
+// returning the status to fail with if not
+func (a *Api) tusCheck(c echo.Context) (int, error) {
+	h := c.Response().Header()
+	h.Set("Tus-Resumable", tus.Version)
+	if c.Request().Header.Get("Tus-Resumable") != tus.Version {
+		h.Set("Tus-Version", tus.Version)
+		return http.StatusPreconditionFailed, nil
+	}
+	if a.Uploads == nil || a.Cfg.UploadDir == "" {
+		return http.StatusServiceUnavailable, errUploadsDisabled
+	}
+	return 0, nil
+}
+
+func (a *Api) tusFail(c echo.Context, status int, err error) error {
+	if err == nil || c.Request().Method == http.MethodHead {
+		return c.NoContent(status)
+	}
+	return c.JSON(status, Responce{
+		Err: err,
+	})
+}
+
+// OPTIONS /api/uploads
+// describes the tus server, it's not authenticated as browsers don't send
+// credentials with preflight requests
+func (a *Api) TusOptions(c echo.Context) error {
+	h := c.Response().Header()
+	h.Set("Tus-Resumable", tus.Version)
+	h.Set("Tus-Version", tus.Version)
+	h.Set("Tus-Extension", tus.Extensions)
+	h.Set("Tus-Max-Size", strconv.FormatInt(a.uploadMaxSize(), 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// POST /api/uploads
+// starts a resumable upload, the Upload-Metadata may hold it's filename.
+// Empty uploads are refused.
+func (a *Api) CreateUpload(c echo.Context) error {
+	if status, err := a.tusCheck(c); status != 0 {
+		return a.tusFail(c, status, err)
+	}
+
+	req := c.Request()
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		// deferred lengths are not supported
+		return a.tusFail(c, http.StatusBadRequest, err)
+	}
+	if length == 0 {
+		// it would be complete with nothing ever sent to finish it
+		return a.tusFail(c, http.StatusBadRequest, tus.ErrEmpty)
+	}
+	if length > a.uploadMaxSize() {
+		return a.tusFail(c, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+	}
+	metadata, err := tus.ParseMetadata(req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return a.tusFail(c, tusStatus(err), err)
+	}
+
+	u, err := a.Uploads.Create(length, metadata)
+	if err != nil {
+		logutils.Log.Error("Could not create upload", err)
+		return a.tusFail(c, tusStatus(err), err)
+	}
+
+	h := c.Response().Header()
+	h.Set("Location", "/api/uploads/"+u.ID)
+	h.Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	return c.NoContent(http.StatusCreated)
+}
+
+// HEAD /api/uploads/:id
+// tells how much of an upload has been received
+func (a *Api) HeadUpload(c echo.Context) error {
+	if status, err := a.tusCheck(c); status != 0 {
+		return a.tusFail(c, status, err)
+	}
+
+	u, err := a.Uploads.Get(c.Param("id"))
+	if err != nil {
+		return a.tusFail(c, tusStatus(err), err)
+	}
+
+	h := c.Response().Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	h.Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	if len(u.Metadata) > 0 {
+		h.Set("Upload-Metadata", tus.FormatMetadata(u.Metadata))
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// PATCH /api/uploads/:id
+// appends a chunk to an upload, the upload is stored to be imported once
+// it's complete. That happens after responding, GET /api/uploads/:id tells
+// when it's done.
+func (a *Api) PatchUpload(c echo.Context) error {
+	if status, err := a.tusCheck(c); status != 0 {
+		return a.tusFail(c, status, err)
+	}
+
+	req := c.Request()
+	if req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return a.tusFail(c, http.StatusUnsupportedMediaType, nil)
+	}
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return a.tusFail(c, http.StatusBadRequest, err)
+	}
+
+	id := c.Param("id")
+	u, completed, err := a.Uploads.Write(id, offset, req.Body)
+	if err != nil {
+		logutils.Log.Error("Could not write upload", id, err)
+		return a.tusFail(c, tusStatus(err), err)
+	}
+
+	h := c.Response().Header()
+	h.Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	h.Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+
+	if completed {
+		// the upload stays locked until it's stored, GET tells how it went
+		go a.finishUpload(u)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// finishUpload stores a complete upload to be imported and records the
+// outcome on it
+func (a *Api) finishUpload(u *tus.Upload) {
+	path, job, _, err := a.storeUpload(a.Uploads.DataPath(u.ID), uploadName(u))
+	if err != nil {
+		logutils.Log.Error("Could not store upload", u.ID, err)
+	}
+	var jobID int64
+	if job != nil {
+		jobID = job.ID
+	}
+	if ferr := a.Uploads.Finish(u.ID, path, jobID, err); ferr != nil {
+		logutils.Log.Error("Could not finish upload", u.ID, ferr)
+	}
+}
+
+// DELETE /api/uploads/:id
+// abandons an upload
+func (a *Api) DeleteUpload(c echo.Context) error {
+	if status, err := a.tusCheck(c); status != 0 {
+		return a.tusFail(c, status, err)
+	}
+
+	err := a.Uploads.Terminate(c.Param("id"))
+	if err != nil {
+		return a.tusFail(c, tusStatus(err), err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GET /api/uploads/:id
+// returns the state of an upload, once complete it holds the path it was
+// stored at and the import job importing it or why it wasn't
+func (a *Api) GetUpload(c echo.Context) error {
+	if a.Uploads == nil {
+		return c.JSON(http.StatusServiceUnavailable, Responce{
+			Err: errUploadsDisabled,
+		})
+	}
+
+	u, err := a.Uploads.Get(c.Param("id"))
+	if err != nil {
+		return c.JSON(tusStatus(err), Responce{
+			Err: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Responce{
+		Data: H{
+			"upload": u,
+		},
+	})
+}
+
+// uploadName is the file name an upload is stored under, taken from it's
+// metadata
+func uploadName(u *tus.Upload) string {
+	for _, key := range []string{"filename", "name"} {
+		if name := u.Metadata[key]; name != "" {
+			return name
+		}
+	}
+	return "upload"
+}
@@ -18,6 +18,9 @@ import (
 	"github.com/ryex/go-broadcaster/cmd/gobcast-web/api"
 	"github.com/ryex/go-broadcaster/internal/config"
 	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/tags"
+	"github.com/ryex/go-broadcaster/internal/tus"
 	//"github.com/ryex/go-broadcaster/internal/models"
 	distfs "github.com/ryex/go-broadcaster/cmd/gobcast-web/client"
 )
@@ -226,6 +229,11 @@ func main() {
 		logutils.Log.Errorf("Error loading database settings from URI: %s", err)
 	}
 
+	// the default of everything splitting tags, set before anything runs
+	if len(cfg.TagSeparators) > 0 {
+		tags.Separators = cfg.TagSeparators
+	}
+
 	db := pg.Connect(&pg.Options{
 		Addr:     cfg.DBHost + ":" + strconv.Itoa(cfg.DBPort),
 		Database: cfg.DBName,
@@ -244,6 +252,21 @@ func main() {
 		DB:          db,
 		AuthTimeout: cfg.AuthTimeout.Duration,
 		Cfg:         cfg,
+		Storage:     storage.NewResolver(cfg),
+	}
+
+	if cfg.UploadDir != "" {
+		maxSize := cfg.UploadMaxSize
+		if maxSize <= 0 {
+			maxSize = api.DefaultUploadMaxSize
+		}
+		store, serr := tus.NewStore(cfg.DataPath("tus"), cfg.UploadExpiry.Duration, maxSize)
+		if serr != nil {
+			logutils.Log.Errorf("Error creating upload store, resumable uploads are disabled: %s", serr)
+		} else {
+			a.Uploads = store
+			go expireUploads(store)
+		}
 	}
 
 	e := echo.New()
@@ -270,6 +293,24 @@ func main() {
 
 }
 
+// expireUploads removes expired partial uploads from the store every so
+// often
+func expireUploads(store *tus.Store) {
+	interval := store.Expiry / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		count, err := store.Expire()
+		if err != nil {
+			logutils.Log.Errorf("Error expiring uploads: %s", err)
+		}
+		if count > 0 {
+			logutils.Log.Infof("Removed %d expired uploads", count)
+		}
+	}
+}
+
 func usage() {
 	fmt.Print(usageText)
 	flag.PrintDefaults()
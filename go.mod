@@ -1,26 +1,58 @@
 module github.com/ryex/go-broadcaster
 
+go 1.27.1
+
 require (
+	github.com/cespare/xxhash v1.1.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/dhowden/tag v0.0.0-20190519100835-db0c67e351b1
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-pg/migrations v6.6.3+incompatible
 	github.com/go-pg/pg v7.1.0+incompatible
+	github.com/hajimehoshi/go-mp3 v0.2.0
+	github.com/jfreymuth/oggvorbis v1.0.1
+	github.com/labstack/echo v0.0.0-20181123063703-c7eb8da9ec73
+	github.com/mewkiz/flac v1.0.5
+	github.com/op/go-logging v0.0.0-20160211212156-b2cb9fa56473
+	github.com/wtolson/go-taglib v0.0.0-20180718000046-586eb63c2628
+	golang.org/x/crypto v0.0.0-20190103213133-ff983b9c42bc
+	golang.org/x/image v0.0.0-20190227222117-0694c2d4d067
+	golang.org/x/text v0.3.0
+	golang.org/x/tools v0.0.0-20190118193359-16909d206f00
+)
+
+require (
+	github.com/OneOfOne/xxhash v1.2.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/gopherjs/gopherjs v0.0.0-20180628210949-0892b62f0d9f // indirect
+	github.com/gopherjs/gopherwasm v0.1.1 // indirect
+	github.com/hajimehoshi/oto v0.1.1 // indirect
+	github.com/hpcloud/tail v1.0.0 // indirect
+	github.com/jfreymuth/vorbis v1.0.0 // indirect
 	github.com/jinzhu/inflection v0.0.0-20180308033659-04140366298a // indirect
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/labstack/echo v0.0.0-20181123063703-c7eb8da9ec73
+	github.com/kr/pty v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
 	github.com/labstack/gommon v0.2.8 // indirect
+	github.com/mattn/go-colorable v0.0.9 // indirect
+	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/onsi/ginkgo v1.7.0 // indirect
 	github.com/onsi/gomega v1.4.3 // indirect
-	github.com/op/go-logging v0.0.0-20160211212156-b2cb9fa56473
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/shurcooL/httpfs v0.0.0-20181222201310-74dc9339e414 // indirect
 	github.com/shurcooL/vfsgen v0.0.0-20181202132449-6a9ea43bcacd // indirect
+	github.com/spaolacci/murmur3 v0.0.0-20180118202830-f09979ecbc72 // indirect
+	github.com/stretchr/objx v0.1.0 // indirect
 	github.com/stretchr/testify v1.3.0 // indirect
-	github.com/wtolson/go-taglib v0.0.0-20180718000046-586eb63c2628
-	golang.org/x/crypto v0.0.0-20190103213133-ff983b9c42bc
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v0.0.0-20170224212429-dcecefd839c4 // indirect
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3 // indirect
 	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4 // indirect
 	golang.org/x/sys v0.0.0-20190116161447-11f53e031339 // indirect
-	golang.org/x/tools v0.0.0-20190118193359-16909d206f00
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
 	mellium.im/sasl v0.2.1 // indirect
 )
@@ -0,0 +1,207 @@
+// Package artwork finds the cover art of media files and makes thumbnails
+// of it.
+//
+// Art embedded in the file (ID3v2 APIC frames, FLAC and Vorbis
+// METADATA_BLOCK_PICTURE blocks and MP4 covr atoms) is preferred, otherwise
+// a cover image in the directory of the file like folder.jpg is used.
+package artwork
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// decoders for the image formats accepted as artwork
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/dhowden/tag"
+)
+
+// FolderNames are the names, without extension, of cover images looked for
+// in the directory of a file, in order of preference
+var FolderNames = []string{"cover", "folder", "front", "album"}
+
+// FolderExts are the extensions of cover images looked for
+var FolderExts = []string{".jpg", ".jpeg", ".png"}
+
+// MaxSize is the largest image accepted as artwork
+const MaxSize = 16 << 20
+
+// Image is a piece of artwork
+type Image struct {
+	Data   []byte
+	MIME   string
+	Width  int
+	Height int
+	// Hash is the hex SHA-256 of Data
+	Hash string
+}
+
+// Ext is the file extension for the format of the image
+func (img *Image) Ext() string {
+	switch img.MIME {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	}
+	return ".jpg"
+}
+
+// NewImage checks data is a supported image and reads it's format and size
+func NewImage(data []byte) (*Image, error) {
+	if len(data) > MaxSize {
+		return nil, errors.New("image too large")
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &Image{
+		Data:   data,
+		MIME:   "image/" + format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Hash:   hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// Find returns the artwork for the media file at path, embedded or from
+// it's directory. It returns nil without an error if there is none.
+func Find(path string) (*Image, error) {
+	img, err := Embedded(path)
+	if err != nil {
+		return nil, err
+	}
+	if img != nil {
+		return img, nil
+	}
+	return InFolder(filepath.Dir(path))
+}
+
+// Embedded returns the picture embedded in the tags of the file at path,
+// or nil if it has none that can be read
+func Embedded(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := readTags(f)
+	if err != nil {
+		// files without tags have no artwork
+		return nil, nil
+	}
+
+	data := embeddedData(m)
+	if data == nil {
+		return nil, nil
+	}
+	img, err := NewImage(data)
+	if err != nil {
+		// a broken picture is the same as none
+		return nil, nil
+	}
+	return img, nil
+}
+
+// readTags reads the tags of f, the tag library panics on some malformed
+// frames and those are returned as an error
+func readTags(f io.ReadSeeker) (m tag.Metadata, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, fmt.Errorf("malformed tags: %v", r)
+		}
+	}()
+	return tag.ReadFrom(f)
+}
+
+func embeddedData(m tag.Metadata) []byte {
+	if p := m.Picture(); p != nil && len(p.Data) > 0 {
+		return p.Data
+	}
+	// pictures in Ogg files are base64 encoded into the Vorbis comments
+	if block, ok := m.Raw()["metadata_block_picture"].(string); ok {
+		raw, err := base64.StdEncoding.DecodeString(block)
+		if err != nil {
+			return nil
+		}
+		return pictureBlockData(raw)
+	}
+	return nil
+}
+
+// pictureBlockData pulls the picture data out of a FLAC picture block, or
+// returns nil if the block is cut short. Lengths are added up unsigned so
+// bogus ones can't wrap around.
+func pictureBlockData(b []byte) []byte {
+	size := uint64(len(b))
+	// picture type, then the mime type and description each prefixed with
+	// their length
+	pos := uint64(4)
+	for i := 0; i < 2; i++ {
+		if size < pos+4 {
+			return nil
+		}
+		pos += 4 + uint64(binary.BigEndian.Uint32(b[pos:]))
+	}
+	// width, height, colour depth and colour count
+	pos += 16
+	if size < pos+4 {
+		return nil
+	}
+	n := uint64(binary.BigEndian.Uint32(b[pos:]))
+	pos += 4
+	if size < pos+n {
+		return nil
+	}
+	return b[pos : pos+n]
+}
+
+// InFolder returns the first cover image found in dir, or nil if there is
+// none. Names are matched case-insensitively.
+func InFolder(dir string) (*Image, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]os.FileInfo)
+	for _, e := range entries {
+		if e.Mode().IsRegular() {
+			files[strings.ToLower(e.Name())] = e
+		}
+	}
+
+	for _, name := range FolderNames {
+		for _, ext := range FolderExts {
+			info, ok := files[name+ext]
+			if !ok || info.Size() > MaxSize {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+			if err != nil {
+				return nil, err
+			}
+			img, err := NewImage(data)
+			if err != nil {
+				continue
+			}
+			return img, nil
+		}
+	}
+	return nil, nil
+}
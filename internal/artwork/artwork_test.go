@@ -0,0 +1,212 @@
+package artwork
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+// pngData encodes a width by height PNG
+func pngData(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pictureBlock builds a FLAC picture block holding data
+func pictureBlock(mime, desc string, data []byte) []byte {
+	var buf bytes.Buffer
+	put := func(v uint32) {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	put(3) // front cover
+	put(uint32(len(mime)))
+	buf.WriteString(mime)
+	put(uint32(len(desc)))
+	buf.WriteString(desc)
+	put(1)
+	put(1)
+	put(24)
+	put(0)
+	put(uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestPictureBlockData(t *testing.T) {
+	data := []byte("not really an image")
+	block := pictureBlock("image/png", "Cover", data)
+	if got := pictureBlockData(block); !bytes.Equal(got, data) {
+		t.Errorf("got %q, want %q", got, data)
+	}
+
+	// every cut short block is refused
+	for n := 0; n < len(block); n++ {
+		if got := pictureBlockData(block[:n]); got != nil {
+			t.Errorf("block cut to %d bytes gave %q", n, got)
+		}
+	}
+
+	// lengths running past the end, or far enough to wrap around
+	for _, at := range []int{4, 4 + 4 + len("image/png"), len(block) - len(data) - 4} {
+		for _, length := range []uint32{uint32(len(block)), 0x7fffffff, 0xffffffff} {
+			bad := append([]byte(nil), block...)
+			binary.BigEndian.PutUint32(bad[at:], length)
+			if got := pictureBlockData(bad); got != nil {
+				t.Errorf("length %#x at %d gave %q", length, at, got)
+			}
+		}
+	}
+}
+
+// vorbisMetadata is tag metadata with only Vorbis comments
+type vorbisMetadata struct {
+	tag.Metadata
+	raw map[string]interface{}
+}
+
+func (m vorbisMetadata) Picture() *tag.Picture {
+	return nil
+}
+
+func (m vorbisMetadata) Raw() map[string]interface{} {
+	return m.raw
+}
+
+func TestEmbeddedDataVorbis(t *testing.T) {
+	data := pngData(t, 2, 2)
+	block := pictureBlock("image/png", "", data)
+
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		want []byte
+	}{
+		{"picture", map[string]interface{}{"metadata_block_picture": base64.StdEncoding.EncodeToString(block)}, data},
+		{"none", map[string]interface{}{"title": "x"}, nil},
+		{"not base64", map[string]interface{}{"metadata_block_picture": "%%%"}, nil},
+		{"truncated", map[string]interface{}{"metadata_block_picture": base64.StdEncoding.EncodeToString(block[:20])}, nil},
+	}
+	for _, test := range tests {
+		got := embeddedData(vorbisMetadata{raw: test.raw})
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got %d bytes, want %d", test.name, len(got), len(test.want))
+		}
+	}
+}
+
+// id3Tag builds an ID3v2.3 tag with a single APIC frame holding frame
+func id3Tag(frame []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("APIC")
+	binary.Write(&buf, binary.BigEndian, uint32(len(frame)))
+	buf.Write([]byte{0, 0})
+	buf.Write(frame)
+	body := buf.Bytes()
+
+	// the tag size is synchsafe
+	n := len(body)
+	head := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(head, body...)
+}
+
+func TestEmbeddedID3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-artwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := pngData(t, 3, 2)
+	apic := append([]byte("\x00image/png\x00\x03Cover\x00"), data...)
+	tests := []struct {
+		name  string
+		frame []byte
+		want  bool
+	}{
+		{"picture", apic, true},
+		{"not an image", []byte("\x00image/png\x00\x03Cover\x00garbage"), false},
+		{"cut short", []byte("\x00image/p"), false},
+		{"empty", []byte{}, false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name+".mp3")
+		content := append(id3Tag(test.frame), make([]byte, 128)...)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		img, err := Embedded(path)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if (img != nil) != test.want {
+			t.Errorf("%s: got image %v, want one %v", test.name, img != nil, test.want)
+			continue
+		}
+		if img != nil && (img.Width != 3 || img.Height != 2 || img.MIME != "image/png") {
+			t.Errorf("%s: read as %s %dx%d", test.name, img.MIME, img.Width, img.Height)
+		}
+	}
+}
+
+func TestInFolder(t *testing.T) {
+	small, large := pngData(t, 1, 1), pngData(t, 4, 4)
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		// want is the width of the image found, 0 for none
+		want int
+	}{
+		{"empty", nil, 0},
+		{"no cover", map[string][]byte{"notes.jpg": large}, 0},
+		{"name order", map[string][]byte{"folder.png": small, "cover.png": large}, 4},
+		{"ext order", map[string][]byte{"front.png": small, "front.jpg": large}, 4},
+		{"any case", map[string][]byte{"Album.PNG": large}, 4},
+		{"broken skipped", map[string][]byte{"cover.jpg": []byte("not an image"), "folder.png": large}, 4},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "gobcast-artwork")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range test.files {
+			if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		img, err := InFolder(dir)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := 0
+		if img != nil {
+			got = img.Width
+		}
+		if got != test.want {
+			t.Errorf("%s: found image %d wide, want %d", test.name, got, test.want)
+		}
+	}
+
+	if _, err := InFolder(filepath.Join(os.TempDir(), "gobcast-no-such-dir")); err == nil {
+		t.Error("missing directory gave no error")
+	}
+}
@@ -0,0 +1,57 @@
+package artwork
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSizes are the sizes thumbnails are made at, limiting them keeps
+// the number of cached thumbnails per image down
+var ThumbnailSizes = []int{64, 128, 256, 512, 1024}
+
+// thumbnailQuality is the JPEG quality of thumbnails
+const thumbnailQuality = 85
+
+// ThumbnailSize rounds a requested size up to one of the ThumbnailSizes
+func ThumbnailSize(requested int) int {
+	for _, size := range ThumbnailSizes {
+		if size >= requested {
+			return size
+		}
+	}
+	return ThumbnailSizes[len(ThumbnailSizes)-1]
+}
+
+// Thumbnail decodes the image in r and writes it to w as a JPEG scaled down
+// to fit in a size by size square. Smaller images are not scaled up.
+func Thumbnail(w io.Writer, r io.Reader, size int) error {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > size || height > size {
+		if width >= height {
+			height = height * size / width
+			width = size
+		} else {
+			width = width * size / height
+			height = size
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return jpeg.Encode(w, dst, &jpeg.Options{Quality: thumbnailQuality})
+}
@@ -0,0 +1,59 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestThumbnailSize(t *testing.T) {
+	tests := []struct {
+		requested, want int
+	}{
+		{0, 64},
+		{64, 64},
+		{65, 128},
+		{300, 512},
+		{1024, 1024},
+		{5000, 1024},
+	}
+	for _, test := range tests {
+		if got := ThumbnailSize(test.requested); got != test.want {
+			t.Errorf("ThumbnailSize(%d) = %d, want %d", test.requested, got, test.want)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		width, height, size int
+		wantW, wantH        int
+	}{
+		{400, 200, 128, 128, 64},
+		{100, 300, 64, 21, 64},
+		{256, 256, 64, 64, 64},
+		// smaller images are not scaled up
+		{50, 30, 256, 50, 30},
+		// very thin images keep a pixel
+		{1000, 2, 64, 64, 1},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := Thumbnail(&buf, bytes.NewReader(pngData(t, test.width, test.height)), test.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, format, err := image.DecodeConfig(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "jpeg" || cfg.Width != test.wantW || cfg.Height != test.wantH {
+			t.Errorf("%dx%d at %d gave %s %dx%d, want jpeg %dx%d", test.width, test.height, test.size,
+				format, cfg.Width, cfg.Height, test.wantW, test.wantH)
+		}
+	}
+
+	if err := Thumbnail(new(bytes.Buffer), bytes.NewReader([]byte("not an image")), 64); err == nil {
+		t.Error("thumbnail made of a non image")
+	}
+}
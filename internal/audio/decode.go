@@ -0,0 +1,161 @@
+// Package audio decodes audio files and analyses their samples.
+//
+// The decoders are pure Go so the analysis doesn't depend on any system
+// libraries. A file is decoded once and it's samples are handed to every
+// Analyzer that needs them.
+package audio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrUnsupported is returned when there is no decoder for a file
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// blockFrames is the number of frames decoded at a time
+const blockFrames = 4096
+
+// Stream is a decoded audio stream
+type Stream interface {
+	SampleRate() int
+	Channels() int
+	// Read fills buf with interleaved samples in the range [-1, 1] and
+	// returns the number of samples read, always a whole number of frames.
+	// It returns io.EOF once the stream is exhausted.
+	Read(buf []float64) (int, error)
+	Close() error
+}
+
+type openFunc func(f *os.File) (Stream, error)
+
+// decoders are the decoders by the format they decode
+var decoders = map[Format]openFunc{
+	{ContainerMPEG, CodecMP3}:   openMP3,
+	{ContainerFLAC, CodecFLAC}:  openFLAC,
+	{ContainerWAV, CodecPCM}:    openWAV,
+	{ContainerWAV, CodecFloat}:  openWAV,
+	{ContainerOgg, CodecVorbis}: openVorbis,
+}
+
+// CanDecode tests if there is a decoder for files of format f
+func CanDecode(f Format) bool {
+	_, ok := decoders[f]
+	return ok
+}
+
+// Open opens the file at path for decoding, the decoder is chosen by the
+// format sniffed from the content of the file
+func Open(path string) (Stream, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := Sniff(f)
+	if err == ErrUnknownFormat {
+		err = ErrUnsupported
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	open, ok := decoders[format]
+	if !ok {
+		f.Close()
+		return nil, ErrUnsupported
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s, err := open(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks the file at path is audio in a supported format, formats
+// with a decoder must decode. It returns the format of the file.
+func Validate(path string) (Format, error) {
+	f, err := SniffFile(path)
+	if err == ErrUnknownFormat {
+		return f, ErrUnsupported
+	}
+	if err != nil {
+		return f, err
+	}
+	if !f.Supported() {
+		return f, ErrUnsupported
+	}
+	if !CanDecode(f) {
+		return f, nil
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		return f, err
+	}
+	defer s.Close()
+	if s.SampleRate() <= 0 || s.Channels() <= 0 {
+		return f, errors.New("invalid stream format")
+	}
+	buf := make([]float64, blockFrames*s.Channels())
+	n, err := s.Read(buf)
+	if n == 0 && err == io.EOF {
+		return f, errors.New("no audio in stream")
+	}
+	if err != nil && err != io.EOF {
+		return f, err
+	}
+	return f, nil
+}
+
+// Analyzer consumes the samples of a stream
+type Analyzer interface {
+	// Start is called once with the format of the stream before any
+	// samples are written
+	Start(sampleRate, channels int)
+	// Write is called with each block of interleaved samples
+	Write(samples []float64)
+}
+
+// Analyze decodes the file at path once, writing it's samples to each of
+// the analyzers. It stops early with ctx.Err() if ctx is cancelled.
+func Analyze(ctx context.Context, path string, analyzers ...Analyzer) error {
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	rate, channels := s.SampleRate(), s.Channels()
+	if rate <= 0 || channels <= 0 {
+		return errors.New("invalid stream format")
+	}
+	for _, a := range analyzers {
+		a.Start(rate, channels)
+	}
+
+	buf := make([]float64, blockFrames*channels)
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		n, rerr := s.Read(buf)
+		if n > 0 {
+			for _, a := range analyzers {
+				a.Write(buf[:n])
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
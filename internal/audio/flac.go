@@ -0,0 +1,73 @@
+package audio
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+)
+
+// flacStream decodes FLAC files a frame at a time
+type flacStream struct {
+	f        *os.File
+	stream   *flac.Stream
+	channels int
+	scale    float64
+
+	frame *frame.Frame
+	pos   int
+}
+
+func openFLAC(f *os.File) (Stream, error) {
+	stream, err := flac.New(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	s := &flacStream{
+		f:        f,
+		stream:   stream,
+		channels: int(stream.Info.NChannels),
+		scale:    1 / float64(int64(1)<<(stream.Info.BitsPerSample-1)),
+	}
+	return s, nil
+}
+
+func (s *flacStream) SampleRate() int {
+	return int(s.stream.Info.SampleRate)
+}
+
+func (s *flacStream) Channels() int {
+	return s.channels
+}
+
+func (s *flacStream) Read(out []float64) (int, error) {
+	n := 0
+	for n+s.channels <= len(out) {
+		if s.frame == nil || s.pos >= s.frame.Subframes[0].NSamples {
+			fr, err := s.stream.ParseNext()
+			if err == io.EOF && n > 0 {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			s.frame = fr
+			s.pos = 0
+		}
+		for n+s.channels <= len(out) && s.pos < s.frame.Subframes[0].NSamples {
+			for ch := 0; ch < s.channels; ch++ {
+				out[n] = float64(s.frame.Subframes[ch].Samples[s.pos]) * s.scale
+				n++
+			}
+			s.pos++
+		}
+	}
+	return n, nil
+}
+
+func (s *flacStream) Close() error {
+	// the stream only closes files it opened itself
+	return s.f.Close()
+}
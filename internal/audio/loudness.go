@@ -0,0 +1,344 @@
+package audio
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// AbsoluteGate is the level in LUFS below which blocks are ignored,
+	// it is also reported as the loudness of silent streams
+	AbsoluteGate = -70.0
+	// relativeGate is how far below the ungated loudness blocks are
+	// dropped for the integrated loudness
+	relativeGate = -10.0
+	// rangeGate is the relative gate used for the loudness range
+	rangeGate = -20.0
+
+	// momentary blocks are 400ms and short term blocks 3s, both stepped
+	// every 100ms
+	subBlocksPerMomentary = 4
+	subBlocksPerShortTerm = 30
+
+	// truePeakTaps is the length of each phase of the oversampling filter
+	truePeakTaps = 12
+)
+
+// Loudness is the outcome of measuring a stream per EBU R128
+type Loudness struct {
+	// Integrated is the gated loudness of the whole stream in LUFS
+	Integrated float64
+	// Range is the loudness range in LU
+	Range float64
+	// TruePeak is the highest oversampled peak in dBTP
+	TruePeak float64
+}
+
+// Gain is the gain in dB that brings the loudness to target without pushing
+// the true peak above peakLimit dBTP. Silent streams get no gain.
+func (l Loudness) Gain(target, peakLimit float64) float64 {
+	if l.Integrated <= AbsoluteGate {
+		return 0
+	}
+	gain := target - l.Integrated
+	if l.TruePeak+gain > peakLimit {
+		gain = peakLimit - l.TruePeak
+	}
+	return gain
+}
+
+// biquad is a second order IIR filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the shelving and high pass filters of the BS.1770
+// K-weighting curve designed for the sample rate
+func kWeighting(rate float64) (shelf, highpass biquad) {
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highpass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return
+}
+
+// channelWeight is the weight of a channel in the loudness sum, only 5.1
+// layouts (L R C LFE Ls Rs) are weighted, the LFE is left out and the
+// surround channels boosted
+func channelWeight(channel, channels int) float64 {
+	if channels != 6 {
+		return 1
+	}
+	switch channel {
+	case 3:
+		return 0
+	case 4, 5:
+		return 1.41
+	}
+	return 1
+}
+
+// Meter measures the loudness of a stream per EBU R128 (ITU-R BS.1770-4 and
+// EBU Tech 3342), it is an Analyzer
+type Meter struct {
+	channels int
+	weights  []float64
+	shelf    []biquad
+	highpass []biquad
+
+	// the 100ms sub blocks making up the momentary and short term blocks
+	subBlockLen int
+	subPos      int
+	subSum      []float64
+	subBlocks   []float64
+
+	momentary []float64
+	shortTerm []float64
+
+	peak *truePeak
+}
+
+// NewMeter creates a Meter
+func NewMeter() *Meter {
+	return new(Meter)
+}
+
+// Start implements Analyzer
+func (m *Meter) Start(sampleRate, channels int) {
+	m.channels = channels
+	m.weights = make([]float64, channels)
+	m.shelf = make([]biquad, channels)
+	m.highpass = make([]biquad, channels)
+	for ch := 0; ch < channels; ch++ {
+		m.weights[ch] = channelWeight(ch, channels)
+		m.shelf[ch], m.highpass[ch] = kWeighting(float64(sampleRate))
+	}
+	m.subBlockLen = sampleRate / 10
+	if m.subBlockLen < 1 {
+		m.subBlockLen = 1
+	}
+	m.subPos = 0
+	m.subSum = make([]float64, channels)
+	m.subBlocks = nil
+	m.momentary = nil
+	m.shortTerm = nil
+	m.peak = newTruePeak(sampleRate, channels)
+}
+
+// Write implements Analyzer
+func (m *Meter) Write(samples []float64) {
+	m.peak.write(samples)
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			y := m.highpass[ch].process(m.shelf[ch].process(samples[i+ch]))
+			m.subSum[ch] += y * y
+		}
+		m.subPos++
+		if m.subPos == m.subBlockLen {
+			m.endSubBlock()
+		}
+	}
+}
+
+// endSubBlock stores the weighted mean square of the finished sub block and
+// the momentary and short term blocks that end with it
+func (m *Meter) endSubBlock() {
+	var z float64
+	for ch := 0; ch < m.channels; ch++ {
+		z += m.weights[ch] * m.subSum[ch] / float64(m.subBlockLen)
+		m.subSum[ch] = 0
+	}
+	m.subPos = 0
+	m.subBlocks = append(m.subBlocks, z)
+
+	n := len(m.subBlocks)
+	if n >= subBlocksPerMomentary {
+		m.momentary = append(m.momentary, mean(m.subBlocks[n-subBlocksPerMomentary:]))
+	}
+	if n >= subBlocksPerShortTerm {
+		m.shortTerm = append(m.shortTerm, mean(m.subBlocks[n-subBlocksPerShortTerm:]))
+	}
+}
+
+// Result returns the measurements of everything written so far. Levels are
+// never reported below AbsoluteGate.
+func (m *Meter) Result() Loudness {
+	l := Loudness{
+		Integrated: AbsoluteGate,
+		TruePeak:   AbsoluteGate,
+	}
+	if m.peak != nil && m.peak.max > 0 {
+		l.TruePeak = math.Max(20*math.Log10(m.peak.max), AbsoluteGate)
+	}
+
+	// integrated loudness, gated absolutely then relative to the loudness
+	// of the blocks passing the absolute gate
+	gated := gate(m.momentary, energy(AbsoluteGate))
+	if len(gated) == 0 {
+		return l
+	}
+	threshold := energy(lufs(mean(gated)) + relativeGate)
+	gated = gate(gated, threshold)
+	if len(gated) > 0 {
+		l.Integrated = math.Max(lufs(mean(gated)), AbsoluteGate)
+	}
+
+	// loudness range, the spread between the 10th and 95th percentiles of
+	// the gated short term loudness
+	gated = gate(m.shortTerm, energy(AbsoluteGate))
+	if len(gated) == 0 {
+		return l
+	}
+	threshold = energy(lufs(mean(gated)) + rangeGate)
+	gated = gate(gated, threshold)
+	if len(gated) == 0 {
+		return l
+	}
+	sort.Float64s(gated)
+	low := gated[int(math.Round(float64(len(gated)-1)*0.10))]
+	high := gated[int(math.Round(float64(len(gated)-1)*0.95))]
+	l.Range = lufs(high) - lufs(low)
+	return l
+}
+
+// lufs converts a block energy to loudness
+func lufs(z float64) float64 {
+	return -0.691 + 10*math.Log10(z)
+}
+
+// energy converts a loudness to a block energy
+func energy(l float64) float64 {
+	return math.Pow(10, (l+0.691)/10)
+}
+
+func mean(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// gate returns the energies above threshold
+func gate(blocks []float64, threshold float64) []float64 {
+	var out []float64
+	for _, z := range blocks {
+		if z > threshold {
+			out = append(out, z)
+		}
+	}
+	return out
+}
+
+// truePeak finds the peak of a stream oversampled to at least 176.4kHz
+// with a polyphase windowed sinc interpolator
+type truePeak struct {
+	channels int
+	factor   int
+	phases   [][]float64
+	history  [][]float64
+	max      float64
+}
+
+func newTruePeak(sampleRate, channels int) *truePeak {
+	factor := 1
+	for factor < 4 && sampleRate*factor < 176400 {
+		factor *= 2
+	}
+
+	tp := &truePeak{
+		channels: channels,
+		factor:   factor,
+		history:  make([][]float64, channels),
+	}
+	for ch := range tp.history {
+		tp.history[ch] = make([]float64, truePeakTaps)
+	}
+	if factor == 1 {
+		return tp
+	}
+
+	n := truePeakTaps * factor
+	center := float64(n-1) / 2
+	tp.phases = make([][]float64, factor)
+	for p := 0; p < factor; p++ {
+		phase := make([]float64, truePeakTaps)
+		var sum float64
+		for k := 0; k < truePeakTaps; k++ {
+			i := k*factor + p
+			x := (float64(i) - center) / float64(factor)
+			window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(n))
+			phase[k] = sinc(x) * window
+			sum += phase[k]
+		}
+		// each phase passes DC unchanged
+		for k := range phase {
+			phase[k] /= sum
+		}
+		tp.phases[p] = phase
+	}
+	return tp
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func (tp *truePeak) write(samples []float64) {
+	for i := 0; i+tp.channels <= len(samples); i += tp.channels {
+		for ch := 0; ch < tp.channels; ch++ {
+			x := samples[i+ch]
+			if a := math.Abs(x); a > tp.max {
+				tp.max = a
+			}
+			if tp.phases == nil {
+				continue
+			}
+			h := tp.history[ch]
+			copy(h[1:], h[:len(h)-1])
+			h[0] = x
+			for _, phase := range tp.phases {
+				var y float64
+				for k, c := range phase {
+					y += h[k] * c
+				}
+				if a := math.Abs(y); a > tp.max {
+					tp.max = a
+				}
+			}
+		}
+	}
+}
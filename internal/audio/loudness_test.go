@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sineSegment is a stretch of a stereo 1kHz sine at a level in dBFS
+type sineSegment struct {
+	level   float64
+	seconds float64
+}
+
+// writeSineWAV writes a 48kHz 16 bit stereo WAV file of the segments
+func writeSineWAV(t *testing.T, dir string, segments ...sineSegment) string {
+	const rate = 48000
+	var samples []int16
+	n := 0
+	for _, seg := range segments {
+		amp := math.Pow(10, seg.level/20)
+		for i := 0; i < int(seg.seconds*rate); i++ {
+			v := int16(math.Round(amp * 32767 * math.Sin(2*math.Pi*1000*float64(n)/rate)))
+			samples = append(samples, v, v)
+			n++
+		}
+	}
+
+	data := make([]byte, 44+len(samples)*2)
+	copy(data[0:], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(36+len(samples)*2))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], wavFormatPCM)
+	binary.LittleEndian.PutUint16(data[22:], 2)
+	binary.LittleEndian.PutUint32(data[24:], rate)
+	binary.LittleEndian.PutUint32(data[28:], rate*4)
+	binary.LittleEndian.PutUint16(data[32:], 4)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(len(samples)*2))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[44+i*2:], uint16(v))
+	}
+
+	path := filepath.Join(dir, "sine.wav")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMeter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		segments   []sineSegment
+		integrated float64
+		lra        float64
+		peak       float64
+	}{
+		// EBU Tech 3341 test 1 and EBU Tech 3342 test 1
+		{"steady", []sineSegment{{-23, 20}}, -23, 0, -23},
+		{"two levels", []sineSegment{{-20, 20}, {-30, 20}}, -22.6, 10, -20},
+		{"silence", []sineSegment{{-200, 5}}, AbsoluteGate, 0, AbsoluteGate},
+	}
+	for _, tc := range tests {
+		path := writeSineWAV(t, dir, tc.segments...)
+		m := NewMeter()
+		if err := Analyze(context.Background(), path, m); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		l := m.Result()
+		if math.Abs(l.Integrated-tc.integrated) > 0.1 {
+			t.Errorf("%s: integrated %.2f LUFS, want %.2f", tc.name, l.Integrated, tc.integrated)
+		}
+		if math.Abs(l.Range-tc.lra) > 1 {
+			t.Errorf("%s: range %.2f LU, want %.2f", tc.name, l.Range, tc.lra)
+		}
+		if math.Abs(l.TruePeak-tc.peak) > 0.2 {
+			t.Errorf("%s: true peak %.2f dBTP, want %.2f", tc.name, l.TruePeak, tc.peak)
+		}
+	}
+}
+
+func TestLoudnessGain(t *testing.T) {
+	tests := []struct {
+		l    Loudness
+		gain float64
+	}{
+		{Loudness{Integrated: -6, TruePeak: 0}, -17},
+		{Loudness{Integrated: -20, TruePeak: -10}, -3},
+		// boosting would clip so the gain stops at the peak limit
+		{Loudness{Integrated: -30, TruePeak: -3}, 2},
+		{Loudness{Integrated: AbsoluteGate, TruePeak: AbsoluteGate}, 0},
+	}
+	for _, tc := range tests {
+		if g := tc.l.Gain(-23, -1); math.Abs(g-tc.gain) > 1e-9 {
+			t.Errorf("gain of %+v is %.2f, want %.2f", tc.l, g, tc.gain)
+		}
+	}
+}
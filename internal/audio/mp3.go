@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	mp3 "github.com/hajimehoshi/go-mp3"
+)
+
+// mp3HeaderScan is how far into a file the first frame header is searched
+const mp3HeaderScan = 64 * 1024
+
+// mp3Stream decodes MP3 files. The decoder always produces 16 bit stereo,
+// mono files are turned back into a single channel so they are measured
+// the same as any other mono file.
+type mp3Stream struct {
+	f    *os.File
+	dec  *mp3.Decoder
+	mono bool
+	buf  []byte
+}
+
+func openMP3(f *os.File) (Stream, error) {
+	mono, err := mp3IsMono(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec, err := mp3.NewDecoder(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Stream{f: f, dec: dec, mono: mono}, nil
+}
+
+func (s *mp3Stream) SampleRate() int {
+	return s.dec.SampleRate()
+}
+
+func (s *mp3Stream) Channels() int {
+	if s.mono {
+		return 1
+	}
+	return 2
+}
+
+func (s *mp3Stream) Read(out []float64) (int, error) {
+	frames := len(out) / s.Channels()
+	need := frames * 4
+	if cap(s.buf) < need {
+		s.buf = make([]byte, need)
+	}
+	b := s.buf[:need]
+
+	read, err := io.ReadFull(s.dec, b)
+	frames = read / 4
+	n := 0
+	for i := 0; i < frames; i++ {
+		left := float64(int16(binary.LittleEndian.Uint16(b[i*4:]))) / 32768
+		out[n] = left
+		n++
+		if !s.mono {
+			out[n] = float64(int16(binary.LittleEndian.Uint16(b[i*4+2:]))) / 32768
+			n++
+		}
+	}
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n > 0) {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *mp3Stream) Close() error {
+	return s.f.Close()
+}
+
+// mp3IsMono reads the channel mode from the first frame header of the file
+func mp3IsMono(f *os.File) (bool, error) {
+	r := bufio.NewReader(io.LimitReader(f, mp3HeaderScan))
+
+	// skip an ID3v2 tag
+	head, err := r.Peek(10)
+	if err != nil {
+		return false, err
+	}
+	if string(head[:3]) == "ID3" {
+		size := int(head[6]&0x7f)<<21 | int(head[7]&0x7f)<<14 | int(head[8]&0x7f)<<7 | int(head[9]&0x7f)
+		size += 10
+		if head[5]&0x10 != 0 {
+			// footer present
+			size += 10
+		}
+		if _, err = f.Seek(int64(size), io.SeekStart); err != nil {
+			return false, err
+		}
+		r = bufio.NewReader(io.LimitReader(f, mp3HeaderScan))
+	}
+
+	var h [4]byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			// no header found, let the decoder report the problem
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if b != 0xff {
+			continue
+		}
+		next, err := r.Peek(3)
+		if err != nil {
+			return false, nil
+		}
+		h[0] = b
+		copy(h[1:], next)
+		if validMP3Header(h) {
+			return h[3]>>6 == 3, nil
+		}
+	}
+}
+
+// validMP3Header tests if h looks like an MPEG audio frame header
+func validMP3Header(h [4]byte) bool {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return false
+	}
+	version := (h[1] >> 3) & 0x03
+	layer := (h[1] >> 1) & 0x03
+	bitrate := h[2] >> 4
+	rate := (h[2] >> 2) & 0x03
+	return version != 1 && layer != 0 && bitrate != 0 && bitrate != 15 && rate != 3
+}
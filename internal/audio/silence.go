@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// silenceWindow is the length of the windows whose level is compared to
+// the threshold
+const silenceWindow = 10 * time.Millisecond
+
+// SilenceDetector finds the leading and trailing silence of a stream, it is
+// an Analyzer. A window is silent while the RMS level of every channel is
+// below Threshold dBFS.
+type SilenceDetector struct {
+	// Threshold is the level in dBFS below which audio counts as silence
+	Threshold float64
+	// MinDuration is the shortest leading or trailing silence that is cut,
+	// shorter gaps are left as part of the track
+	MinDuration time.Duration
+
+	rate      int
+	channels  int
+	threshold float64
+
+	windowLen int
+	pos       int
+	sums      []float64
+
+	frames    int64
+	firstLoud int64
+	lastLoud  int64
+}
+
+// Start implements Analyzer
+func (d *SilenceDetector) Start(sampleRate, channels int) {
+	d.rate = sampleRate
+	d.channels = channels
+	// compare mean squares rather than taking a root per window
+	d.threshold = math.Pow(10, d.Threshold/10)
+	d.windowLen = int(int64(sampleRate) * int64(silenceWindow) / int64(time.Second))
+	if d.windowLen < 1 {
+		d.windowLen = 1
+	}
+	d.pos = 0
+	d.sums = make([]float64, channels)
+	d.frames = 0
+	d.firstLoud = -1
+	d.lastLoud = -1
+}
+
+// Write implements Analyzer
+func (d *SilenceDetector) Write(samples []float64) {
+	for i := 0; i+d.channels <= len(samples); i += d.channels {
+		for ch := 0; ch < d.channels; ch++ {
+			x := samples[i+ch]
+			d.sums[ch] += x * x
+		}
+		d.frames++
+		d.pos++
+		if d.pos == d.windowLen {
+			d.endWindow()
+		}
+	}
+}
+
+// endWindow checks the level of the window just finished
+func (d *SilenceDetector) endWindow() {
+	loud := false
+	for ch := range d.sums {
+		if d.sums[ch]/float64(d.pos) > d.threshold {
+			loud = true
+		}
+		d.sums[ch] = 0
+	}
+	if loud {
+		if d.firstLoud < 0 {
+			d.firstLoud = d.frames - int64(d.pos)
+		}
+		d.lastLoud = d.frames
+	}
+	d.pos = 0
+}
+
+// Length is the duration of everything written
+func (d *SilenceDetector) Length() time.Duration {
+	return d.duration(d.frames)
+}
+
+// Cues returns the offsets at which the audio starts and ends once the
+// leading and trailing silence is cut. A stream that is silent throughout
+// is returned whole.
+func (d *SilenceDetector) Cues() (in, out time.Duration) {
+	if d.pos > 0 {
+		d.endWindow()
+	}
+	length := d.Length()
+	if d.firstLoud < 0 {
+		return 0, length
+	}
+	in = d.duration(d.firstLoud)
+	out = d.duration(d.lastLoud)
+	if in < d.MinDuration {
+		in = 0
+	}
+	if length-out < d.MinDuration {
+		out = length
+	}
+	return
+}
+
+func (d *SilenceDetector) duration(frames int64) time.Duration {
+	if d.rate == 0 {
+		return 0
+	}
+	return time.Duration(frames * int64(time.Second) / int64(d.rate))
+}
@@ -0,0 +1,49 @@
+package audio
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSilenceDetector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		segments []sineSegment
+		in, out  time.Duration
+	}{
+		{"padded", []sineSegment{{-200, 2}, {-20, 5}, {-200, 3}}, 2 * time.Second, 7 * time.Second},
+		{"short gaps kept", []sineSegment{{-200, 0.2}, {-20, 5}, {-200, 0.2}}, 0, 5400 * time.Millisecond},
+		{"quiet lead in", []sineSegment{{-70, 1}, {-20, 2}}, time.Second, 3 * time.Second},
+		{"silent", []sineSegment{{-200, 2}}, 0, 2 * time.Second},
+	}
+	for _, tc := range tests {
+		path := writeSineWAV(t, dir, tc.segments...)
+		d := &SilenceDetector{Threshold: -60, MinDuration: 500 * time.Millisecond}
+		if err := Analyze(context.Background(), path, d); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		in, out := d.Cues()
+		if absDuration(in-tc.in) > 20*time.Millisecond {
+			t.Errorf("%s: cue in at %s, want %s", tc.name, in, tc.in)
+		}
+		if absDuration(out-tc.out) > 20*time.Millisecond {
+			t.Errorf("%s: cue out at %s, want %s", tc.name, out, tc.out)
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
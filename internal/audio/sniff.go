@@ -0,0 +1,421 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Containers detected by Sniff
+const (
+	ContainerMPEG = "mpeg"
+	ContainerFLAC = "flac"
+	ContainerOgg  = "ogg"
+	ContainerWAV  = "wav"
+	ContainerMP4  = "mp4"
+	ContainerADTS = "adts"
+)
+
+// Codecs detected by Sniff
+const (
+	CodecMP1    = "mp1"
+	CodecMP2    = "mp2"
+	CodecMP3    = "mp3"
+	CodecFLAC   = "flac"
+	CodecVorbis = "vorbis"
+	CodecOpus   = "opus"
+	CodecSpeex  = "speex"
+	CodecPCM    = "pcm"
+	CodecFloat  = "float"
+	CodecALaw   = "alaw"
+	CodecULaw   = "ulaw"
+	CodecAAC    = "aac"
+	CodecALAC   = "alac"
+)
+
+// ErrUnknownFormat is returned by Sniff for content that isn't a known
+// media format
+var ErrUnknownFormat = errors.New("unknown media format")
+
+// sniffSize is how much of a file is looked at after any ID3v2 tag
+const sniffSize = 8 << 10
+
+// Format is the container and codec of a media file as told by it's
+// content. The codec is empty if the container is known but it's codec
+// isn't.
+type Format struct {
+	Container string
+	Codec     string
+}
+
+func (f Format) String() string {
+	if f.Codec == "" {
+		return f.Container
+	}
+	return f.Container + "/" + f.Codec
+}
+
+// Supported tests if files of the format can be imported, meaning their
+// tags can be read
+func (f Format) Supported() bool {
+	switch f.Container {
+	case ContainerMPEG, ContainerFLAC, ContainerWAV:
+		return true
+	case ContainerOgg:
+		switch f.Codec {
+		case CodecVorbis, CodecOpus, CodecFLAC, CodecSpeex:
+			return true
+		}
+	case ContainerMP4:
+		return f.Codec == CodecAAC || f.Codec == CodecALAC
+	}
+	return false
+}
+
+// Ext returns the usual file extension of the format, or "" if it has
+// none
+func (f Format) Ext() string {
+	switch f.Container {
+	case ContainerMPEG:
+		return "." + f.Codec
+	case ContainerFLAC:
+		return ".flac"
+	case ContainerOgg:
+		if f.Codec == CodecOpus {
+			return ".opus"
+		}
+		return ".ogg"
+	case ContainerWAV:
+		return ".wav"
+	case ContainerMP4:
+		return ".m4a"
+	case ContainerADTS:
+		return ".aac"
+	}
+	return ""
+}
+
+// SniffFile detects the format of the file at path, see Sniff
+func SniffFile(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Format{}, err
+	}
+	defer f.Close()
+	return Sniff(f)
+}
+
+// Sniff detects the format of a media file from the magic bytes of it's
+// container and codec, skipping any ID3v2 tag in front of them. It returns
+// ErrUnknownFormat if the content isn't recognised.
+func Sniff(r io.ReadSeeker) (Format, error) {
+	var h [10]byte
+	n, err := io.ReadFull(r, h[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return Format{}, ErrUnknownFormat
+		}
+		return Format{}, err
+	}
+	var start int64
+	if n == len(h) && string(h[:3]) == "ID3" {
+		start = int64(h[6]&0x7f)<<21 | int64(h[7]&0x7f)<<14 | int64(h[8]&0x7f)<<7 | int64(h[9]&0x7f) + 10
+		if h[5]&0x10 != 0 {
+			// footer
+			start += 10
+		}
+	}
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return Format{}, err
+	}
+	buf := make([]byte, sniffSize)
+	n, err = io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Format{}, err
+	}
+	buf = buf[:n]
+
+	switch {
+	case bytes.HasPrefix(buf, []byte("fLaC")):
+		return Format{ContainerFLAC, CodecFLAC}, nil
+	case bytes.HasPrefix(buf, []byte("OggS")):
+		return Format{ContainerOgg, oggCodec(buf)}, nil
+	case len(buf) >= 12 && string(buf[:4]) == "RIFF" && string(buf[8:12]) == "WAVE":
+		return Format{ContainerWAV, wavCodec(buf[12:])}, nil
+	case len(buf) >= 8 && string(buf[4:8]) == "ftyp":
+		return Format{ContainerMP4, mp4Codec(r, start)}, nil
+	}
+	if f, ok := sniffFrames(buf); ok {
+		return f, nil
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+// oggCodec tells the codec of an Ogg stream from the start of it's first
+// packet
+func oggCodec(page []byte) string {
+	if len(page) < 27 {
+		return ""
+	}
+	packet := page[27:]
+	if len(packet) < int(page[26]) {
+		return ""
+	}
+	packet = packet[page[26]:]
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return CodecVorbis
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return CodecOpus
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")):
+		return CodecFLAC
+	case bytes.HasPrefix(packet, []byte("Speex   ")):
+		return CodecSpeex
+	}
+	return ""
+}
+
+// wavFormats maps the format tags of WAVE fmt chunks to codecs
+var wavFormats = map[uint16]string{
+	wavFormatPCM:   CodecPCM,
+	wavFormatFloat: CodecFloat,
+	0x0006:         CodecALaw,
+	0x0007:         CodecULaw,
+	0x0050:         CodecMP2,
+	0x0055:         CodecMP3,
+}
+
+// wavCodec tells the codec of a WAVE file from it's fmt chunk, chunks holds
+// the chunks following the RIFF header
+func wavCodec(chunks []byte) string {
+	for len(chunks) >= 8 {
+		id := string(chunks[:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:]))
+		body := chunks[8:]
+		if id == "fmt " {
+			if len(body) < 2 {
+				return ""
+			}
+			tag := binary.LittleEndian.Uint16(body)
+			if tag == wavFormatExtensible && len(body) >= 26 {
+				// the sub format GUID starts with the actual format tag
+				tag = binary.LittleEndian.Uint16(body[24:])
+			}
+			return wavFormats[tag]
+		}
+		// chunks are padded to an even size
+		size += size & 1
+		if size < 0 || size > len(body) {
+			return ""
+		}
+		chunks = body[size:]
+	}
+	return ""
+}
+
+// mp4Codecs maps the sample entry types of MP4 audio tracks to codecs
+var mp4Codecs = map[string]string{
+	"mp4a": CodecAAC,
+	"alac": CodecALAC,
+	"fLaC": CodecFLAC,
+	"Opus": CodecOpus,
+}
+
+// mp4BoxPath is the path of boxes down to the sample descriptions of a
+// track
+var mp4BoxPath = []string{"mdia", "minf", "stbl", "stsd"}
+
+// mp4Codec tells the codec of the first audio track of an MP4 file by
+// walking it's boxes down to the track's sample description
+func mp4Codec(r io.ReadSeeker, start int64) string {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return ""
+	}
+	codec := ""
+	mp4Boxes(r, start, end, func(typ string, s, e int64) bool {
+		if typ != "moov" {
+			return true
+		}
+		mp4Boxes(r, s, e, func(typ string, s, e int64) bool {
+			if typ != "trak" {
+				return true
+			}
+			codec = mp4TrackCodec(r, s, e)
+			return codec == ""
+		})
+		return false
+	})
+	return codec
+}
+
+func mp4TrackCodec(r io.ReadSeeker, s, e int64) string {
+	for _, name := range mp4BoxPath {
+		found := false
+		mp4Boxes(r, s, e, func(typ string, bs, be int64) bool {
+			if typ == name {
+				s, e, found = bs, be, true
+				return false
+			}
+			return true
+		})
+		if !found {
+			return ""
+		}
+	}
+	// version and flags then the entry count before the first entry
+	var entry [16]byte
+	if e-s < int64(len(entry)) {
+		return ""
+	}
+	if _, err := r.Seek(s, io.SeekStart); err != nil {
+		return ""
+	}
+	if _, err := io.ReadFull(r, entry[:]); err != nil {
+		return ""
+	}
+	return mp4Codecs[string(entry[12:16])]
+}
+
+// mp4Boxes calls fn with the type and the body offsets of each box between
+// start and end until fn returns false
+func mp4Boxes(r io.ReadSeeker, start, end int64, fn func(typ string, start, end int64) bool) {
+	for start+8 <= end {
+		var h [16]byte
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(r, h[:8]); err != nil {
+			return
+		}
+		size := int64(binary.BigEndian.Uint32(h[:4]))
+		typ := string(h[4:8])
+		body := start + 8
+		switch size {
+		case 0:
+			size = end - start
+		case 1:
+			if _, err := io.ReadFull(r, h[8:16]); err != nil {
+				return
+			}
+			size = int64(binary.BigEndian.Uint64(h[8:16]))
+			body += 8
+		}
+		if size < body-start || start+size > end {
+			return
+		}
+		if !fn(typ, body, start+size) {
+			return
+		}
+		start += size
+	}
+}
+
+// sniffFrames looks for two consecutive MPEG audio or ADTS frames, raw
+// streams have no other magic
+func sniffFrames(buf []byte) (Format, bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		f, size, ok := frameHeader(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + size
+		if next+4 > len(buf) {
+			// too short to confirm unless the frame is right at the start
+			if i == 0 && next <= len(buf) {
+				return f, true
+			}
+			continue
+		}
+		if nf, _, ok := frameHeader(buf[next:]); ok && nf == f {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// mpegBitrates are the bitrates in kbit/s by MPEG version 1 or 2 and layer
+var mpegBitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mpegSampleRates = [3]int{44100, 48000, 32000}
+
+// frameHeader parses the header of an MPEG audio or ADTS frame, returning
+// the format and the size of the frame
+func frameHeader(b []byte) (Format, int, bool) {
+	if b[1]&0xf6 == 0xf0 {
+		if len(b) < 6 {
+			return Format{}, 0, false
+		}
+		// ADTS has a 12 bit sync word and a layer of 0
+		if b[2]>>2&0x0f > 12 {
+			return Format{}, 0, false
+		}
+		size := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+		if size < 7 {
+			return Format{}, 0, false
+		}
+		return Format{ContainerADTS, CodecAAC}, size, true
+	}
+
+	version := b[1] >> 3 & 0x03
+	layer := b[1] >> 1 & 0x03
+	bitrateIndex := b[2] >> 4
+	rateIndex := b[2] >> 2 & 0x03
+	padding := int(b[2] >> 1 & 0x01)
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return Format{}, 0, false
+	}
+
+	v := 0
+	if version != 3 {
+		// MPEG 2 and 2.5
+		v = 1
+	}
+	l := 3 - int(layer)
+	bitrate := mpegBitrates[v][l][bitrateIndex] * 1000
+	rate := mpegSampleRates[rateIndex]
+	switch version {
+	case 2:
+		rate /= 2
+	case 0:
+		rate /= 4
+	}
+
+	var size int
+	var codec string
+	switch layer {
+	case 3:
+		codec = CodecMP1
+		size = (12*bitrate/rate + padding) * 4
+	case 2:
+		codec = CodecMP2
+		size = 144*bitrate/rate + padding
+	case 1:
+		codec = CodecMP3
+		if v == 1 {
+			size = 72*bitrate/rate + padding
+		} else {
+			size = 144*bitrate/rate + padding
+		}
+	}
+	if size < 4 {
+		return Format{}, 0, false
+	}
+	return Format{ContainerMPEG, codec}, size, true
+}
@@ -0,0 +1,164 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// box builds an MP4 box
+func box(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint32(h, uint32(len(b)+8))
+	copy(h[4:], typ)
+	return append(h, b...)
+}
+
+// frames repeats an audio frame header padded to size
+func frames(header []byte, size, count int) []byte {
+	frame := make([]byte, size)
+	copy(frame, header)
+	return bytes.Repeat(frame, count)
+}
+
+func TestSniff(t *testing.T) {
+	// MPEG 1 layer III, 128kbit/s, 44.1kHz
+	mp3 := frames([]byte{0xff, 0xfb, 0x90, 0x64}, 417, 3)
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	// AAC LC, 44.1kHz, 100 byte frames
+	adts := frames([]byte{0xff, 0xf1, 0x50, 0x80, 0x0c, 0x80}, 100, 3)
+
+	ogg := func(packet string) []byte {
+		page := append([]byte("OggS"), make([]byte, 22)...)
+		page = append(page, 1, byte(len(packet)))
+		return append(page, packet...)
+	}
+
+	stsd := func(entry string) []byte {
+		return box("stsd", make([]byte, 8), box(entry, make([]byte, 28)))
+	}
+	mp4 := func(entry string) []byte {
+		return bytes.Join([][]byte{
+			box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+			box("moov",
+				box("mvhd", make([]byte, 100)),
+				box("trak",
+					box("tkhd", make([]byte, 84)),
+					box("mdia", box("minf", box("stbl", stsd(entry)))))),
+		}, nil)
+	}
+
+	wav := func(format uint16) []byte {
+		b := []byte("RIFF\x00\x00\x00\x00WAVE")
+		b = append(b, "LIST\x03\x00\x00\x00abc\x00"...)
+		b = append(b, "fmt \x10\x00\x00\x00"...)
+		fmtChunk := make([]byte, 16)
+		binary.LittleEndian.PutUint16(fmtChunk, format)
+		return append(b, fmtChunk...)
+	}
+
+	cases := []struct {
+		name      string
+		data      []byte
+		want      Format
+		supported bool
+	}{
+		{"mp3", mp3, Format{ContainerMPEG, CodecMP3}, true},
+		{"id3 mp3", append(id3, mp3...), Format{ContainerMPEG, CodecMP3}, true},
+		{"junk mp3", append([]byte("junk"), mp3...), Format{ContainerMPEG, CodecMP3}, true},
+		{"adts", adts, Format{ContainerADTS, CodecAAC}, false},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), Format{ContainerFLAC, CodecFLAC}, true},
+		{"vorbis", ogg("\x01vorbis\x00\x00\x00\x00"), Format{ContainerOgg, CodecVorbis}, true},
+		{"opus", ogg("OpusHead\x01\x02"), Format{ContainerOgg, CodecOpus}, true},
+		{"ogg flac", ogg("\x7fFLAC\x01\x00"), Format{ContainerOgg, CodecFLAC}, true},
+		{"ogg theora", ogg("\x80theora"), Format{ContainerOgg, ""}, false},
+		{"wav", wav(wavFormatPCM), Format{ContainerWAV, CodecPCM}, true},
+		{"wav mp3", wav(0x55), Format{ContainerWAV, CodecMP3}, true},
+		{"m4a", mp4("mp4a"), Format{ContainerMP4, CodecAAC}, true},
+		{"alac", mp4("alac"), Format{ContainerMP4, CodecALAC}, true},
+		{"mp4 video", mp4("avc1"), Format{ContainerMP4, ""}, false},
+	}
+	for _, c := range cases {
+		got, err := Sniff(bytes.NewReader(c.data))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: sniffed %s, want %s", c.name, got, c.want)
+		}
+		if got.Supported() != c.supported {
+			t.Errorf("%s: supported %v, want %v", c.name, got.Supported(), c.supported)
+		}
+	}
+
+	for _, data := range [][]byte{nil, []byte("just some text\n"), []byte{0xff, 0xfb, 0x90, 0x64, 1, 2, 3}} {
+		if f, err := Sniff(bytes.NewReader(data)); err != ErrUnknownFormat {
+			t.Errorf("sniffed %q as %s, %v", data, f, err)
+		}
+	}
+}
+
+func TestOpenSniffs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeSineWAV(t, dir, sineSegment{level: -20, seconds: 0.1})
+
+	f, err := SniffFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CanDecode(f) {
+		t.Fatalf("can't decode %s", f)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.SampleRate() != 48000 || s.Channels() != 2 {
+		t.Errorf("opened as %dHz %d channels", s.SampleRate(), s.Channels())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeSineWAV(t, dir, sineSegment{level: -20, seconds: 0.1})
+	if f, err := Validate(path); err != nil || f != (Format{ContainerWAV, CodecPCM}) {
+		t.Errorf("valid WAV gave %s, %v", f, err)
+	}
+
+	text := filepath.Join(dir, "notes.mp3")
+	if err = ioutil.WriteFile(text, []byte("not audio at all"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Validate(text); err != ErrUnsupported {
+		t.Errorf("text file gave %v", err)
+	}
+
+	// a WAV header with no samples
+	empty := filepath.Join(dir, "empty.wav")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(empty, data[:44], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Validate(empty); err == nil {
+		t.Error("empty WAV validated")
+	}
+}
@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// vorbisStream decodes Ogg Vorbis files
+type vorbisStream struct {
+	f   *os.File
+	r   *oggvorbis.Reader
+	buf []float32
+}
+
+func openVorbis(f *os.File) (Stream, error) {
+	r, err := oggvorbis.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisStream{f: f, r: r}, nil
+}
+
+func (s *vorbisStream) SampleRate() int {
+	return s.r.SampleRate()
+}
+
+func (s *vorbisStream) Channels() int {
+	return s.r.Channels()
+}
+
+func (s *vorbisStream) Read(out []float64) (int, error) {
+	if cap(s.buf) < len(out) {
+		s.buf = make([]float32, len(out))
+	}
+	n, err := s.r.Read(s.buf[:len(out)])
+	for i := 0; i < n; i++ {
+		out[i] = float64(s.buf[i])
+	}
+	return n, err
+}
+
+func (s *vorbisStream) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavStream decodes uncompressed integer and floating point WAV files
+type wavStream struct {
+	f        *os.File
+	r        io.Reader
+	format   int
+	channels int
+	rate     int
+	bytes    int
+	buf      []byte
+}
+
+func openWAV(f *os.File) (Stream, error) {
+	br := bufio.NewReader(f)
+
+	var riff [12]byte
+	if _, err := io.ReadFull(br, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF/WAVE file")
+	}
+
+	s := &wavStream{f: f}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(br, chunk[:]); err != nil {
+			if err == io.EOF {
+				err = errors.New("no data chunk")
+			}
+			return nil, err
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			// chunks are padded to an even size
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(br, fmtChunk); err != nil {
+				return nil, err
+			}
+			s.format = int(binary.LittleEndian.Uint16(fmtChunk[0:2]))
+			s.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			s.rate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			if s.channels > 0 {
+				// samples are stored in whole bytes, the block align
+				// covers containers wider than the bits per sample
+				s.bytes = int(binary.LittleEndian.Uint16(fmtChunk[12:14])) / s.channels
+			}
+			if s.format == wavFormatExtensible && size >= 26 {
+				// the sub format GUID starts with the real format code
+				s.format = int(binary.LittleEndian.Uint16(fmtChunk[24:26]))
+			}
+		case "data":
+			if s.channels == 0 {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			if err := s.checkFormat(); err != nil {
+				return nil, err
+			}
+			s.r = io.LimitReader(br, size)
+			return s, nil
+		default:
+			if _, err := io.CopyN(ioutil.Discard, br, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (s *wavStream) checkFormat() error {
+	switch {
+	case s.format == wavFormatPCM && s.bytes >= 1 && s.bytes <= 4:
+		return nil
+	case s.format == wavFormatFloat && (s.bytes == 4 || s.bytes == 8):
+		return nil
+	}
+	return fmt.Errorf("unsupported WAV format %d with %d bit samples", s.format, s.bytes*8)
+}
+
+func (s *wavStream) SampleRate() int {
+	return s.rate
+}
+
+func (s *wavStream) Channels() int {
+	return s.channels
+}
+
+func (s *wavStream) Read(out []float64) (int, error) {
+	frameSize := s.bytes * s.channels
+	need := len(out) / s.channels * frameSize
+	if cap(s.buf) < need {
+		s.buf = make([]byte, need)
+	}
+	b := s.buf[:need]
+
+	read, err := io.ReadFull(s.r, b)
+	n := read / frameSize * s.channels
+	for i := 0; i < n; i++ {
+		out[i] = s.sample(b[i*s.bytes:])
+	}
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n > 0) {
+		err = nil
+	}
+	return n, err
+}
+
+// sample converts the sample at the start of b
+func (s *wavStream) sample(b []byte) float64 {
+	if s.format == wavFormatFloat {
+		if s.bytes == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	switch s.bytes {
+	case 1:
+		// 8 bit samples are unsigned
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+func (s *wavStream) Close() error {
+	return s.f.Close()
+}
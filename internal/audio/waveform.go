@@ -0,0 +1,216 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// waveformVersion is the version of the audiowaveform data format
+	// written, version 2 adds the channel count to the header
+	waveformVersion = 2
+	// waveformFlag8Bit marks data stored as 8 bit values
+	waveformFlag8Bit = 1
+)
+
+// Peaks are the minimum and maximum sample values of a stream over
+// consecutive runs of samples, the data used to draw a waveform. They are
+// stored in the audiowaveform data format with 8 bit values, every channel
+// mixed into one.
+type Peaks struct {
+	SampleRate      int
+	SamplesPerPixel int
+	// Data holds a minimum and maximum pair per pixel
+	Data []int8
+}
+
+// Length is the number of pixels in the peaks
+func (p *Peaks) Length() int {
+	return len(p.Data) / 2
+}
+
+// Resample merges pixels to cover samplesPerPixel samples each, which must
+// be a multiple of the current samples per pixel
+func (p *Peaks) Resample(samplesPerPixel int) (*Peaks, error) {
+	if samplesPerPixel == p.SamplesPerPixel {
+		return p, nil
+	}
+	if samplesPerPixel < p.SamplesPerPixel || samplesPerPixel%p.SamplesPerPixel != 0 {
+		return nil, fmt.Errorf("samples per pixel must be a multiple of %d", p.SamplesPerPixel)
+	}
+	factor := samplesPerPixel / p.SamplesPerPixel
+	out := &Peaks{
+		SampleRate:      p.SampleRate,
+		SamplesPerPixel: samplesPerPixel,
+		Data:            make([]int8, 0, (p.Length()+factor-1)/factor*2),
+	}
+	for i := 0; i < p.Length(); i += factor {
+		min, max := int8(math.MaxInt8), int8(math.MinInt8)
+		for j := i; j < i+factor && j < p.Length(); j++ {
+			if p.Data[j*2] < min {
+				min = p.Data[j*2]
+			}
+			if p.Data[j*2+1] > max {
+				max = p.Data[j*2+1]
+			}
+		}
+		out.Data = append(out.Data, min, max)
+	}
+	return out, nil
+}
+
+// waveformHeader is the header of the binary audiowaveform format
+type waveformHeader struct {
+	Version         int32
+	Flags           uint32
+	SampleRate      int32
+	SamplesPerPixel int32
+	Length          uint32
+	Channels        int32
+}
+
+// WriteTo writes the peaks in the binary audiowaveform format
+func (p *Peaks) WriteTo(w io.Writer) (int64, error) {
+	h := waveformHeader{
+		Version:         waveformVersion,
+		Flags:           waveformFlag8Bit,
+		SampleRate:      int32(p.SampleRate),
+		SamplesPerPixel: int32(p.SamplesPerPixel),
+		Length:          uint32(p.Length()),
+		Channels:        1,
+	}
+	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, p.Data); err != nil {
+		return int64(binary.Size(&h)), err
+	}
+	return int64(binary.Size(&h) + len(p.Data)), nil
+}
+
+// ReadPeaks reads peaks written in the binary audiowaveform format
+func ReadPeaks(r io.Reader) (*Peaks, error) {
+	var h waveformHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Version != waveformVersion || h.Flags&waveformFlag8Bit == 0 || h.Channels != 1 {
+		return nil, errors.New("unsupported waveform data")
+	}
+	if h.SamplesPerPixel <= 0 {
+		return nil, errors.New("invalid samples per pixel")
+	}
+	p := &Peaks{
+		SampleRate:      int(h.SampleRate),
+		SamplesPerPixel: int(h.SamplesPerPixel),
+		Data:            make([]int8, h.Length*2),
+	}
+	if err := binary.Read(r, binary.LittleEndian, p.Data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarshalJSON encodes the peaks in the audiowaveform JSON format
+func (p *Peaks) MarshalJSON() ([]byte, error) {
+	// []int8 would be encoded as a list of numbers anyway but spell it out
+	// so it doesn't look like it could be base64 like []byte
+	data := make([]int, len(p.Data))
+	for i, v := range p.Data {
+		data[i] = int(v)
+	}
+	return json.Marshal(struct {
+		Version         int   `json:"version"`
+		Channels        int   `json:"channels"`
+		SampleRate      int   `json:"sample_rate"`
+		SamplesPerPixel int   `json:"samples_per_pixel"`
+		Bits            int   `json:"bits"`
+		Length          int   `json:"length"`
+		Data            []int `json:"data"`
+	}{
+		Version:         waveformVersion,
+		Channels:        1,
+		SampleRate:      p.SampleRate,
+		SamplesPerPixel: p.SamplesPerPixel,
+		Bits:            8,
+		Length:          p.Length(),
+		Data:            data,
+	})
+}
+
+// DefaultSamplesPerPixel is the resolution of a Waveform with none set, the
+// default of audiowaveform
+const DefaultSamplesPerPixel = 256
+
+// Waveform collects the Peaks of a stream, it is an Analyzer
+type Waveform struct {
+	// SamplesPerPixel is the number of frames covered by each pixel
+	SamplesPerPixel int
+
+	peaks    *Peaks
+	channels int
+	pos      int
+	min, max float64
+}
+
+// Start implements Analyzer
+func (w *Waveform) Start(sampleRate, channels int) {
+	if w.SamplesPerPixel <= 0 {
+		w.SamplesPerPixel = DefaultSamplesPerPixel
+	}
+	w.peaks = &Peaks{
+		SampleRate:      sampleRate,
+		SamplesPerPixel: w.SamplesPerPixel,
+	}
+	w.channels = channels
+	w.pos = 0
+	w.min, w.max = 0, 0
+}
+
+// Write implements Analyzer
+func (w *Waveform) Write(samples []float64) {
+	for i, x := range samples {
+		if x < w.min {
+			w.min = x
+		}
+		if x > w.max {
+			w.max = x
+		}
+		if (i+1)%w.channels != 0 {
+			continue
+		}
+		w.pos++
+		if w.pos == w.SamplesPerPixel {
+			w.endPixel()
+		}
+	}
+}
+
+func (w *Waveform) endPixel() {
+	w.peaks.Data = append(w.peaks.Data, peakValue(w.min), peakValue(w.max))
+	w.pos = 0
+	w.min, w.max = 0, 0
+}
+
+// Peaks returns the peaks of everything written
+func (w *Waveform) Peaks() *Peaks {
+	if w.pos > 0 {
+		w.endPixel()
+	}
+	return w.peaks
+}
+
+// peakValue scales a sample to 8 bits
+func peakValue(x float64) int8 {
+	v := math.Round(x * 127)
+	if v > 127 {
+		v = 127
+	} else if v < -128 {
+		v = -128
+	}
+	return int8(v)
+}
@@ -0,0 +1,65 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWaveform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// one second of silence then one of a full scale sine
+	path := writeSineWAV(t, dir, sineSegment{-200, 1}, sineSegment{0, 1})
+	w := &Waveform{SamplesPerPixel: 480}
+	if err := Analyze(context.Background(), path, w); err != nil {
+		t.Fatal(err)
+	}
+	peaks := w.Peaks()
+	if peaks.Length() != 200 {
+		t.Fatalf("got %d pixels, want 200", peaks.Length())
+	}
+	if peaks.Data[0] != 0 || peaks.Data[1] != 0 {
+		t.Errorf("silent pixel is %d to %d", peaks.Data[0], peaks.Data[1])
+	}
+	if peaks.Data[398] > -126 || peaks.Data[399] < 126 {
+		t.Errorf("full scale pixel is %d to %d", peaks.Data[398], peaks.Data[399])
+	}
+
+	var buf bytes.Buffer
+	if _, err := peaks.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPeaks(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.SampleRate != 48000 || read.SamplesPerPixel != 480 || !bytes.Equal(int8Bytes(read.Data), int8Bytes(peaks.Data)) {
+		t.Errorf("peaks changed after writing and reading them back")
+	}
+
+	zoomed, err := read.Resample(4800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zoomed.Length() != 20 {
+		t.Errorf("resampled to %d pixels, want 20", zoomed.Length())
+	}
+	if _, err = read.Resample(500); err == nil {
+		t.Error("resampling to a size that isn't a multiple should fail")
+	}
+}
+
+func int8Bytes(v []int8) []byte {
+	b := make([]byte, len(v))
+	for i := range v {
+		b[i] = byte(v[i])
+	}
+	return b
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -124,11 +125,103 @@ func (dbi *DBInfo) FillEmptyFromURI() error {
 
 type Config struct {
 	DBInfo
+	// MediaExts are the extensions of files expected to be media. Media is
+	// found by it's content, but files with these extensions whose content
+	// isn't recognised are reported as unsupported rather than skipped.
 	MediaExts   []string `json:"media_exts"`
 	Debug       bool     `json:"debug"`
 	Development bool     `json:"development"`
 	AuthSecret  string   `json:"auth_secret"`
 	AuthTimeout Duration `json:"auth_timeout"`
+	// ScanInterval is how often the media monitor rescans the library paths
+	ScanInterval Duration `json:"scan_interval"`
+	// JobPollInterval is how often the media monitor looks for scans
+	// queued through the web API
+	JobPollInterval Duration `json:"job_poll_interval"`
+	// JobRetention is how long finished import jobs are kept before the
+	// media monitor deletes them, defaults to 7 days
+	JobRetention Duration `json:"job_retention"`
+	// WatchDebounce is how long the media monitor waits for a file to
+	// settle after a change before importing it
+	WatchDebounce Duration `json:"watch_debounce"`
+	// FollowSymlinks makes library walks follow symlinked files and
+	// directories
+	FollowSymlinks bool `json:"follow_symlinks"`
+	// ImportWorkers is the number of files read in parallel during an
+	// import, defaults to the number of CPUs
+	ImportWorkers int `json:"import_workers"`
+	// ImportBatchSize is the number of tracks written to the database
+	// together during an import
+	ImportBatchSize int `json:"import_batch_size"`
+	// LoudnessTarget is the integrated loudness in LUFS tracks are leveled
+	// to, defaults to the EBU R128 target of -23 when it's not set
+	LoudnessTarget *float64 `json:"loudness_target"`
+	// TruePeakLimit is the true peak in dBTP the gain of a track may not
+	// push it above, defaults to -1 when it's not set. 0 is a valid limit.
+	TruePeakLimit *float64 `json:"true_peak_limit"`
+	// SilenceThreshold is the level in dBFS below which the start and end
+	// of a track count as silence, defaults to -60
+	SilenceThreshold float64 `json:"silence_threshold"`
+	// SilenceMinDuration is the shortest leading or trailing silence that
+	// is cued out of a track, defaults to 500ms
+	SilenceMinDuration Duration `json:"silence_min_duration"`
+	// DataDir is where generated data like waveforms is stored, it must be
+	// shared by the media monitor and the web server. Defaults to "data"
+	// in the working directory.
+	DataDir string `json:"data_dir"`
+	// UploadDir is the managed library path files uploaded through the web
+	// API are stored in, uploads are refused when it's empty
+	UploadDir string `json:"upload_dir"`
+	// UploadMaxSize is the largest file in bytes that may be uploaded,
+	// defaults to 2GiB
+	UploadMaxSize int64 `json:"upload_max_size"`
+	// UploadExpiry is how long after it was last written to an unfinished
+	// resumable upload is thrown away, defaults to 24h
+	UploadExpiry Duration `json:"upload_expiry"`
+	// OrganiseDryRun has the media monitor only log the moves organising
+	// managed library paths would make
+	OrganiseDryRun bool `json:"organise_dry_run"`
+	// DuplicateLengthTolerance is how far apart the lengths of tracks with
+	// the same artist and title may be for them to be reported as
+	// duplicates, defaults to 3s
+	DuplicateLengthTolerance Duration `json:"duplicate_length_tolerance"`
+	// TagSeparators split artist and genre tags holding several values,
+	// defaults to tags.Separators
+	TagSeparators []string `json:"tag_separators"`
+	// S3 is the object store library paths given as s3://bucket/prefix
+	// URLs are kept in
+	S3 S3Config `json:"s3"`
+	// StoragePollInterval is how often the media monitor lists library
+	// paths in an object store for changes, defaults to 1m
+	StoragePollInterval Duration `json:"storage_poll_interval"`
+	// FeedDir is the managed library path the episodes of subscribed
+	// podcast feeds are downloaded into, feeds are not polled when it's
+	// empty
+	FeedDir string `json:"feed_dir"`
+	// FeedPollInterval is how often the media monitor checks subscribed
+	// feeds for new episodes, defaults to 30m
+	FeedPollInterval Duration `json:"feed_poll_interval"`
+}
+
+// S3Config is the connection to an S3 compatible object store
+type S3Config struct {
+	// Endpoint is the URL of the store, like "http://localhost:9000"
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// DefaultDataDir is used when no data directory is configured
+const DefaultDataDir = "data"
+
+// DataPath joins elem onto the data directory
+func (c *Config) DataPath(elem ...string) string {
+	dir := c.DataDir
+	if dir == "" {
+		dir = DefaultDataDir
+	}
+	return filepath.Join(append([]string{dir}, elem...)...)
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -69,3 +69,17 @@ func TestParseURI(t *testing.T) {
 
 	//fmt.Printf("CFG: %+v\n", cfg)
 }
+
+func TestJSONToConfigLevels(t *testing.T) {
+	cfg := Config{}
+	err := json.Unmarshal([]byte(`{"true_peak_limit": 0}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TruePeakLimit == nil || *cfg.TruePeakLimit != 0 {
+		t.Errorf("true peak limit of 0 read as %v", cfg.TruePeakLimit)
+	}
+	if cfg.LoudnessTarget != nil {
+		t.Errorf("unset loudness target read as %v", *cfg.LoudnessTarget)
+	}
+}
@@ -0,0 +1,192 @@
+// Package duplicates finds tracks that are copies of each other, either the
+// same file imported twice or the same recording in different files
+package duplicates
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultLengthTolerance is how far apart the lengths of tracks with the
+// same artist and title may be for them to count as duplicates
+const DefaultLengthTolerance = 3 * time.Second
+
+// Finder searches the library for duplicate tracks
+type Finder struct {
+	DB *pg.DB
+	// LengthTolerance is how far apart the lengths of tracks matched by
+	// their metadata may be, DefaultLengthTolerance when zero
+	LengthTolerance time.Duration
+}
+
+// Find searches every available track for duplicates and stores the groups
+// found in place of those of the last search. Tracks are grouped by the
+// SHA-256 of their content, which is only worked out for local tracks whose
+// size and fast hash match another's, and by their normalised artist and title
+// with about the same length. Groups of tracks already grouped by their
+// content are not repeated for their metadata.
+func (f *Finder) Find(ctx context.Context) ([]models.DuplicateGroup, error) {
+	tq := models.TrackQuery{
+		DB: f.DB,
+	}
+	tracks, err := tq.GetAvailableTracks("id", "path", "artist", "title", "length", "size", "fast_hash", "sha256")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidates := range sameFingerprint(tracks) {
+		for _, t := range candidates {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			if herr := tq.EnsureSHA256(t); herr != nil {
+				logutils.Log.Error("could not hash track %d: %s", t.ID, herr)
+			}
+		}
+	}
+	groups := contentGroups(tracks)
+
+	tolerance := f.LengthTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultLengthTolerance
+	}
+	groups = append(groups, metadataGroups(tracks, tolerance, groups)...)
+
+	dgq := models.DuplicateGroupQuery{
+		DB: f.DB,
+	}
+	if err = dgq.ReplaceGroups(groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// sameFingerprint returns the tracks sharing their size and fast hash with
+// another track, the candidates for having the same content. Tracks in
+// object stores are left out, their content is not read to be hashed.
+func sameFingerprint(tracks []models.Track) [][]*models.Track {
+	buckets := make(map[string][]*models.Track)
+	var keys []string
+	for i := range tracks {
+		t := &tracks[i]
+		if t.FastHash == "" || storage.IsRemote(t.Path) {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", t.Size, t.FastHash)
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], t)
+	}
+	var same [][]*models.Track
+	for _, key := range keys {
+		if len(buckets[key]) > 1 {
+			same = append(same, buckets[key])
+		}
+	}
+	return same
+}
+
+// contentGroups groups the tracks with the same SHA-256
+func contentGroups(tracks []models.Track) []models.DuplicateGroup {
+	buckets := make(map[string][]int64)
+	var keys []string
+	for _, t := range tracks {
+		if t.SHA256 == "" {
+			continue
+		}
+		if _, ok := buckets[t.SHA256]; !ok {
+			keys = append(keys, t.SHA256)
+		}
+		buckets[t.SHA256] = append(buckets[t.SHA256], t.ID)
+	}
+	var groups []models.DuplicateGroup
+	for _, key := range keys {
+		if len(buckets[key]) > 1 {
+			groups = append(groups, models.DuplicateGroup{
+				Kind:     models.DuplicateContent,
+				Key:      key,
+				TrackIDs: buckets[key],
+			})
+		}
+	}
+	return groups
+}
+
+// metadataGroups groups the tracks with the same normalised artist and
+// title whose lengths are within tolerance of the next shorter one. Groups
+// whose tracks all have the same content, as grouped in content, are left
+// out.
+func metadataGroups(tracks []models.Track, tolerance time.Duration, content []models.DuplicateGroup) []models.DuplicateGroup {
+	buckets := make(map[string][]*models.Track)
+	var keys []string
+	for i := range tracks {
+		t := &tracks[i]
+		artist := utils.NormalizeName(t.Artist)
+		title := utils.NormalizeName(t.Title)
+		if artist == "" || title == "" {
+			continue
+		}
+		key := artist + " - " + title
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], t)
+	}
+
+	sameContent := make(map[int64]int)
+	for i, g := range content {
+		for _, id := range g.TrackIDs {
+			sameContent[id] = i + 1
+		}
+	}
+
+	var groups []models.DuplicateGroup
+	add := func(key string, run []*models.Track) {
+		if len(run) < 2 {
+			return
+		}
+		ids := make([]int64, len(run))
+		whole := sameContent[run[0].ID]
+		for i, t := range run {
+			ids[i] = t.ID
+			if sameContent[t.ID] != whole {
+				whole = 0
+			}
+		}
+		if whole != 0 {
+			return
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		groups = append(groups, models.DuplicateGroup{
+			Kind:     models.DuplicateMetadata,
+			Key:      key,
+			TrackIDs: ids,
+		})
+	}
+	for _, key := range keys {
+		bucket := buckets[key]
+		if len(bucket) < 2 {
+			continue
+		}
+		sort.SliceStable(bucket, func(i, j int) bool { return bucket[i].Length < bucket[j].Length })
+		start := 0
+		for i := 1; i < len(bucket); i++ {
+			if bucket[i].Length-bucket[i-1].Length > tolerance {
+				add(key, bucket[start:i])
+				start = i
+			}
+		}
+		add(key, bucket[start:])
+	}
+	return groups
+}
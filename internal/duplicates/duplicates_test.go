@@ -0,0 +1,69 @@
+package duplicates
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestSameFingerprint(t *testing.T) {
+	tracks := []models.Track{
+		{ID: 1, Size: 100, FastHash: "a"},
+		{ID: 2, Size: 100, FastHash: "a"},
+		{ID: 3, Size: 200, FastHash: "a"},
+		{ID: 4, Size: 100, FastHash: "b"},
+		{ID: 5},
+		{ID: 6},
+		// objects are not hashed
+		{ID: 7, Path: "s3://bucket/x.mp3", Size: 300, FastHash: "c"},
+		{ID: 8, Path: "s3://bucket/y.mp3", Size: 300, FastHash: "c"},
+	}
+	same := sameFingerprint(tracks)
+	if len(same) != 1 || len(same[0]) != 2 || same[0][0].ID != 1 || same[0][1].ID != 2 {
+		t.Errorf("unexpected candidates %v", same)
+	}
+}
+
+func TestContentGroups(t *testing.T) {
+	tracks := []models.Track{
+		{ID: 1, SHA256: "x"},
+		{ID: 2, SHA256: "y"},
+		{ID: 3, SHA256: "x"},
+		{ID: 4},
+		{ID: 5},
+	}
+	groups := contentGroups(tracks)
+	want := []models.DuplicateGroup{
+		{Kind: models.DuplicateContent, Key: "x", TrackIDs: []int64{1, 3}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got groups %+v, want %+v", groups, want)
+	}
+}
+
+func TestMetadataGroups(t *testing.T) {
+	s := time.Second
+	tracks := []models.Track{
+		{ID: 1, Artist: "The Beatles", Title: "Help!", Length: 140 * s},
+		{ID: 2, Artist: "Beatles, The", Title: "help!", Length: 138 * s},
+		{ID: 3, Artist: "the  beatles", Title: "Help!", Length: 300 * s},
+		{ID: 4, Artist: "Beatles", Title: "Help!", Length: 302 * s},
+		{ID: 5, Artist: "Beatles", Title: "Yesterday", Length: 125 * s},
+		{ID: 6, Artist: "", Title: "Help!", Length: 140 * s},
+		{ID: 7, Artist: "Other", Title: "Song", Length: 200 * s},
+		{ID: 8, Artist: "Other", Title: "Song", Length: 200 * s},
+	}
+	content := []models.DuplicateGroup{
+		{Kind: models.DuplicateContent, Key: "x", TrackIDs: []int64{7, 8}},
+	}
+	groups := metadataGroups(tracks, 3*s, content)
+	want := []models.DuplicateGroup{
+		{Kind: models.DuplicateMetadata, Key: "beatles - help!", TrackIDs: []int64{1, 2}},
+		{Kind: models.DuplicateMetadata, Key: "beatles - help!", TrackIDs: []int64{3, 4}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got groups %+v, want %+v", groups, want)
+	}
+}
@@ -0,0 +1,260 @@
+// Package feeds downloads the episodes of subscribed podcast feeds into the
+// library.
+//
+// A Poller fetches the RSS or Atom document of each enabled subscription,
+// records the episodes it hasn't seen before and downloads the audio
+// enclosures of the newest of them into the feed directory, a managed
+// library path. The downloads are imported as tracks tagged with the feed
+// and episode, and the tracks of episodes that fall past the retention
+// count of their feed are removed again.
+package feeds
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownFormat is returned for documents that are neither RSS nor Atom
+var ErrUnknownFormat = errors.New("not an RSS or Atom feed")
+
+// Feed is a parsed RSS or Atom feed
+type Feed struct {
+	Title  string
+	Author string
+	Link   string
+	Items  []Item
+}
+
+// Item is an entry of a feed with an audio enclosure
+type Item struct {
+	// GUID identifies the item within it's feed, items without one are
+	// identified by their enclosure
+	GUID      string
+	Title     string
+	Link      string
+	Author    string
+	Published time.Time
+	Enclosure Enclosure
+}
+
+// Enclosure is the media file of an item
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// Parse reads an RSS 2.0 or Atom feed. Items without an audio enclosure
+// are left out.
+func Parse(r io.Reader) (*Feed, error) {
+	dec := xml.NewDecoder(r)
+	// feeds often declare encodings other than UTF-8, those that are
+	// really ASCII compatible read fine as is
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, ErrUnknownFormat
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "rss":
+			var doc rssDoc
+			if err = dec.DecodeElement(&doc, &start); err != nil {
+				return nil, err
+			}
+			return doc.feed(), nil
+		case "feed":
+			var doc atomDoc
+			if err = dec.DecodeElement(&doc, &start); err != nil {
+				return nil, err
+			}
+			return doc.feed(), nil
+		}
+		return nil, ErrUnknownFormat
+	}
+}
+
+// rssDoc is the part of an RSS 2.0 document that is read, author elements
+// match those of the iTunes podcast namespace too
+type rssDoc struct {
+	Channel struct {
+		Title string `xml:"title"`
+		// atom:link elements share the name of link elements
+		Links  []string `xml:"link"`
+		Author string   `xml:"author"`
+		Items  []struct {
+			Title     string   `xml:"title"`
+			Links     []string `xml:"link"`
+			GUID      string   `xml:"guid"`
+			Author    string   `xml:"author"`
+			PubDate   string   `xml:"pubDate"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Type   string `xml:"type,attr"`
+				Length string `xml:"length,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func (doc *rssDoc) feed() *Feed {
+	ch := doc.Channel
+	f := &Feed{
+		Title:  strings.TrimSpace(ch.Title),
+		Author: strings.TrimSpace(ch.Author),
+		Link:   firstText(ch.Links),
+	}
+	for _, it := range ch.Items {
+		length, _ := strconv.ParseInt(strings.TrimSpace(it.Enclosure.Length), 10, 64)
+		f.add(Item{
+			GUID:      strings.TrimSpace(it.GUID),
+			Title:     strings.TrimSpace(it.Title),
+			Link:      firstText(it.Links),
+			Author:    strings.TrimSpace(it.Author),
+			Published: parseDate(it.PubDate),
+			Enclosure: Enclosure{
+				URL:    strings.TrimSpace(it.Enclosure.URL),
+				Type:   strings.TrimSpace(it.Enclosure.Type),
+				Length: length,
+			},
+		})
+	}
+	return f
+}
+
+// firstText returns the first of texts that isn't blank
+func firstText(texts []string) string {
+	for _, t := range texts {
+		if t = strings.TrimSpace(t); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// atomLink is a link of an Atom feed or entry
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// atomDoc is the part of an Atom document that is read
+type atomDoc struct {
+	Title  string     `xml:"title"`
+	Author string     `xml:"author>name"`
+	Links  []atomLink `xml:"link"`
+	Items  []struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Author    string     `xml:"author>name"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+		Links     []atomLink `xml:"link"`
+	} `xml:"entry"`
+}
+
+func (doc *atomDoc) feed() *Feed {
+	f := &Feed{
+		Title:  strings.TrimSpace(doc.Title),
+		Author: strings.TrimSpace(doc.Author),
+	}
+	if l := findLink(doc.Links, "alternate"); l != nil {
+		f.Link = l.Href
+	}
+	for _, e := range doc.Items {
+		it := Item{
+			GUID:   strings.TrimSpace(e.ID),
+			Title:  strings.TrimSpace(e.Title),
+			Author: strings.TrimSpace(e.Author),
+		}
+		it.Published = parseDate(e.Published)
+		if it.Published.IsZero() {
+			it.Published = parseDate(e.Updated)
+		}
+		if l := findLink(e.Links, "alternate"); l != nil {
+			it.Link = l.Href
+		}
+		if l := findLink(e.Links, "enclosure"); l != nil {
+			length, _ := strconv.ParseInt(strings.TrimSpace(l.Length), 10, 64)
+			it.Enclosure = Enclosure{
+				URL:    strings.TrimSpace(l.Href),
+				Type:   strings.TrimSpace(l.Type),
+				Length: length,
+			}
+		}
+		f.add(it)
+	}
+	return f
+}
+
+// findLink returns the first link with rel, links without one are
+// alternate links
+func findLink(links []atomLink, rel string) *atomLink {
+	for i := range links {
+		r := links[i].Rel
+		if r == rel || r == "" && rel == "alternate" {
+			return &links[i]
+		}
+	}
+	return nil
+}
+
+// add adds an item to the feed if it has an audio enclosure
+func (f *Feed) add(it Item) {
+	if it.Enclosure.URL == "" {
+		return
+	}
+	if it.Enclosure.Type != "" && !strings.HasPrefix(strings.ToLower(it.Enclosure.Type), "audio/") {
+		return
+	}
+	if it.GUID == "" {
+		it.GUID = it.Enclosure.URL
+	}
+	if it.Author == "" {
+		it.Author = f.Author
+	}
+	f.Items = append(f.Items, it)
+}
+
+// dateLayouts are the layouts feed dates are parsed with, RSS dates are
+// meant to be RFC 822 dates but often aren't quite
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseDate parses the date of a feed item, it's zero if it can't be read
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
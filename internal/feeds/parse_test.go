@@ -0,0 +1,102 @@
+package feeds
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixture reads a feed from testdata with it's enclosures on server
+func fixture(t *testing.T, name, server string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(string(data), "{{server}}", server, -1)
+}
+
+func TestParseRSS(t *testing.T) {
+	f, err := Parse(strings.NewReader(fixture(t, "show.rss", "http://media.test")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "Night Shift" || f.Author != "Community Radio" || f.Link != "https://example.com/nightshift" {
+		t.Errorf("feed parsed as %q by %q at %q", f.Title, f.Author, f.Link)
+	}
+	// items without an audio enclosure are left out
+	if len(f.Items) != 3 {
+		t.Fatalf("got %d items, want 3: %+v", len(f.Items), f.Items)
+	}
+
+	it := f.Items[0]
+	if it.GUID != "ns-3" || it.Title != "Episode 3" || it.Link != "https://example.com/nightshift/3" {
+		t.Errorf("first item parsed as %+v", it)
+	}
+	if !it.Published.Equal(time.Date(2020, 3, 3, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("first item published %s", it.Published)
+	}
+	want := Enclosure{URL: "http://media.test/media/ns-3.mp3", Type: "audio/mpeg", Length: 1024}
+	if it.Enclosure != want {
+		t.Errorf("enclosure %+v, want %+v", it.Enclosure, want)
+	}
+	if it.Author != "Community Radio" {
+		t.Errorf("item author %q, want the feed's", it.Author)
+	}
+
+	// without a guid the enclosure identifies the item
+	if f.Items[1].GUID != "http://media.test/media/ns-2.mp3" {
+		t.Errorf("second item guid %q", f.Items[1].GUID)
+	}
+	if f.Items[2].Published.Year() != 2020 || f.Items[2].Published.Day() != 18 {
+		t.Errorf("date without weekday parsed as %s", f.Items[2].Published)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	f, err := Parse(strings.NewReader(fixture(t, "show.atom", "http://media.test")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "Field Recordings" || f.Author != "Ana Ortiz" || f.Link != "https://example.com/field" {
+		t.Errorf("feed parsed as %q by %q at %q", f.Title, f.Author, f.Link)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("got %d items, want 2: %+v", len(f.Items), f.Items)
+	}
+
+	it := f.Items[0]
+	if it.GUID != "urn:example:field:2" || it.Link != "https://example.com/field/2" {
+		t.Errorf("first entry parsed as %+v", it)
+	}
+	if !it.Published.Equal(time.Date(2020, 3, 5, 5, 30, 0, 0, time.UTC)) {
+		t.Errorf("first entry published %s", it.Published)
+	}
+	if it.Enclosure.URL != "http://media.test/media/field-2.ogg" || it.Enclosure.Length != 3000 {
+		t.Errorf("first entry enclosure %+v", it.Enclosure)
+	}
+
+	// entries without a published date go by when they where updated
+	it = f.Items[1]
+	if it.Author != "Guest" || it.Link != "https://example.com/field/1" || it.Enclosure.Type != "" {
+		t.Errorf("second entry parsed as %+v", it)
+	}
+	if !it.Published.Equal(time.Date(2020, 2, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("second entry published %s", it.Published)
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, data := range []string{
+		`<?xml version="1.0"?><playlist><trackList/></playlist>`,
+		"",
+	} {
+		if _, err := Parse(strings.NewReader(data)); err != ErrUnknownFormat {
+			t.Errorf("Parse(%q) = %v, want ErrUnknownFormat", data, err)
+		}
+	}
+	if _, err := Parse(strings.NewReader("<rss><channel><title>x</rss>")); err == nil {
+		t.Error("malformed feed parsed")
+	}
+}
@@ -0,0 +1,48 @@
+package feeds
+
+import (
+	"sort"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// work is what a poll does with the episodes of a feed
+type work struct {
+	// download are the episodes to download, newest first
+	download []*models.FeedEpisode
+	// expire are the downloaded episodes whose tracks are removed
+	expire []*models.FeedEpisode
+	// skip are the episodes past the retention that where never downloaded
+	skip []*models.FeedEpisode
+}
+
+// plan works out which episodes are downloaded and which expire when the
+// newest retention episodes are kept, zero keeps all of them. Episodes
+// whose tracks where removed before are not downloaded again.
+func plan(episodes []models.FeedEpisode, retention int) work {
+	sorted := make([]*models.FeedEpisode, len(episodes))
+	for i := range episodes {
+		sorted[i] = &episodes[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.Published.Equal(b.Published) {
+			return a.Published.After(b.Published)
+		}
+		return a.ID > b.ID
+	})
+
+	var w work
+	for i, e := range sorted {
+		kept := retention <= 0 || i < retention
+		switch {
+		case kept && e.Status != models.EpisodeDownloaded && e.Status != models.EpisodeRemoved:
+			w.download = append(w.download, e)
+		case !kept && e.Status == models.EpisodeDownloaded:
+			w.expire = append(w.expire, e)
+		case !kept && (e.Status == models.EpisodePending || e.Status == models.EpisodeFailed):
+			w.skip = append(w.skip, e)
+		}
+	}
+	return w
+}
@@ -0,0 +1,73 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func guids(episodes []*models.FeedEpisode) []string {
+	var ids []string
+	for _, e := range episodes {
+		ids = append(ids, e.GUID)
+	}
+	return ids
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlan(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+	episodes := []models.FeedEpisode{
+		{ID: 1, GUID: "a", Published: day(1), Status: models.EpisodeDownloaded},
+		{ID: 2, GUID: "b", Published: day(2), Status: models.EpisodeDownloaded},
+		{ID: 3, GUID: "c", Published: day(3), Status: models.EpisodeFailed},
+		{ID: 4, GUID: "d", Published: day(5), Status: models.EpisodePending},
+		{ID: 5, GUID: "e", Published: day(4), Status: models.EpisodeRemoved},
+		{ID: 6, GUID: "f", Published: day(1), Status: models.EpisodePending},
+		// found later with the same date, so newer
+		{ID: 7, GUID: "g", Published: day(5), Status: models.EpisodeSkipped},
+	}
+
+	tests := []struct {
+		retention              int
+		download, expire, skip []string
+	}{
+		{0, []string{"g", "d", "c", "f"}, nil, nil},
+		{3, []string{"g", "d"}, []string{"b", "a"}, []string{"c", "f"}},
+		{5, []string{"g", "d", "c"}, []string{"a"}, []string{"f"}},
+		{1, []string{"g"}, []string{"b", "a"}, []string{"d", "c", "f"}},
+	}
+	for _, test := range tests {
+		w := plan(episodes, test.retention)
+		if !equal(guids(w.download), test.download) {
+			t.Errorf("retention %d downloads %v, want %v", test.retention, guids(w.download), test.download)
+		}
+		if !equal(guids(w.expire), test.expire) {
+			t.Errorf("retention %d expires %v, want %v", test.retention, guids(w.expire), test.expire)
+		}
+		if !equal(guids(w.skip), test.skip) {
+			t.Errorf("retention %d skips %v, want %v", test.retention, guids(w.skip), test.skip)
+		}
+	}
+
+	// the episodes planned for are those passed in
+	w := plan(episodes, 1)
+	w.download[0].Status = models.EpisodeDownloaded
+	if episodes[6].Status != models.EpisodeDownloaded {
+		t.Error("planned episode is a copy")
+	}
+}
@@ -0,0 +1,417 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/importer"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultPollInterval is used when no feed poll interval is configured
+const DefaultPollInterval = 30 * time.Minute
+
+// DefaultRetention is how many episodes are kept of feeds subscribed to
+// without saying
+const DefaultRetention = 10
+
+// MaxFeedSize is the largest feed document read
+const MaxFeedSize = 32 << 20
+
+// MaxEnclosureSize is the largest enclosure downloaded
+const MaxEnclosureSize = 2 << 30
+
+// ErrFeedsDisabled is returned when no feed directory is configured
+var ErrFeedsDisabled = errors.New("feeds are not configured")
+
+// ErrTooLarge is returned for enclosures larger than MaxEnclosureSize
+var ErrTooLarge = errors.New("enclosure too large")
+
+// StatusError is returned for responses other than 200 OK
+type StatusError struct {
+	URL    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.URL, e.Status, http.StatusText(e.Status))
+}
+
+// Poller downloads the new episodes of subscribed feeds
+type Poller struct {
+	DB       *pg.DB
+	Cfg      *config.Config
+	Client   *http.Client
+	Pipeline *importer.Pipeline
+}
+
+// NewPoller creates a Poller importing the episodes of feeds with the
+// settings of cfg
+func NewPoller(db *pg.DB, cfg *config.Config) *Poller {
+	return &Poller{
+		DB:       db,
+		Cfg:      cfg,
+		Client:   &http.Client{Timeout: 30 * time.Minute},
+		Pipeline: importer.NewPipeline(db, cfg),
+	}
+}
+
+// PollAll polls every enabled feed subscription, a feed that fails to poll
+// doesn't stop the others
+func (p *Poller) PollAll(ctx context.Context) error {
+	if p.Cfg.FeedDir == "" {
+		return ErrFeedsDisabled
+	}
+	fq := models.FeedQuery{
+		DB: p.DB,
+	}
+	subs, err := fq.GetEnabledFeeds()
+	if err != nil {
+		return err
+	}
+	for i := range subs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if perr := p.Poll(ctx, &subs[i]); perr != nil {
+			logutils.Log.Error("Could not poll feed", subs[i].URL, perr)
+		}
+	}
+	return nil
+}
+
+// Poll fetches the feed of sub, downloads the episodes within it's
+// retention that are not downloaded yet and removes the tracks of those
+// that fell past it. Why the poll failed is stored on sub.
+func (p *Poller) Poll(ctx context.Context, sub *models.FeedSubscription) (err error) {
+	fq := models.FeedQuery{
+		DB: p.DB,
+	}
+	defer func() {
+		sub.LastPolled = time.Now()
+		sub.LastError = ""
+		if err != nil && ctx.Err() == nil {
+			sub.LastError = err.Error()
+		}
+		if serr := fq.SavePoll(sub); err == nil {
+			err = serr
+		}
+	}()
+
+	feed, err := p.Fetch(ctx, sub)
+	if err != nil {
+		return
+	}
+	if feed != nil {
+		if feed.Title != "" {
+			sub.Title = feed.Title
+		}
+		if feed.Author != "" {
+			sub.Author = feed.Author
+		}
+		if err = fq.AddEpisodes(episodes(sub.ID, feed)); err != nil {
+			return
+		}
+	}
+
+	// episodes that failed before are retried even when the feed is the
+	// same, so the plan is made from what is stored
+	stored, err := fq.GetEpisodes(sub.ID)
+	if err != nil {
+		return
+	}
+	w := plan(stored, sub.Retention)
+	for _, e := range w.skip {
+		e.Status = models.EpisodeSkipped
+		if err = fq.UpdateEpisode(e); err != nil {
+			return
+		}
+	}
+	var failed int
+	for _, e := range w.download {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if derr := p.download(ctx, sub, e); derr != nil {
+			logutils.Log.Error("Could not download episode", e.EnclosureURL, derr)
+			e.Status = models.EpisodeFailed
+			e.Error = derr.Error()
+			failed++
+		}
+		if err = fq.UpdateEpisode(e); err != nil {
+			return
+		}
+	}
+	for _, e := range w.expire {
+		if err = p.expire(e); err != nil {
+			return
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d episodes failed to download", failed, len(w.download))
+	}
+	return
+}
+
+// episodes turns the items of feed into pending episodes of the
+// subscription with feedID
+func episodes(feedID int64, feed *Feed) []models.FeedEpisode {
+	var eps []models.FeedEpisode
+	for _, it := range feed.Items {
+		eps = append(eps, models.FeedEpisode{
+			FeedID:       feedID,
+			GUID:         it.GUID,
+			Title:        it.Title,
+			Link:         it.Link,
+			Published:    it.Published,
+			EnclosureURL: it.Enclosure.URL,
+			Status:       models.EpisodePending,
+		})
+	}
+	return eps
+}
+
+// Fetch gets and parses the feed of sub. The validators of the last
+// response are sent along and the feed is nil when it's unchanged since,
+// those of a new response are set on sub.
+func (p *Poller) Fetch(ctx context.Context, sub *models.FeedSubscription) (*Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, sub.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if sub.ETag != "" {
+		req.Header.Set("If-None-Match", sub.ETag)
+	}
+	if sub.LastModified != "" {
+		req.Header.Set("If-Modified-Since", sub.LastModified)
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: sub.URL, Status: resp.StatusCode}
+	}
+	feed, err := Parse(io.LimitReader(resp.Body, MaxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	sub.ETag = resp.Header.Get("ETag")
+	sub.LastModified = resp.Header.Get("Last-Modified")
+	return feed, nil
+}
+
+// Download writes the enclosure at enclosureURL to a temporary file in dir
+// and returns it's path
+func (p *Poller) Download(ctx context.Context, enclosureURL, dir string) (path string, err error) {
+	req, err := http.NewRequest(http.MethodGet, enclosureURL, nil)
+	if err != nil {
+		return
+	}
+	resp, err := p.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = &StatusError{URL: enclosureURL, Status: resp.StatusCode}
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(dir, "episode")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, MaxEnclosureSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > MaxEnclosureSize {
+		err = ErrTooLarge
+	}
+	return f.Name(), err
+}
+
+func (p *Poller) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+// download downloads the enclosure of e into the directory of the feed,
+// imports it and tags the track with the feed and episode. The tags are
+// edits of the track, so they are kept when it's file is imported again
+// even if they are not written to it.
+func (p *Poller) download(ctx context.Context, sub *models.FeedSubscription, e *models.FeedEpisode) error {
+	tmp, err := p.Download(ctx, e.EnclosureURL, p.Cfg.DataPath("downloads"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	format, err := audio.Validate(tmp)
+	if err != nil {
+		return err
+	}
+
+	lpq := models.LibraryPathQuery{
+		DB: p.DB,
+	}
+	lp, err := lpq.FindOrAddManaged(p.Cfg.FeedDir)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(lp.Path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(root, utils.SanitizeFileName(feedTitle(sub)))
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path, err := utils.MoveFileUnique(tmp, filepath.Join(dir, episodeFileName(e, format)))
+	if err != nil {
+		return err
+	}
+
+	ti, err := p.Pipeline.ImportFile(ctx, path)
+	if err != nil {
+		// a file that can't be imported is of no use in the library
+		os.Remove(path)
+		ieq := models.ImportErrorQuery{
+			DB: p.DB,
+		}
+		ieq.ClearPath(path)
+		return err
+	}
+	tq := models.TrackQuery{
+		DB: p.DB,
+	}
+	if _, err = tq.EditTrack(ti.Track.ID, episodeTags(sub, e)); err != nil {
+		return err
+	}
+	logutils.Log.Info("Downloaded episode", path)
+
+	e.Status = models.EpisodeDownloaded
+	e.Error = ""
+	e.TrackID = ti.Track.ID
+	e.Path = path
+	e.Downloaded = time.Now()
+	if lp.Organise {
+		ijq := models.ImportJobQuery{
+			DB: p.DB,
+		}
+		ijq.QueueJob(lp.ID)
+	}
+	return nil
+}
+
+// expire removes the track and file of an episode past the retention of
+// it's feed
+func (p *Poller) expire(e *models.FeedEpisode) error {
+	tq := models.TrackQuery{
+		DB: p.DB,
+	}
+	path := e.Path
+	if e.TrackID != 0 {
+		// the file may have been moved by organising since
+		t, err := tq.GetTrackByID(e.TrackID)
+		if err == nil {
+			path = t.Path
+		} else if err != pg.ErrNoRows {
+			return err
+		}
+		if err = tq.DeleteTrackByID(e.TrackID); err != nil {
+			return err
+		}
+	}
+	if path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logutils.Log.Error("Could not remove episode", path, err)
+		}
+	}
+	logutils.Log.Info("Removed episode", path)
+
+	e.Status = models.EpisodeRemoved
+	e.TrackID = 0
+	fq := models.FeedQuery{
+		DB: p.DB,
+	}
+	return fq.UpdateEpisode(e)
+}
+
+// feedTitle is the title of a subscription, or the host of it's feed
+// before it was first polled
+func feedTitle(sub *models.FeedSubscription) string {
+	if sub.Title != "" {
+		return sub.Title
+	}
+	if u, err := url.Parse(sub.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return strconv.FormatInt(sub.ID, 10)
+}
+
+// episodeFileName names the file of an episode by it's date and title
+func episodeFileName(e *models.FeedEpisode, format audio.Format) string {
+	name := e.Title
+	if name == "" {
+		name = "episode " + strconv.FormatInt(e.ID, 10)
+	}
+	if !e.Published.IsZero() {
+		name = e.Published.Format("2006-01-02") + " " + name
+	}
+	return utils.SanitizeFileName(name + format.Ext())
+}
+
+// episodeTags are the tags the track of an episode is given, the feed is
+// it's album and the episode link it's comment
+func episodeTags(sub *models.FeedSubscription, e *models.FeedEpisode) map[string]string {
+	tags := map[string]string{
+		"album": feedTitle(sub),
+		"genre": "Podcast",
+	}
+	if e.Title != "" {
+		tags["title"] = e.Title
+	}
+	tags["artist"] = sub.Author
+	if sub.Author == "" {
+		tags["artist"] = tags["album"]
+	}
+	if !e.Published.IsZero() {
+		tags["year"] = strconv.Itoa(e.Published.Year())
+	}
+	tags["comment"] = e.Link
+	if e.Link == "" {
+		tags["comment"] = e.GUID
+	}
+	return tags
+}
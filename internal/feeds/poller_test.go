@@ -0,0 +1,212 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// feedServer serves the fixture feeds under /feeds/ with an ETag, and the
+// bytes of media under /media/
+type feedServer struct {
+	url   string
+	media map[string][]byte
+	mu    sync.Mutex
+	// requests counts the requests for each path
+	requests map[string]int
+}
+
+func newFeedServer() (*feedServer, *httptest.Server) {
+	fs := &feedServer{
+		media:    make(map[string][]byte),
+		requests: make(map[string]int),
+	}
+	srv := httptest.NewServer(fs)
+	fs.url = srv.URL
+	return fs, srv
+}
+
+func (fs *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	fs.requests[r.URL.Path]++
+	fs.mu.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/feeds/"):
+		name := strings.TrimPrefix(r.URL.Path, "/feeds/")
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + name + `-1"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(bytes.Replace(data, []byte("{{server}}"), []byte(fs.url), -1))
+	case strings.HasPrefix(r.URL.Path, "/media/"):
+		data, ok := fs.media[strings.TrimPrefix(r.URL.Path, "/media/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	fs, srv := newFeedServer()
+	defer srv.Close()
+	p := &Poller{Client: srv.Client()}
+	ctx := context.Background()
+
+	sub := &models.FeedSubscription{URL: srv.URL + "/feeds/show.rss"}
+	feed, err := p.Fetch(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed == nil || feed.Title != "Night Shift" || len(feed.Items) != 3 {
+		t.Fatalf("fetched %+v", feed)
+	}
+	if feed.Items[0].Enclosure.URL != srv.URL+"/media/ns-3.mp3" {
+		t.Errorf("enclosure at %q", feed.Items[0].Enclosure.URL)
+	}
+	if sub.ETag != `"show.rss-1"` {
+		t.Errorf("etag %q not kept", sub.ETag)
+	}
+
+	// an unchanged feed isn't parsed again
+	feed, err = p.Fetch(ctx, sub)
+	if err != nil || feed != nil {
+		t.Errorf("unchanged feed fetched as %+v, %v", feed, err)
+	}
+	if fs.requests["/feeds/show.rss"] != 2 {
+		t.Errorf("feed requested %d times", fs.requests["/feeds/show.rss"])
+	}
+
+	sub = &models.FeedSubscription{URL: srv.URL + "/feeds/missing.rss"}
+	_, err = p.Fetch(ctx, sub)
+	if serr, ok := err.(*StatusError); !ok || serr.Status != http.StatusNotFound {
+		t.Errorf("missing feed fetched with %v", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	fs, srv := newFeedServer()
+	defer srv.Close()
+	fs.media["ns-3.mp3"] = []byte("ID3 episode three")
+	p := &Poller{Client: srv.Client()}
+
+	dir, err := ioutil.TempDir("", "gobcast-feeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	downloads := filepath.Join(dir, "downloads")
+
+	path, err := p.Download(context.Background(), srv.URL+"/media/ns-3.mp3", downloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != downloads {
+		t.Errorf("downloaded to %s, want it in %s", path, downloads)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "ID3 episode three" {
+		t.Errorf("downloaded %q, %v", data, err)
+	}
+
+	_, err = p.Download(context.Background(), srv.URL+"/media/gone.mp3", downloads)
+	if _, ok := err.(*StatusError); !ok {
+		t.Errorf("missing enclosure downloaded with %v", err)
+	}
+	files, _ := ioutil.ReadDir(downloads)
+	if len(files) != 1 {
+		t.Errorf("%d files left in downloads, want 1", len(files))
+	}
+}
+
+func TestEpisodes(t *testing.T) {
+	feed, err := Parse(strings.NewReader(fixture(t, "show.atom", "http://media.test")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps := episodes(7, feed)
+	if len(eps) != 2 {
+		t.Fatalf("got %d episodes, want 2", len(eps))
+	}
+	e := eps[0]
+	if e.FeedID != 7 || e.GUID != "urn:example:field:2" || e.Status != models.EpisodePending ||
+		e.EnclosureURL != "http://media.test/media/field-2.ogg" || e.Title != "Harbour at dawn" {
+		t.Errorf("episode made as %+v", e)
+	}
+}
+
+func TestEpisodeNaming(t *testing.T) {
+	sub := &models.FeedSubscription{URL: "https://example.com/feed.xml"}
+	e := &models.FeedEpisode{
+		ID:        3,
+		GUID:      "ns-3",
+		Title:     "Q&A: what/why?",
+		Published: time.Date(2020, 3, 3, 20, 0, 0, 0, time.UTC),
+	}
+	mp3 := audio.Format{Container: audio.ContainerMPEG, Codec: audio.CodecMP3}
+
+	if name := feedTitle(sub); name != "example.com" {
+		t.Errorf("untitled feed named %q", name)
+	}
+	name := episodeFileName(e, mp3)
+	if !strings.HasPrefix(name, "2020-03-03 Q&A") || !strings.HasSuffix(name, ".mp3") || strings.Contains(name, "/") {
+		t.Errorf("episode file named %q", name)
+	}
+	if name = episodeFileName(&models.FeedEpisode{ID: 9}, mp3); name != "episode 9.mp3" {
+		t.Errorf("untitled episode file named %q", name)
+	}
+
+	tags := episodeTags(sub, e)
+	want := map[string]string{
+		"title":   "Q&A: what/why?",
+		"album":   "example.com",
+		"artist":  "example.com",
+		"genre":   "Podcast",
+		"year":    "2020",
+		"comment": "ns-3",
+	}
+	for k, v := range want {
+		if tags[k] != v {
+			t.Errorf("tag %s = %q, want %q", k, tags[k], v)
+		}
+	}
+	sub.Title, sub.Author = "Night Shift", "Community Radio"
+	e.Link = "https://example.com/nightshift/3"
+	tags = episodeTags(sub, e)
+	if tags["album"] != "Night Shift" || tags["artist"] != "Community Radio" || tags["comment"] != e.Link {
+		t.Errorf("episode tagged %v", tags)
+	}
+
+	// only edit fields are kept when the file is imported again
+	editable := make(map[string]bool)
+	for _, col := range models.TrackEditFields {
+		editable[col] = true
+	}
+	for k := range tags {
+		if !editable[k] {
+			t.Errorf("tag %s is not an edit field", k)
+		}
+	}
+}
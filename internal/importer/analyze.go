@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+const (
+	// DefaultLoudnessTarget is the EBU R128 target level in LUFS
+	DefaultLoudnessTarget = -23.0
+	// DefaultTruePeakLimit is the highest true peak in dBTP a gain may
+	// raise a track to
+	DefaultTruePeakLimit = -1.0
+	// DefaultSilenceThreshold is the level in dBFS below which leading and
+	// trailing audio is cued out
+	DefaultSilenceThreshold = -60.0
+	// DefaultSilenceMinDuration is the shortest silence cued out
+	DefaultSilenceMinDuration = 500 * time.Millisecond
+)
+
+// analysisColumns are the track columns written by the analysis
+var analysisColumns = []string{"loudness", "loudness_range", "true_peak", "gain", "analyzed_at", "analysis_error", "waveform"}
+
+// analyze measures the loudness, detects the cue points and generates the
+// waveform of a prepared import when it's file is new or changed or it's
+// track was never measured.
+// Tracks that where already measured only have their gain recomputed in case
+// the target changed. Files that failed to be measured are not tried again
+// until they change, nor are unchanged objects in object stores as they are
+// not copied to be read.
+func (p *Pipeline) analyze(ctx context.Context, ti *models.TrackImport) {
+	t := ti.Track
+	if !audio.CanDecode(audio.Format{Container: t.Format, Codec: t.Codec}) {
+		return
+	}
+
+	full := ti.Status == models.ImportCreated || ti.Status == models.ImportUpdated
+	if !full && !t.AnalyzedAt.IsZero() {
+		gain := p.gain(audio.Loudness{
+			Integrated: t.Loudness,
+			Range:      t.LoudnessRange,
+			TruePeak:   t.TruePeak,
+		})
+		if math.Abs(gain-t.Gain) > 0.005 {
+			t.Gain = gain
+			ti.Columns = append(ti.Columns, "gain")
+		}
+		return
+	}
+	if !full && (t.AnalysisError != "" || ti.Local == "" && storage.IsRemote(t.Path)) {
+		return
+	}
+
+	meter := audio.NewMeter()
+	silence := &audio.SilenceDetector{
+		Threshold:   p.SilenceThreshold,
+		MinDuration: p.SilenceMinDuration,
+	}
+	waveform := &audio.Waveform{SamplesPerPixel: audio.DefaultSamplesPerPixel}
+	err := audio.Analyze(ctx, ti.LocalPath(), meter, silence, waveform)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		logutils.Log.Error("Could not analyse file", t.Path, err)
+		t.AnalysisError = err.Error()
+		if !full {
+			ti.Columns = append(ti.Columns, "analysis_error")
+		}
+		return
+	}
+
+	l := meter.Result()
+	t.Loudness = l.Integrated
+	t.LoudnessRange = l.Range
+	t.TruePeak = l.TruePeak
+	t.Gain = p.gain(l)
+	t.AnalyzedAt = time.Now()
+	t.AnalysisError = ""
+	if !t.CueManual {
+		t.CueIn, t.CueOut = silence.Cues()
+	}
+	t.Waveform, err = p.storeWaveform(t.FastHash, waveform.Peaks())
+	if err != nil {
+		logutils.Log.Error("Could not store waveform of", t.Path, err)
+	}
+	if !full {
+		// whole tracks are written for new and updated files
+		ti.Columns = append(ti.Columns, analysisColumns...)
+		if !t.CueManual {
+			ti.Columns = append(ti.Columns, "cue_in", "cue_out")
+		}
+	}
+}
+
+func (p *Pipeline) gain(l audio.Loudness) float64 {
+	return l.Gain(p.LoudnessTarget, p.TruePeakLimit)
+}
+
+// storeWaveform writes the peaks of a file to the data directory, named by
+// the file's hash so a moved file keeps it's waveform. It returns the path
+// of the peaks relative to the data directory.
+func (p *Pipeline) storeWaveform(hash string, peaks *audio.Peaks) (string, error) {
+	if len(hash) < 2 {
+		return "", errors.New("file has no hash")
+	}
+	rel := filepath.Join(waveformDir, hash[:2], hash+".dat")
+	err := utils.WriteFileAtomic(filepath.Join(p.DataDir, rel), 0644, func(w io.Writer) error {
+		_, err := peaks.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// waveformDir is the directory of the waveforms in the data directory
+const waveformDir = "waveforms"
+
+// pruneGrace is how long a waveform is kept before it can be pruned, it may
+// belong to an import that isn't stored yet
+const pruneGrace = time.Hour
+
+// dropWaveforms removes the waveforms replaced by stored imports, unless
+// another track with the same content still uses them
+func (p *Pipeline) dropWaveforms(imports []*models.TrackImport) {
+	tq := models.TrackQuery{
+		DB: p.DB,
+	}
+	for _, ti := range imports {
+		old := ti.OldWaveform
+		if old == "" || old == ti.Track.Waveform {
+			continue
+		}
+		used, err := tq.WaveformUsed(old)
+		if err != nil || used {
+			continue
+		}
+		if err = os.Remove(filepath.Join(p.DataDir, old)); err != nil && !os.IsNotExist(err) {
+			logutils.Log.Error("Could not remove waveform", old, err)
+		}
+	}
+}
+
+// PruneWaveforms removes the waveforms in the data directory that no track
+// uses, like those of deleted tracks. It returns how many were removed.
+func (p *Pipeline) PruneWaveforms() (int, error) {
+	tq := models.TrackQuery{
+		DB: p.DB,
+	}
+	paths, err := tq.GetWaveforms()
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		used[path] = true
+	}
+	return pruneWaveforms(p.DataDir, used, time.Now().Add(-pruneGrace))
+}
+
+// pruneWaveforms removes the files under the waveform directory of dataDir
+// that are not in used and were last written before before
+func pruneWaveforms(dataDir string, used map[string]bool, before time.Time) (count int, err error) {
+	root := filepath.Join(dataDir, waveformDir)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !info.ModTime().Before(before) {
+			return nil
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil || used[rel] {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	logutils.SetupLogging("importer-test", false, ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func TestAnalyzeFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	broken := filepath.Join(dir, "broken.wav")
+	if err = ioutil.WriteFile(broken, []byte("RIFF\x04\x00\x00\x00WAVE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.wav")
+	p := &Pipeline{DataDir: dir}
+
+	tests := []struct {
+		name    string
+		status  models.ImportStatus
+		path    string
+		failed  string
+		wantErr bool
+		columns []string
+	}{
+		// new tracks are written whole
+		{"new", models.ImportCreated, broken, "", true, nil},
+		{"never measured", models.ImportUnchanged, broken, "", true, []string{"analysis_error"}},
+		// a file that failed before isn't decoded again
+		{"failed before", models.ImportUnchanged, missing, "bad file", true, nil},
+		// nor is an object that wasn't copied to be read
+		{"object", models.ImportUnchanged, "s3://bucket/x.wav", "", false, nil},
+	}
+	for _, test := range tests {
+		ti := &models.TrackImport{
+			Track: &models.Track{
+				Path:          test.path,
+				Format:        audio.ContainerWAV,
+				Codec:         audio.CodecPCM,
+				AnalysisError: test.failed,
+			},
+			Status: test.status,
+		}
+		p.analyze(context.Background(), ti)
+		if (ti.Track.AnalysisError != "") != test.wantErr {
+			t.Errorf("%s: analysis error %q", test.name, ti.Track.AnalysisError)
+		}
+		if test.failed != "" && ti.Track.AnalysisError != test.failed {
+			t.Errorf("%s: analysed again, %q", test.name, ti.Track.AnalysisError)
+		}
+		if !reflect.DeepEqual(ti.Columns, test.columns) {
+			t.Errorf("%s: columns %v, want %v", test.name, ti.Columns, test.columns)
+		}
+		if !ti.Track.AnalyzedAt.IsZero() {
+			t.Errorf("%s: measured", test.name)
+		}
+	}
+}
+
+func TestPruneWaveforms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := time.Now().Add(-2 * pruneGrace)
+	files := []struct {
+		rel  string
+		used bool
+		old  bool
+		kept bool
+	}{
+		{filepath.Join("waveforms", "ab", "abcd.dat"), true, true, true},
+		{filepath.Join("waveforms", "ab", "abef.dat"), false, true, false},
+		// it may be the waveform of a track that's being imported
+		{filepath.Join("waveforms", "cd", "cdef.dat"), false, false, true},
+	}
+	used := make(map[string]bool)
+	for _, f := range files {
+		path := filepath.Join(dir, f.rel)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte("peaks"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if f.old {
+			if err = os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+		used[f.rel] = f.used
+	}
+
+	count, err := pruneWaveforms(dir, used, time.Now().Add(-pruneGrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("pruned %d waveforms, want 1", count)
+	}
+	for _, f := range files {
+		_, serr := os.Stat(filepath.Join(dir, f.rel))
+		if kept := serr == nil; kept != f.kept {
+			t.Errorf("%s kept %v, want %v", f.rel, kept, f.kept)
+		}
+	}
+
+	// nothing was generated yet
+	empty, err := ioutil.TempDir("", "gobcast-importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	if count, err = pruneWaveforms(empty, used, time.Now()); err != nil || count != 0 {
+		t.Errorf("pruning without waveforms: %d %v", count, err)
+	}
+}
@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/ryex/go-broadcaster/internal/artwork"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// findArtwork links a prepared import to it's cover art when it's file is
+// new or changed or it was never searched for
+func (p *Pipeline) findArtwork(ti *models.TrackImport) {
+	t := ti.Track
+	full := ti.Status == models.ImportCreated || ti.Status == models.ImportUpdated
+	if !full && t.ArtworkChecked {
+		return
+	}
+
+	img, err := artwork.Find(ti.LocalPath())
+	if err != nil {
+		logutils.Log.Error("Could not look for artwork of", t.Path, err)
+		return
+	}
+
+	t.ArtworkID = 0
+	if img != nil {
+		a, serr := p.storeArtwork(img)
+		if serr != nil {
+			logutils.Log.Error("Could not store artwork of", t.Path, serr)
+			return
+		}
+		t.ArtworkID = a.ID
+	}
+	t.ArtworkChecked = true
+	if !full {
+		ti.Columns = append(ti.Columns, "artwork_id", "artwork_checked")
+	}
+}
+
+// storeArtwork writes an image to the data directory, named by it's hash so
+// it is only stored once, and adds it to the database
+func (p *Pipeline) storeArtwork(img *artwork.Image) (*models.Artwork, error) {
+	rel := filepath.Join("artwork", img.Hash[:2], img.Hash+img.Ext())
+	path := filepath.Join(p.DataDir, rel)
+	if !utils.FileExists(path) {
+		err := utils.WriteFileAtomic(path, 0644, func(w io.Writer) error {
+			_, err := w.Write(img.Data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aq := models.ArtworkQuery{
+		DB: p.DB,
+	}
+	a := &models.Artwork{
+		Hash:   img.Hash,
+		MIME:   img.MIME,
+		Width:  img.Width,
+		Height: img.Height,
+		Size:   int64(len(img.Data)),
+		Path:   rel,
+	}
+	err := aq.AddArtwork(a)
+	return a, err
+}
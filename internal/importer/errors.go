@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// ErrNotMedia is returned for files whose content isn't media and whose
+// extension doesn't claim it is, they are passed over quietly
+var ErrNotMedia = errors.New("not a media file")
+
+// UnsupportedError is returned for media files that can't be imported,
+// either their format is known but not supported or their extension is a
+// media extension but their content isn't recognised
+type UnsupportedError struct {
+	Path string
+	// Format is zero when the content wasn't recognised
+	Format audio.Format
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Format.Container == "" {
+		return fmt.Sprintf("unrecognised media content in '%s'", e.Path)
+	}
+	return fmt.Sprintf("unsupported media format %s in '%s'", e.Format, e.Path)
+}
+
+// IsUnsupported tests if err is an UnsupportedError
+func IsUnsupported(err error) bool {
+	_, ok := err.(*UnsupportedError)
+	return ok
+}
+
+// errorClass tells the class an import error is recorded with
+func errorClass(err error) string {
+	if IsUnsupported(err) {
+		return models.ImportErrorUnsupported
+	}
+	return models.ImportErrorClass(err)
+}
+
+// recordError stores the failure to import the file at path so it can be
+// looked at and retried, imports stopped by ctx are not failures
+func (p *Pipeline) recordError(ctx context.Context, path string, err error) {
+	if ctx.Err() != nil || err == ErrNotMedia {
+		return
+	}
+	ieq := models.ImportErrorQuery{
+		DB:           p.DB,
+		LibraryPaths: p.libraryPaths,
+	}
+	if _, rerr := ieq.Record(path, errorClass(err), err); rerr != nil {
+		logutils.Log.Error("Could not record import error of", path, rerr)
+	}
+}
@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"context"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// detect sniffs the format of the file at path and checks it can be
+// imported
+func (p *Pipeline) detect(path string) (audio.Format, error) {
+	f, err := audio.SniffFile(path)
+	return p.checkFormat(path, f, err)
+}
+
+// detectObject sniffs the format of an object in a storage, only the parts
+// of it the sniffing looks at are read
+func (p *Pipeline) detectObject(ctx context.Context, st storage.Storage, key string) (audio.Format, error) {
+	file, err := st.Open(ctx, key)
+	if err != nil {
+		return audio.Format{}, err
+	}
+	defer file.Close()
+	f, err := audio.Sniff(file)
+	return p.checkFormat(st.Path(key), f, err)
+}
+
+// checkFormat turns the outcome of sniffing the file at path into the error
+// telling if it can be imported
+func (p *Pipeline) checkFormat(path string, f audio.Format, err error) (audio.Format, error) {
+	if err == audio.ErrUnknownFormat {
+		if utils.HasExtension(path, p.MediaExts) {
+			return f, &UnsupportedError{Path: path}
+		}
+		return f, ErrNotMedia
+	}
+	if err != nil {
+		return f, err
+	}
+	if !f.Supported() {
+		return f, &UnsupportedError{Path: path, Format: f}
+	}
+	return f, nil
+}
+
+// backfillFormat sniffs the file of an unchanged track imported before
+// formats where sniffed, once it's format is stored it's not sniffed again
+func (p *Pipeline) backfillFormat(ti *models.TrackImport, sniff func() (audio.Format, error)) {
+	if ti.Track.Format != "" {
+		return
+	}
+	f, err := sniff()
+	if err != nil {
+		logutils.Log.Error("Could not sniff format of", ti.Track.Path, err)
+		return
+	}
+	p.setFormat(ti, f)
+}
+
+// setFormat records the sniffed format on the track of a prepared import
+func (p *Pipeline) setFormat(ti *models.TrackImport, f audio.Format) {
+	t := ti.Track
+	if t.Format == f.Container && t.Codec == f.Codec {
+		return
+	}
+	if t.Format != "" {
+		logutils.Log.Infof("Format of '%s' changed from %s/%s to %s", t.Path, t.Format, t.Codec, f)
+	}
+	t.Format = f.Container
+	t.Codec = f.Codec
+	full := ti.Status == models.ImportCreated || ti.Status == models.ImportUpdated
+	if !full {
+		ti.Columns = append(ti.Columns, "format", "codec")
+	}
+}
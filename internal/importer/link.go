@@ -0,0 +1,27 @@
+package importer
+
+import (
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+// link points a prepared import at the artists, album and genres of it's
+// tags when it's file is new or changed or it has tags that were never
+// linked
+func (p *Pipeline) link(ti *models.TrackImport) {
+	t := ti.Track
+	full := ti.Status == models.ImportCreated || ti.Status == models.ImportUpdated
+	unlinked := (t.Artist != "" && t.ArtistID == 0) || (t.Album != "" && t.AlbumID == 0)
+	if !full && !unlinked {
+		return
+	}
+
+	err := models.LinkImport(p.DB, ti)
+	if err != nil {
+		logutils.Log.Error("Could not link artists, album and genres of", t.Path, err)
+		return
+	}
+	if !full {
+		ti.Columns = append(ti.Columns, "artist_id", "album_id")
+	}
+}
@@ -0,0 +1,486 @@
+// Package importer imports the media files of a library into the database.
+//
+// An import runs as a pipeline: a walker finds the files, a pool of workers
+// sniffs which of them are media and reads their fingerprints, tags and
+// artwork and measures their loudness, and a single writer stores the
+// resulting tracks in batches.
+//
+// Library paths in object stores are listed instead of walked, their media
+// objects are copied to the data directory to be read and the copies are
+// removed once their tracks are prepared.
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/tags"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultBatchSize is used when no import batch size is configured
+const DefaultBatchSize = 100
+
+// flushInterval is the longest a prepared track waits to be written
+const flushInterval = time.Second
+
+// Progress holds the counters of a running import. The fields are updated
+// atomically while the import runs, use Snapshot to read them.
+type Progress struct {
+	// Seen is the number of media files found, files that are not media
+	// at all are not counted
+	Seen int64
+	// Imported is the number of new or relinked tracks
+	Imported int64
+	// Updated is the number of tracks whose files changed
+	Updated int64
+	// Skipped is the number of files that where unchanged
+	Skipped int64
+	// Errored is the number of files that could not be imported
+	Errored int64
+	// Unsupported is the number of media files in formats that can't be
+	// imported
+	Unsupported int64
+}
+
+// Snapshot returns a consistent enough copy of the counters
+func (p *Progress) Snapshot() Progress {
+	return Progress{
+		Seen:     atomic.LoadInt64(&p.Seen),
+		Imported: atomic.LoadInt64(&p.Imported),
+		Updated:  atomic.LoadInt64(&p.Updated),
+		Skipped:  atomic.LoadInt64(&p.Skipped),
+		Errored:  atomic.LoadInt64(&p.Errored),
+
+		Unsupported: atomic.LoadInt64(&p.Unsupported),
+	}
+}
+
+// Pipeline imports the media files under a directory
+type Pipeline struct {
+	DB        *pg.DB
+	Walk      utils.WalkOptions
+	Workers   int
+	BatchSize int
+	Progress  *Progress
+	// LoudnessTarget and TruePeakLimit set the gain stored for each track
+	LoudnessTarget float64
+	TruePeakLimit  float64
+	// SilenceThreshold and SilenceMinDuration control the detection of
+	// leading and trailing silence
+	SilenceThreshold   float64
+	SilenceMinDuration time.Duration
+	// DataDir is where generated waveforms and artwork are stored
+	DataDir string
+	// MediaExts are the extensions of files reported as unsupported when
+	// their content isn't recognised
+	MediaExts []string
+	// Storage finds the object stores of remote paths
+	Storage *storage.Resolver
+	// Separators split the artist and genre tags of the files imported
+	Separators []string
+
+	// walkErrs are the parts of the tree the last Run couldn't read
+	walkErrs utils.WalkErrors
+	// libraryPaths are loaded once for the errors of a Run
+	libraryPaths []models.LibraryPath
+	// save stores a batch of imports, TrackQuery.SaveImports when nil
+	save func([]*models.TrackImport) error
+}
+
+// source is a file found for import, st and obj are set for objects in an
+// object store
+type source struct {
+	path string
+	st   storage.Storage
+	obj  storage.Object
+}
+
+// NewPipeline creates a Pipeline using the import settings from cfg
+func NewPipeline(db *pg.DB, cfg *config.Config) *Pipeline {
+	workers := cfg.ImportWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	batchSize := cfg.ImportBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	// zero is a level like any other, only unset levels take the default
+	target := DefaultLoudnessTarget
+	if cfg.LoudnessTarget != nil {
+		target = *cfg.LoudnessTarget
+	}
+	peakLimit := DefaultTruePeakLimit
+	if cfg.TruePeakLimit != nil {
+		peakLimit = *cfg.TruePeakLimit
+	}
+	silence := cfg.SilenceThreshold
+	if silence == 0 {
+		silence = DefaultSilenceThreshold
+	}
+	minSilence := cfg.SilenceMinDuration.Duration
+	if minSilence <= 0 {
+		minSilence = DefaultSilenceMinDuration
+	}
+	separators := cfg.TagSeparators
+	if len(separators) == 0 {
+		separators = tags.Separators
+	}
+	return &Pipeline{
+		DB: db,
+		Walk: utils.WalkOptions{
+			FollowSymlinks: cfg.FollowSymlinks,
+		},
+		Workers:        workers,
+		BatchSize:      batchSize,
+		Progress:       new(Progress),
+		LoudnessTarget: target,
+		TruePeakLimit:  peakLimit,
+
+		SilenceThreshold:   silence,
+		SilenceMinDuration: minSilence,
+
+		DataDir:   cfg.DataPath(),
+		MediaExts: cfg.MediaExts,
+		Storage:   storage.NewResolver(cfg),
+
+		Separators: separators,
+	}
+}
+
+// Run imports every media file under root, media files that can't be
+// imported are logged and counted as unsupported. It returns once all the files
+// found have been stored or ctx is cancelled, in which case tracks already
+// read are still written before returning ctx.Err(). Parts of the tree that
+// can't be read don't stop the import, they are told by WalkErrors once it
+// returns. A root in an object store is listed through Storage.
+func (p *Pipeline) Run(ctx context.Context, root string) error {
+	sources := make(chan source, p.Workers*2)
+	results := make(chan *models.TrackImport, p.BatchSize)
+	p.walkErrs = nil
+
+	lpq := models.LibraryPathQuery{
+		DB: p.DB,
+	}
+	// errors look them up again one by one if they can't be loaded
+	p.libraryPaths, _ = lpq.GetAllLibraryPaths()
+	defer func() { p.libraryPaths = nil }()
+
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(sources)
+		if storage.IsRemote(root) {
+			walkErr <- p.list(ctx, root, sources)
+		} else {
+			walkErr <- p.walk(ctx, root, sources)
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < p.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			p.work(ctx, sources, results)
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	p.write(results)
+
+	err := <-walkErr
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// walk sends every file under root down sources, errors reading parts
+// of the tree are logged and kept for WalkErrors
+func (p *Pipeline) walk(ctx context.Context, root string, sources chan<- source) error {
+	w := utils.NewFileWalker(ctx, root, p.Walk)
+	for w.Next() {
+		select {
+		case sources <- source{path: w.Path()}:
+		case <-ctx.Done():
+		}
+	}
+	for _, werr := range w.Errors() {
+		logutils.Log.Error("error walking", werr)
+	}
+	p.walkErrs = w.Errors()
+	return w.Err()
+}
+
+// WalkErrors returns the parts of the tree the last Run couldn't read,
+// what is below them may not have been seen
+func (p *Pipeline) WalkErrors() utils.WalkErrors {
+	return p.walkErrs
+}
+
+// list sends every object under the remote root that isn't ignored down
+// sources
+func (p *Pipeline) list(ctx context.Context, root string, sources chan<- source) error {
+	st, prefix, err := p.Storage.ResolveDir(root)
+	if err != nil {
+		return err
+	}
+	return st.List(ctx, prefix, func(obj storage.Object) error {
+		path := st.Path(obj.Key)
+		// some stores list the markers of empty directories
+		if strings.HasSuffix(obj.Key, "/") {
+			return nil
+		}
+		if p.Walk.Ignore != nil && p.Walk.Ignore.Ignored(path, false) {
+			return nil
+		}
+		select {
+		case sources <- source{path: path, st: st, obj: obj}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// work prepares the import of each file it receives
+func (p *Pipeline) work(ctx context.Context, sources <-chan source, results chan<- *models.TrackImport) {
+	for src := range sources {
+		if ctx.Err() != nil {
+			continue
+		}
+		ti, err := p.prepare(ctx, src)
+		if err == ErrNotMedia {
+			continue
+		}
+		atomic.AddInt64(&p.Progress.Seen, 1)
+		if IsUnsupported(err) {
+			logutils.Log.Error("Could not import file", err)
+			atomic.AddInt64(&p.Progress.Unsupported, 1)
+			p.recordError(ctx, src.path, err)
+			continue
+		}
+		if err != nil {
+			logutils.Log.Error("Could not import file", src.path, err)
+			atomic.AddInt64(&p.Progress.Errored, 1)
+			p.recordError(ctx, src.path, err)
+			continue
+		}
+		if !ti.NeedsSave() {
+			atomic.AddInt64(&p.Progress.Skipped, 1)
+			continue
+		}
+		results <- ti
+	}
+}
+
+// prepare sniffs the format of a file, examines it and analyses it's audio
+// and finds it's artwork and links it to it's artist and album if needed.
+// Files are only sniffed when they have to be read, unchanged ones keep the
+// format stored for their track. It returns ErrNotMedia for files that are
+// not media and an UnsupportedError for media that can't be imported.
+func (p *Pipeline) prepare(ctx context.Context, src source) (*models.TrackImport, error) {
+	if src.st != nil {
+		return p.prepareObject(ctx, src)
+	}
+	info, err := os.Stat(src.path)
+	if err != nil {
+		return nil, err
+	}
+	var format audio.Format
+	sniffed := false
+	read := func() (string, error) {
+		var ferr error
+		format, ferr = p.detect(src.path)
+		sniffed = true
+		return src.path, ferr
+	}
+	tq := models.TrackQuery{
+		DB:         p.DB,
+		Separators: p.Separators,
+	}
+	ti, err := tq.PrepareImportFrom(src.path, info, read)
+	if err != nil {
+		return nil, err
+	}
+	if sniffed {
+		p.setFormat(ti, format)
+	} else {
+		p.backfillFormat(ti, func() (audio.Format, error) {
+			return p.detect(src.path)
+		})
+	}
+	p.analyze(ctx, ti)
+	p.findArtwork(ti)
+	p.link(ti)
+	return ti, nil
+}
+
+// prepareObject is prepare for an object in an object store. The object is
+// only sniffed and copied to be read when it's track has to be read again,
+// the copy is removed before returning.
+func (p *Pipeline) prepareObject(ctx context.Context, src source) (*models.TrackImport, error) {
+	var format audio.Format
+	sniffed := false
+	fetch := func() (string, error) {
+		var err error
+		format, err = p.detectObject(ctx, src.st, src.obj.Key)
+		if err != nil {
+			return "", err
+		}
+		sniffed = true
+		return storage.Fetch(ctx, src.st, src.obj.Key, filepath.Join(p.DataDir, "fetch"))
+	}
+	tq := models.TrackQuery{
+		DB:         p.DB,
+		Separators: p.Separators,
+	}
+	ti, err := tq.PrepareImportFrom(src.path, src.obj.Info(), fetch)
+	if err != nil {
+		return nil, err
+	}
+	if ti.Local != "" {
+		defer func() {
+			os.Remove(ti.Local)
+			ti.Local = ""
+		}()
+	}
+	// unchanged objects keep the format sniffed when they where read
+	if sniffed {
+		p.setFormat(ti, format)
+	} else {
+		p.backfillFormat(ti, func() (audio.Format, error) {
+			return p.detectObject(ctx, src.st, src.obj.Key)
+		})
+	}
+	p.analyze(ctx, ti)
+	p.findArtwork(ti)
+	p.link(ti)
+	return ti, nil
+}
+
+// ImportFile imports a single file straight away, going through the same
+// steps as the files of a Run. It returns ErrNotMedia for files that are not
+// media and an UnsupportedError for media that can't be imported, failures
+// are recorded as import errors. Remote paths are looked up through Storage.
+func (p *Pipeline) ImportFile(ctx context.Context, path string) (*models.TrackImport, error) {
+	if !storage.IsRemote(path) {
+		return p.importSource(ctx, source{path: path})
+	}
+	st, key, err := p.Storage.Resolve(path)
+	if err != nil {
+		p.recordError(ctx, path, err)
+		return nil, err
+	}
+	obj, err := st.Stat(ctx, key)
+	if err != nil {
+		p.recordError(ctx, path, err)
+		return nil, err
+	}
+	return p.ImportObject(ctx, st, obj)
+}
+
+// ImportObject is ImportFile for an object in a storage whose description
+// is already known, like from a listing
+func (p *Pipeline) ImportObject(ctx context.Context, st storage.Storage, obj storage.Object) (*models.TrackImport, error) {
+	return p.importSource(ctx, source{path: st.Path(obj.Key), st: st, obj: obj})
+}
+
+func (p *Pipeline) importSource(ctx context.Context, src source) (*models.TrackImport, error) {
+	ti, err := p.prepare(ctx, src)
+	if err != nil {
+		p.recordError(ctx, src.path, err)
+		return nil, err
+	}
+	if ti.NeedsSave() {
+		err = p.saveImports([]*models.TrackImport{ti})
+		if err != nil {
+			p.recordError(ctx, src.path, err)
+		} else {
+			p.dropWaveforms([]*models.TrackImport{ti})
+		}
+	}
+	return ti, err
+}
+
+// saveImports stores a batch of prepared imports
+func (p *Pipeline) saveImports(imports []*models.TrackImport) error {
+	if p.save != nil {
+		return p.save(imports)
+	}
+	tq := models.TrackQuery{
+		DB: p.DB,
+	}
+	return tq.SaveImports(imports)
+}
+
+// write stores the prepared imports in batches until results is closed
+func (p *Pipeline) write(results <-chan *models.TrackImport) {
+	batch := make([]*models.TrackImport, 0, p.BatchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.saveImports(batch); err != nil {
+			logutils.Log.Errorf("Could not store %d tracks: %s", len(batch), err)
+			atomic.AddInt64(&p.Progress.Errored, int64(len(batch)))
+			for _, ti := range batch {
+				p.recordError(context.Background(), ti.Track.Path, err)
+			}
+		} else {
+			for _, ti := range batch {
+				p.count(ti)
+			}
+			p.dropWaveforms(batch)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ti, ok := <-results:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, ti)
+			if len(batch) >= p.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// count adds a stored import to the progress counters
+func (p *Pipeline) count(ti *models.TrackImport) {
+	switch ti.Status {
+	case models.ImportCreated, models.ImportRelinked:
+		atomic.AddInt64(&p.Progress.Imported, 1)
+	case models.ImportUpdated:
+		atomic.AddInt64(&p.Progress.Updated, 1)
+	default:
+		atomic.AddInt64(&p.Progress.Skipped, 1)
+	}
+}
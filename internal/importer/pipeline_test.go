@@ -0,0 +1,50 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestWriteBatches(t *testing.T) {
+	var batches []int
+	var saved []string
+	p := &Pipeline{
+		BatchSize: 2,
+		Progress:  new(Progress),
+		save: func(imports []*models.TrackImport) error {
+			batches = append(batches, len(imports))
+			for _, ti := range imports {
+				saved = append(saved, ti.Track.Path)
+			}
+			return nil
+		},
+	}
+
+	imports := []*models.TrackImport{
+		{Track: &models.Track{Path: "a"}, Status: models.ImportCreated},
+		{Track: &models.Track{Path: "b"}, Status: models.ImportUpdated},
+		{Track: &models.Track{Path: "c"}, Status: models.ImportRelinked},
+		{Track: &models.Track{Path: "d"}, Status: models.ImportUnchanged, Columns: []string{"gain"}},
+		{Track: &models.Track{Path: "e"}, Status: models.ImportCreated},
+	}
+	results := make(chan *models.TrackImport, len(imports))
+	for _, ti := range imports {
+		results <- ti
+	}
+	close(results)
+	p.write(results)
+
+	// what's left when results close is written too
+	if !reflect.DeepEqual(batches, []int{2, 2, 1}) {
+		t.Errorf("batches of %v, want 2, 2 and 1", batches)
+	}
+	if !reflect.DeepEqual(saved, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("saved %v", saved)
+	}
+	want := Progress{Imported: 3, Updated: 1, Skipped: 1}
+	if got := p.Progress.Snapshot(); got != want {
+		t.Errorf("progress %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	// albums without an artist have a NULL artist_id, the unique index
+	// treats them as artist 0 so their titles are unique too
+	upcmd := `
+	CREATE TABLE "artists" (
+	  "id" bigserial,
+	  "name" text,
+	  "norm_name" text NOT NULL UNIQUE,
+	  "aliases" text[],
+	  "added" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE TABLE "albums" (
+	  "id" bigserial,
+	  "title" text,
+	  "norm_title" text NOT NULL,
+	  "artist_id" bigint REFERENCES "artists" ("id") ON DELETE SET NULL,
+	  "aliases" text[],
+	  "added" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE UNIQUE INDEX "albums_norm_title_artist_idx" ON "albums" ("norm_title", COALESCE("artist_id", 0));
+	CREATE INDEX "albums_artist_id_idx" ON "albums" ("artist_id");
+
+	ALTER TABLE "tracks"
+	  ADD COLUMN "artist_id" bigint REFERENCES "artists" ("id") ON DELETE SET NULL,
+	  ADD COLUMN "album_id" bigint REFERENCES "albums" ("id") ON DELETE SET NULL;
+
+	CREATE INDEX "tracks_artist_id_idx" ON "tracks" ("artist_id");
+	CREATE INDEX "tracks_album_id_idx" ON "tracks" ("album_id");
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_album_id_idx";
+	DROP INDEX IF EXISTS "tracks_artist_id_idx";
+
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "album_id",
+	  DROP COLUMN IF EXISTS "artist_id";
+
+	DROP TABLE IF EXISTS "albums";
+	DROP TABLE IF EXISTS "artists";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	// the fingerprints of present tracks are cleared so their tags are read
+	// again and split into their artists and genres on the next scan
+	upcmd := `
+	CREATE TABLE "genres" (
+	  "id" bigserial,
+	  "name" text,
+	  "norm_name" text NOT NULL UNIQUE,
+	  "added" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE TABLE "track_artists" (
+	  "track_id" bigint REFERENCES "tracks" ("id") ON DELETE CASCADE,
+	  "artist_id" bigint REFERENCES "artists" ("id") ON DELETE CASCADE,
+	  "position" bigint NOT NULL DEFAULT 0,
+	  PRIMARY KEY ("track_id", "artist_id")
+	);
+
+	CREATE TABLE "track_genres" (
+	  "track_id" bigint REFERENCES "tracks" ("id") ON DELETE CASCADE,
+	  "genre_id" bigint REFERENCES "genres" ("id") ON DELETE CASCADE,
+	  "position" bigint NOT NULL DEFAULT 0,
+	  PRIMARY KEY ("track_id", "genre_id")
+	);
+
+	CREATE INDEX "track_artists_artist_id_idx" ON "track_artists" ("artist_id");
+	CREATE INDEX "track_genres_genre_id_idx" ON "track_genres" ("genre_id");
+
+	ALTER TABLE "tracks"
+	  ADD COLUMN "artists" text[],
+	  ADD COLUMN "genres" text[];
+
+	UPDATE "tracks" SET "mtime" = NULL, "fast_hash" = NULL WHERE "missing" = false;
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "artists",
+	  DROP COLUMN IF EXISTS "genres";
+
+	DROP TABLE IF EXISTS "track_genres";
+	DROP TABLE IF EXISTS "track_artists";
+	DROP TABLE IF EXISTS "genres";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "library_paths"
+	  ADD COLUMN "ignore" text[];
+	`
+
+	downcmd := `
+	ALTER TABLE "library_paths"
+	  DROP COLUMN IF EXISTS "ignore";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "format" text,
+	  ADD COLUMN "codec" text;
+	CREATE INDEX "tracks_format_codec_idx" ON "tracks" ("format", "codec");
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_format_codec_idx";
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "format",
+	  DROP COLUMN IF EXISTS "codec";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
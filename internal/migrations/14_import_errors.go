@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "import_errors" (
+	  "id" bigserial,
+	  "path" text,
+	  "library_path_id" bigint,
+	  "class" text,
+	  "message" text,
+	  "attempts" bigint NOT NULL DEFAULT 0,
+	  "added" timestamptz DEFAULT now(),
+	  "occurred" timestamptz,
+	  PRIMARY KEY ("id"),
+	  UNIQUE ("path"),
+	  FOREIGN KEY ("library_path_id") REFERENCES "library_paths" ("id") ON DELETE CASCADE
+	);
+	CREATE INDEX "import_errors_library_path_id_idx" ON "import_errors" ("library_path_id");
+	`
+
+	downcmd := `
+	DROP TABLE IF EXISTS "import_errors";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "import_jobs" (
+	  "id" bigserial,
+	  "library_path_id" bigint REFERENCES "library_paths" ("id") ON DELETE CASCADE,
+	  "status" text,
+	  "seen" bigint NOT NULL DEFAULT 0,
+	  "imported" bigint NOT NULL DEFAULT 0,
+	  "updated" bigint NOT NULL DEFAULT 0,
+	  "skipped" bigint NOT NULL DEFAULT 0,
+	  "errored" bigint NOT NULL DEFAULT 0,
+	  "unsupported" bigint NOT NULL DEFAULT 0,
+	  "error" text,
+	  "queued" timestamptz DEFAULT now(),
+	  "started" timestamptz,
+	  "finished" timestamptz,
+	  PRIMARY KEY ("id")
+	);
+	CREATE INDEX "import_jobs_library_path_id_idx" ON "import_jobs" ("library_path_id");
+	CREATE INDEX "import_jobs_status_idx" ON "import_jobs" ("status");
+	`
+
+	downcmd := `
+	DROP TABLE IF EXISTS "import_jobs";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
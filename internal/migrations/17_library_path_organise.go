@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "library_paths"
+	  ADD COLUMN "organise" boolean NOT NULL DEFAULT false,
+	  ADD COLUMN "layout" text;
+	`
+
+	downcmd := `
+	ALTER TABLE "library_paths"
+	  DROP COLUMN IF EXISTS "organise",
+	  DROP COLUMN IF EXISTS "layout";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "edited_fields" text[];
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "edited_fields";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "duplicate_groups" (
+	  "id" bigserial,
+	  "kind" text,
+	  "key" text,
+	  "track_ids" bigint[],
+	  "found" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE INDEX "duplicate_groups_track_ids_idx" ON "duplicate_groups" USING GIN ("track_ids");
+
+	ALTER TABLE "tracks"
+	  ADD COLUMN "replaced_by" bigint REFERENCES "tracks" ("id") ON DELETE SET NULL;
+
+	CREATE INDEX "tracks_replaced_by_idx" ON "tracks" ("replaced_by");
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "replaced_by";
+
+	DROP TABLE IF EXISTS "duplicate_groups";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "playlists" (
+	  "id" bigserial,
+	  "name" text,
+	  "description" text,
+	  "added" timestamptz DEFAULT now(),
+	  "updated" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE TABLE "playlist_tracks" (
+	  "id" bigserial,
+	  "playlist_id" bigint NOT NULL REFERENCES "playlists" ("id") ON DELETE CASCADE,
+	  "track_id" bigint NOT NULL REFERENCES "tracks" ("id") ON DELETE CASCADE,
+	  "position" bigint NOT NULL DEFAULT 0,
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE INDEX "playlist_tracks_playlist_id_idx" ON "playlist_tracks" ("playlist_id", "position");
+	CREATE INDEX "playlist_tracks_track_id_idx" ON "playlist_tracks" ("track_id");
+	`
+
+	downcmd := `
+	DROP TABLE IF EXISTS "playlist_tracks";
+	DROP TABLE IF EXISTS "playlists";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
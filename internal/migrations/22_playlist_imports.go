@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "playlists"
+	  ADD COLUMN "source" text,
+	  ADD COLUMN "source_mtime" timestamptz,
+	  ADD COLUMN "source_size" bigint;
+
+	CREATE UNIQUE INDEX "playlists_source_idx" ON "playlists" ("source");
+
+	ALTER TABLE "playlist_tracks"
+	  ADD COLUMN "location" text,
+	  ADD COLUMN "manual" boolean NOT NULL DEFAULT false;
+
+	CREATE TABLE "unresolved_entries" (
+	  "id" bigserial,
+	  "playlist_id" bigint NOT NULL REFERENCES "playlists" ("id") ON DELETE CASCADE,
+	  "position" bigint NOT NULL DEFAULT 0,
+	  "location" text,
+	  "title" text,
+	  "artist" text,
+	  "album" text,
+	  "length" bigint,
+	  PRIMARY KEY ("id")
+	);
+
+	CREATE INDEX "unresolved_entries_playlist_id_idx" ON "unresolved_entries" ("playlist_id", "position");
+	`
+
+	downcmd := `
+	DROP TABLE IF EXISTS "unresolved_entries";
+	ALTER TABLE "playlist_tracks"
+	  DROP COLUMN IF EXISTS "location",
+	  DROP COLUMN IF EXISTS "manual";
+	DROP INDEX IF EXISTS "playlists_source_idx";
+	ALTER TABLE "playlists"
+	  DROP COLUMN IF EXISTS "source",
+	  DROP COLUMN IF EXISTS "source_mtime",
+	  DROP COLUMN IF EXISTS "source_size";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
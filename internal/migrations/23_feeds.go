@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "feed_subscriptions" (
+	  "id" bigserial,
+	  "url" text NOT NULL,
+	  "title" text,
+	  "author" text,
+	  "retention" bigint NOT NULL DEFAULT 0,
+	  "enabled" boolean NOT NULL DEFAULT true,
+	  "etag" text,
+	  "last_modified" text,
+	  "last_polled" timestamptz,
+	  "last_error" text,
+	  "added" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id"),
+	  UNIQUE ("url")
+	);
+
+	CREATE TABLE "feed_episodes" (
+	  "id" bigserial,
+	  "feed_id" bigint NOT NULL REFERENCES "feed_subscriptions" ("id") ON DELETE CASCADE,
+	  "guid" text NOT NULL,
+	  "title" text,
+	  "link" text,
+	  "published" timestamptz,
+	  "enclosure_url" text,
+	  "status" text NOT NULL,
+	  "error" text,
+	  "track_id" bigint REFERENCES "tracks" ("id") ON DELETE SET NULL,
+	  "path" text,
+	  "downloaded" timestamptz,
+	  PRIMARY KEY ("id"),
+	  UNIQUE ("feed_id", "guid")
+	);
+
+	CREATE INDEX "feed_episodes_track_id_idx" ON "feed_episodes" ("track_id");
+	`
+
+	downcmd := `
+	DROP TABLE IF EXISTS "feed_episodes";
+	DROP TABLE IF EXISTS "feed_subscriptions";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "mtime" timestamptz,
+	  ADD COLUMN "size" bigint,
+	  ADD COLUMN "fast_hash" text,
+	  ADD COLUMN "sha256" text;
+
+	CREATE INDEX "tracks_path_idx" ON "tracks" ("path");
+	CREATE INDEX "tracks_fast_hash_idx" ON "tracks" ("fast_hash");
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_fast_hash_idx";
+	DROP INDEX IF EXISTS "tracks_path_idx";
+
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "mtime",
+	  DROP COLUMN IF EXISTS "size",
+	  DROP COLUMN IF EXISTS "fast_hash",
+	  DROP COLUMN IF EXISTS "sha256";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "missing" boolean NOT NULL DEFAULT false,
+	  ADD COLUMN "missing_since" timestamptz;
+
+	CREATE INDEX "tracks_missing_idx" ON "tracks" ("missing");
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_missing_idx";
+
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "missing",
+	  DROP COLUMN IF EXISTS "missing_since";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "loudness" double precision,
+	  ADD COLUMN "loudness_range" double precision,
+	  ADD COLUMN "true_peak" double precision,
+	  ADD COLUMN "gain" double precision,
+	  ADD COLUMN "analyzed_at" timestamptz,
+	  ADD COLUMN "analysis_error" text;
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "loudness",
+	  DROP COLUMN IF EXISTS "loudness_range",
+	  DROP COLUMN IF EXISTS "true_peak",
+	  DROP COLUMN IF EXISTS "gain",
+	  DROP COLUMN IF EXISTS "analyzed_at",
+	  DROP COLUMN IF EXISTS "analysis_error";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
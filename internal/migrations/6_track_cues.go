@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	// tracks measured before cues where detected are measured again
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "cue_in" bigint,
+	  ADD COLUMN "cue_out" bigint,
+	  ADD COLUMN "cue_manual" boolean NOT NULL DEFAULT false;
+
+	UPDATE "tracks" SET "analyzed_at" = NULL;
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "cue_in",
+	  DROP COLUMN IF EXISTS "cue_out",
+	  DROP COLUMN IF EXISTS "cue_manual";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
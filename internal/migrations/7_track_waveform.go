@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	// tracks are measured again so their waveforms are generated
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "waveform" text;
+
+	UPDATE "tracks" SET "analyzed_at" = NULL;
+	`
+
+	downcmd := `
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "waveform";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
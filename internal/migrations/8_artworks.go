@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	upcmd := `
+	CREATE TABLE "artworks" (
+	  "id" bigserial,
+	  "hash" text NOT NULL UNIQUE,
+	  "mime" text,
+	  "width" bigint,
+	  "height" bigint,
+	  "size" bigint,
+	  "path" text,
+	  "added" timestamptz DEFAULT now(),
+	  PRIMARY KEY ("id")
+	);
+
+	ALTER TABLE "tracks"
+	  ADD COLUMN "artwork_id" bigint REFERENCES "artworks" ("id") ON DELETE SET NULL,
+	  ADD COLUMN "artwork_checked" boolean NOT NULL DEFAULT false;
+
+	CREATE INDEX "tracks_artwork_id_idx" ON "tracks" ("artwork_id");
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_artwork_id_idx";
+
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "artwork_id",
+	  DROP COLUMN IF EXISTS "artwork_checked";
+
+	DROP TABLE IF EXISTS "artworks";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
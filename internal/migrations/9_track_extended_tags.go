@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/go-pg/migrations"
+)
+
+func init() {
+
+	// the fingerprints of present tracks are cleared so their tags are read
+	// again on the next scan
+	upcmd := `
+	ALTER TABLE "tracks"
+	  ADD COLUMN "track_number" bigint,
+	  ADD COLUMN "disc_number" bigint,
+	  ADD COLUMN "album_artist" text,
+	  ADD COLUMN "composer" text,
+	  ADD COLUMN "publisher" text,
+	  ADD COLUMN "isrc" text,
+	  ADD COLUMN "bpm" double precision,
+	  ADD COLUMN "comment" text,
+	  ADD COLUMN "copyright" text,
+	  ADD COLUMN "language" text;
+
+	CREATE INDEX "tracks_isrc_idx" ON "tracks" ("isrc");
+
+	UPDATE "tracks" SET "mtime" = NULL, "fast_hash" = NULL WHERE "missing" = false;
+	`
+
+	downcmd := `
+	DROP INDEX IF EXISTS "tracks_isrc_idx";
+
+	ALTER TABLE "tracks"
+	  DROP COLUMN IF EXISTS "track_number",
+	  DROP COLUMN IF EXISTS "disc_number",
+	  DROP COLUMN IF EXISTS "album_artist",
+	  DROP COLUMN IF EXISTS "composer",
+	  DROP COLUMN IF EXISTS "publisher",
+	  DROP COLUMN IF EXISTS "isrc",
+	  DROP COLUMN IF EXISTS "bpm",
+	  DROP COLUMN IF EXISTS "comment",
+	  DROP COLUMN IF EXISTS "copyright",
+	  DROP COLUMN IF EXISTS "language";
+	`
+
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(upcmd)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(downcmd)
+		return err
+	})
+}
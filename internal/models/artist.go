@@ -0,0 +1,374 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Artist is an artist credited on tracks. Tracks are linked to the artist
+// whose normalised name matches the artist tag of their file, see
+// utils.NormalizeName.
+type Artist struct {
+	ID int64
+	// Name is the name as first seen in a tag
+	Name     string
+	NormName string `sql:",unique"`
+	// Aliases are the normalised names of artists merged into this one, tags
+	// with any of them are linked to this artist
+	Aliases []string  `sql:",array"`
+	Added   time.Time `sql:"default:now()"`
+}
+
+// Album is an album of tracks by one album artist, which is the album
+// artist tag of the tracks or their artist if they have none
+type Album struct {
+	ID        int64
+	Title     string
+	NormTitle string
+	ArtistID  int64
+	Artist    *Artist
+	// Aliases are the normalised titles of albums merged into this one
+	Aliases []string  `sql:",array"`
+	Added   time.Time `sql:"default:now()"`
+}
+
+// ErrMergeSelf is returned when merging an artist or album into itself
+var ErrMergeSelf = errors.New("can not merge into itself")
+
+type ArtistQuery struct {
+	DB orm.DB
+}
+
+// GetArtistByID returns an artist from the database by it's id
+func (aq *ArtistQuery) GetArtistByID(id int64) (a *Artist, err error) {
+	a = new(Artist)
+	err = aq.DB.Model(a).Where("artist.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetArtists returns a page of artists ordered by name, ?name__ieq=%beat%
+// filters them by name
+func (aq *ArtistQuery) GetArtists(queryValues url.Values) (artists []Artist, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("name")
+	f.Allow("name__ieq")
+	count, err = aq.DB.Model(&artists).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("artist.norm_name ASC", "artist.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// FindOrAddArtist returns the artist for a name from a tag, adding it if no
+// artist has the same normalised name. An empty name has no artist and
+// returns nil.
+func (aq *ArtistQuery) FindOrAddArtist(name string) (a *Artist, err error) {
+	norm := utils.NormalizeName(name)
+	if norm == "" {
+		return
+	}
+	a, err = aq.findArtist(norm)
+	if err != nil || a != nil {
+		return
+	}
+
+	a = &Artist{Name: name, NormName: norm}
+	_, err = aq.DB.Model(a).OnConflict("(norm_name) DO NOTHING").Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if a.ID != 0 {
+		return
+	}
+	// added by someone else in the meantime
+	return aq.findArtist(norm)
+}
+
+func (aq *ArtistQuery) findArtist(norm string) (a *Artist, err error) {
+	a = new(Artist)
+	err = aq.DB.Model(a).
+		Where("artist.norm_name = ?", norm).
+		WhereOr("? = ANY(artist.aliases)", norm).
+		Order("artist.id ASC").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// MergeArtists collapses the artists with the ids in from into the artist
+// with id into. Their tracks and albums are moved over, albums with the same
+// title as one of into's are merged with it, and their names become aliases
+// of into so tags with them are linked to it from then on.
+func (aq *ArtistQuery) MergeArtists(into int64, from []int64) (a *Artist, err error) {
+	if len(from) == 0 {
+		return aq.GetArtistByID(into)
+	}
+	for _, id := range from {
+		if id == into {
+			err = ErrMergeSelf
+			return
+		}
+	}
+	a = new(Artist)
+	err = runInTransaction(aq.DB, func(tx *pg.Tx) error {
+		err := tx.Model(a).Where("artist.id = ?", into).For("UPDATE").Select()
+		if err != nil {
+			return err
+		}
+		var merged []Artist
+		err = tx.Model(&merged).Where("artist.id IN (?)", pg.In(from)).Select()
+		if err != nil {
+			return err
+		}
+		if len(merged) != len(from) {
+			return pg.ErrNoRows
+		}
+
+		_, err = tx.Model((*Track)(nil)).
+			Set("artist_id = ?", into).
+			Where("artist_id IN (?)", pg.In(from)).
+			Update()
+		if err != nil {
+			return err
+		}
+		// tracks already linked to into keep their link to it
+		_, err = tx.Model((*TrackArtist)(nil)).
+			Where("artist_id IN (?)", pg.In(from)).
+			Where("track_id IN (SELECT track_id FROM track_artists WHERE artist_id = ?)", into).
+			Delete()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Model((*TrackArtist)(nil)).
+			Set("artist_id = ?", into).
+			Where("artist_id IN (?)", pg.In(from)).
+			Update()
+		if err != nil {
+			return err
+		}
+
+		var albums []Album
+		err = tx.Model(&albums).Where("album.artist_id IN (?)", pg.In(from)).Select()
+		if err != nil {
+			return err
+		}
+		alq := AlbumQuery{DB: tx}
+		for _, al := range albums {
+			var same *Album
+			same, err = alq.findAlbum(al.NormTitle, into)
+			if err != nil {
+				return err
+			}
+			if same == nil {
+				al.ArtistID = into
+				_, err = tx.Model(&al).Column("artist_id").WherePK().Update()
+			} else {
+				err = alq.mergeAlbums(tx, same, []Album{al})
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, m := range merged {
+			a.Aliases = appendAliases(a.Aliases, a.NormName, m.NormName)
+			a.Aliases = appendAliases(a.Aliases, a.NormName, m.Aliases...)
+		}
+		_, err = tx.Model(a).Column("aliases").WherePK().Update()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Model((*Artist)(nil)).Where("id IN (?)", pg.In(from)).Delete()
+		return err
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+type AlbumQuery struct {
+	DB orm.DB
+}
+
+// GetAlbumByID returns an album from the database by it's id along with
+// it's artist
+func (alq *AlbumQuery) GetAlbumByID(id int64) (al *Album, err error) {
+	al = new(Album)
+	err = alq.DB.Model(al).Relation("Artist").Where("album.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetAlbums returns a page of albums ordered by title along with their
+// artists, ?title__ieq=%abbey% filters them by title and ?artist_id=1 by
+// artist
+func (alq *AlbumQuery) GetAlbums(queryValues url.Values) (albums []Album, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("title")
+	f.Allow("title__ieq")
+	f.Allow("artist_id")
+	count, err = alq.DB.Model(&albums).
+		Relation("Artist").
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("album.norm_title ASC", "album.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// FindOrAddAlbum returns the album for a title from a tag by the artist with
+// id artistID, adding it if the artist has no album with the same normalised
+// title. An artistID of 0 is an album without an artist. An empty title has
+// no album and returns nil.
+func (alq *AlbumQuery) FindOrAddAlbum(title string, artistID int64) (al *Album, err error) {
+	norm := utils.NormalizeName(title)
+	if norm == "" {
+		return
+	}
+	al, err = alq.findAlbum(norm, artistID)
+	if err != nil || al != nil {
+		return
+	}
+
+	al = &Album{Title: title, NormTitle: norm, ArtistID: artistID}
+	_, err = alq.DB.Model(al).OnConflict("(norm_title, COALESCE(artist_id, 0)) DO NOTHING").Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if al.ID != 0 {
+		return
+	}
+	return alq.findAlbum(norm, artistID)
+}
+
+func (alq *AlbumQuery) findAlbum(norm string, artistID int64) (al *Album, err error) {
+	al = new(Album)
+	err = alq.DB.Model(al).
+		Where("COALESCE(album.artist_id, 0) = ?", artistID).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("album.norm_title = ?", norm).
+				WhereOr("? = ANY(album.aliases)", norm)
+			return q, nil
+		}).
+		Order("album.id ASC").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// MergeAlbums collapses the albums with the ids in from into the album with
+// id into. Their tracks are moved over and their titles become aliases of
+// into.
+func (alq *AlbumQuery) MergeAlbums(into int64, from []int64) (al *Album, err error) {
+	if len(from) == 0 {
+		return alq.GetAlbumByID(into)
+	}
+	for _, id := range from {
+		if id == into {
+			err = ErrMergeSelf
+			return
+		}
+	}
+	al = new(Album)
+	err = runInTransaction(alq.DB, func(tx *pg.Tx) error {
+		err := tx.Model(al).Where("album.id = ?", into).For("UPDATE").Select()
+		if err != nil {
+			return err
+		}
+		var merged []Album
+		err = tx.Model(&merged).Where("album.id IN (?)", pg.In(from)).Select()
+		if err != nil {
+			return err
+		}
+		if len(merged) != len(from) {
+			return pg.ErrNoRows
+		}
+		return alq.mergeAlbums(tx, al, merged)
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// mergeAlbums moves the tracks of merged to al and deletes them
+func (alq *AlbumQuery) mergeAlbums(tx *pg.Tx, al *Album, merged []Album) error {
+	ids := make([]int64, len(merged))
+	for i, m := range merged {
+		ids[i] = m.ID
+		al.Aliases = appendAliases(al.Aliases, al.NormTitle, m.NormTitle)
+		al.Aliases = appendAliases(al.Aliases, al.NormTitle, m.Aliases...)
+	}
+	_, err := tx.Model((*Track)(nil)).
+		Set("album_id = ?", al.ID).
+		Where("album_id IN (?)", pg.In(ids)).
+		Update()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model(al).Column("aliases").WherePK().Update()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*Album)(nil)).Where("id IN (?)", pg.In(ids)).Delete()
+	return err
+}
+
+// appendAliases adds names to aliases that aren't already in it or the
+// name itself
+func appendAliases(aliases []string, name string, names ...string) []string {
+	for _, n := range names {
+		if n != name && !utils.StringInSlice(n, aliases) {
+			aliases = append(aliases, n)
+		}
+	}
+	return aliases
+}
+
+// runInTransaction runs fn in a new transaction, or in db itself if it
+// already is one
+func runInTransaction(db orm.DB, fn func(*pg.Tx) error) error {
+	switch db := db.(type) {
+	case *pg.Tx:
+		return fn(db)
+	case *pg.DB:
+		return db.RunInTransaction(fn)
+	}
+	return errors.New("unsupported database handle")
+}
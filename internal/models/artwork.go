@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// Artwork is a cover image shared by the tracks it was found for, images
+// are stored once per content hash
+type Artwork struct {
+	ID     int64
+	Hash   string
+	MIME   string `sql:"mime"`
+	Width  int
+	Height int
+	Size   int64
+	// Path is where the image is stored relative to the data directory
+	Path  string
+	Added time.Time `sql:"default:now()"`
+}
+
+type ArtworkQuery struct {
+	DB *pg.DB
+}
+
+// GetArtworkByID returns an artwork from the database by it's id
+func (aq *ArtworkQuery) GetArtworkByID(id int64) (a *Artwork, err error) {
+	a = new(Artwork)
+	err = aq.DB.Model(a).Where("artwork.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// AddArtwork stores an artwork unless one with the same hash already is, in
+// either case a is filled in with the stored artwork
+func (aq *ArtworkQuery) AddArtwork(a *Artwork) (err error) {
+	_, err = aq.DB.Model(a).OnConflict("(hash) DO NOTHING").Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if a.ID != 0 {
+		return
+	}
+	err = aq.DB.Model(a).Where("artwork.hash = ?", a.Hash).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
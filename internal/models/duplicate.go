@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// Kinds of duplicate groups
+const (
+	// DuplicateContent groups tracks whose files have the same content
+	DuplicateContent = "content"
+	// DuplicateMetadata groups tracks with the same artist and title and
+	// about the same length
+	DuplicateMetadata = "metadata"
+)
+
+// ErrNotInGroup is returned when the track to keep of a duplicate group
+// isn't one of it's tracks
+var ErrNotInGroup = errors.New("track is not in the duplicate group")
+
+// DuplicateGroup is a set of tracks found to be copies of each other
+type DuplicateGroup struct {
+	ID   int64
+	Kind string
+	// Key is what the tracks have in common, the SHA-256 of their content
+	// or their normalised artist and title
+	Key      string
+	TrackIDs []int64   `sql:",array"`
+	Found    time.Time `sql:"default:now()"`
+	// Tracks are the tracks of TrackIDs, loaded by GetDuplicateGroups
+	Tracks []Track `sql:"-"`
+}
+
+type DuplicateGroupQuery struct {
+	DB orm.DB
+}
+
+// GetDuplicateGroups returns a page of duplicate groups with their tracks,
+// ?kind= filters them
+func (dgq *DuplicateGroupQuery) GetDuplicateGroups(queryValues url.Values) (groups []DuplicateGroup, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("kind")
+	count, err = dgq.DB.Model(&groups).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("duplicate_group.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+
+	var ids []int64
+	for _, g := range groups {
+		ids = append(ids, g.TrackIDs...)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	var tracks []Track
+	err = dgq.DB.Model(&tracks).Where("track.id IN (?)", pg.In(ids)).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	byID := make(map[int64]Track, len(tracks))
+	for _, t := range tracks {
+		byID[t.ID] = t
+	}
+	for i := range groups {
+		for _, id := range groups[i].TrackIDs {
+			if t, ok := byID[id]; ok {
+				groups[i].Tracks = append(groups[i].Tracks, t)
+			}
+		}
+	}
+	return
+}
+
+// ReplaceGroups replaces all stored duplicate groups with the groups found
+// by a new search
+func (dgq *DuplicateGroupQuery) ReplaceGroups(groups []DuplicateGroup) (err error) {
+	err = runInTransaction(dgq.DB, func(tx *pg.Tx) error {
+		_, err := tx.Exec(`DELETE FROM "duplicate_groups"`)
+		if err != nil || len(groups) == 0 {
+			return err
+		}
+		return tx.Insert(&groups)
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// Resolve keeps the track keep of the duplicate group with id and retires
+// the others, they are replaced by the kept track in every playlist and no
+// longer scheduled. The retired tracks are dropped from any other groups,
+// groups left with a single track are deleted. It returns the ids of the
+// retired tracks.
+func (dgq *DuplicateGroupQuery) Resolve(id, keep int64) (retired []int64, err error) {
+	err = runInTransaction(dgq.DB, func(tx *pg.Tx) error {
+		g := new(DuplicateGroup)
+		err := tx.Model(g).Where("duplicate_group.id = ?", id).For("UPDATE").Select()
+		if err != nil {
+			return err
+		}
+		if !containsID(g.TrackIDs, keep) {
+			return ErrNotInGroup
+		}
+		for _, tid := range g.TrackIDs {
+			if tid != keep {
+				retired = append(retired, tid)
+			}
+		}
+		if err = retireTracks(tx, keep, retired); err != nil {
+			return err
+		}
+		_, err = tx.Model(g).WherePK().Delete()
+		if err != nil {
+			return err
+		}
+		return dropFromGroups(tx, retired)
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		retired = nil
+	}
+	return
+}
+
+// retireTracks marks the tracks as replaced by the track keep and points
+// their playlist entries at it. Tracks replaced by one of them before are
+// pointed at keep too, and keep itself is no longer replaced.
+func retireTracks(tx *pg.Tx, keep int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.Model((*Track)(nil)).
+		Set("replaced_by = ?", keep).
+		Where("id IN (?) OR replaced_by IN (?)", pg.In(ids), pg.In(ids)).
+		Update()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*Track)(nil)).
+		Set("replaced_by = NULL").
+		Where("id = ?", keep).
+		Update()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*PlaylistTrack)(nil)).
+		Set("track_id = ?", keep).
+		Where("track_id IN (?)", pg.In(ids)).
+		Update()
+	return err
+}
+
+// dropFromGroups removes the tracks from the duplicate groups holding them
+func dropFromGroups(tx *pg.Tx, ids []int64) error {
+	var groups []DuplicateGroup
+	err := tx.Model(&groups).
+		Where("duplicate_group.track_ids && ?", pg.Array(ids)).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return err
+	}
+	for i := range groups {
+		g := &groups[i]
+		left := g.TrackIDs[:0]
+		for _, tid := range g.TrackIDs {
+			if !containsID(ids, tid) {
+				left = append(left, tid)
+			}
+		}
+		g.TrackIDs = left
+		if len(left) < 2 {
+			_, err = tx.Model(g).WherePK().Delete()
+		} else {
+			_, err = tx.Model(g).Column("track_ids").WherePK().Update()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// States of feed episodes
+const (
+	// EpisodePending is an episode waiting to be downloaded
+	EpisodePending = "pending"
+	// EpisodeDownloaded is an episode whose enclosure is imported as a
+	// track
+	EpisodeDownloaded = "downloaded"
+	// EpisodeFailed is an episode whose download or import failed, it's
+	// tried again on the next poll
+	EpisodeFailed = "failed"
+	// EpisodeSkipped is an episode that was already past the retention of
+	// it's feed when it was found
+	EpisodeSkipped = "skipped"
+	// EpisodeRemoved is an episode whose track was removed once it fell
+	// past the retention of it's feed
+	EpisodeRemoved = "removed"
+)
+
+// ErrBadRetention is returned for negative retention counts
+var ErrBadRetention = errors.New("retention must not be negative")
+
+// FeedSubscription is a podcast feed whose episodes are downloaded into the
+// library, see package feeds
+type FeedSubscription struct {
+	ID  int64
+	URL string `sql:",notnull"`
+	// Title and Author are taken from the feed when it's polled
+	Title  string
+	Author string
+	// Retention is how many of the newest episodes are kept, older ones
+	// have their tracks removed. Zero keeps every episode.
+	Retention int  `sql:",notnull"`
+	Enabled   bool `sql:",notnull"`
+	// ETag and LastModified are the validators of the last response, the
+	// feed is only sent again when it changed
+	ETag         string `sql:"etag"`
+	LastModified string
+	LastPolled   time.Time
+	// LastError is why the last poll failed, empty if it didn't
+	LastError string
+	Added     time.Time `sql:"default:now()"`
+	// Episodes are only loaded by GetFeedByID
+	Episodes []FeedEpisode `sql:"-"`
+}
+
+// FeedEpisode is an item of a feed, it's kept after the track of it's
+// enclosure is removed so it isn't downloaded again
+type FeedEpisode struct {
+	ID     int64
+	FeedID int64 `sql:",notnull"`
+	// GUID identifies the episode within it's feed
+	GUID         string `sql:",notnull"`
+	Title        string
+	Link         string
+	Published    time.Time
+	EnclosureURL string
+	Status       string `sql:",notnull"`
+	Error        string
+	// TrackID and Path are the track and file of a downloaded episode
+	TrackID    int64
+	Path       string
+	Downloaded time.Time
+}
+
+type FeedQuery struct {
+	DB orm.DB
+}
+
+// GetFeeds returns a page of feed subscriptions ordered by title
+func (fq *FeedQuery) GetFeeds(queryValues url.Values) (feeds []FeedSubscription, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	count, err = fq.DB.Model(&feeds).
+		Apply(urlvalues.Pagination(values)).
+		Order("feed_subscription.title ASC", "feed_subscription.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetEnabledFeeds returns every feed subscription that is polled
+func (fq *FeedQuery) GetEnabledFeeds() (feeds []FeedSubscription, err error) {
+	err = fq.DB.Model(&feeds).
+		Where("feed_subscription.enabled = true").
+		Order("feed_subscription.id ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetFeedByID returns a feed subscription with it's episodes, newest first
+func (fq *FeedQuery) GetFeedByID(id int64) (f *FeedSubscription, err error) {
+	f = new(FeedSubscription)
+	err = fq.DB.Model(f).Where("feed_subscription.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	f.Episodes, err = fq.GetEpisodes(id)
+	return
+}
+
+// AddFeed subscribes to the feed at feedURL keeping retention episodes
+func (fq *FeedQuery) AddFeed(feedURL, title string, retention int) (f *FeedSubscription, err error) {
+	if feedURL == "" {
+		err = errors.New("empty url")
+		return
+	}
+	if retention < 0 {
+		err = ErrBadRetention
+		return
+	}
+	f = &FeedSubscription{
+		URL:       feedURL,
+		Title:     title,
+		Retention: retention,
+		Enabled:   true,
+		Added:     time.Now(),
+	}
+	err = fq.DB.Insert(f)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// UpdateFeed sets the retention of the feed subscription with id and if
+// it's polled
+func (fq *FeedQuery) UpdateFeed(id int64, retention int, enabled bool) (f *FeedSubscription, err error) {
+	if retention < 0 {
+		err = ErrBadRetention
+		return
+	}
+	f = &FeedSubscription{ID: id, Retention: retention, Enabled: enabled}
+	res, err := fq.DB.Model(f).Column("retention", "enabled").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+		return
+	}
+	return fq.GetFeedByID(id)
+}
+
+// SavePoll stores what a poll learnt about the feed subscription
+func (fq *FeedQuery) SavePoll(f *FeedSubscription) (err error) {
+	_, err = fq.DB.Model(f).
+		Column("title", "author", "etag", "last_modified", "last_polled", "last_error").
+		WherePK().
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// DeleteFeedByID unsubscribes from a feed, the tracks of it's episodes are
+// kept
+func (fq *FeedQuery) DeleteFeedByID(id int64) (err error) {
+	f := &FeedSubscription{ID: id}
+	err = fq.DB.Delete(f)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetEpisodes returns the episodes of a feed subscription, newest first
+func (fq *FeedQuery) GetEpisodes(feedID int64) (episodes []FeedEpisode, err error) {
+	err = fq.DB.Model(&episodes).
+		Where("feed_episode.feed_id = ?", feedID).
+		Order("feed_episode.published DESC", "feed_episode.id DESC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// AddEpisodes stores episodes found in a feed, those already stored are
+// left as they are
+func (fq *FeedQuery) AddEpisodes(episodes []FeedEpisode) (err error) {
+	if len(episodes) == 0 {
+		return
+	}
+	_, err = fq.DB.Model(&episodes).OnConflict("(feed_id, guid) DO NOTHING").Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// UpdateEpisode stores the status of an episode with it's track and error
+func (fq *FeedQuery) UpdateEpisode(e *FeedEpisode) (err error) {
+	_, err = fq.DB.Model(e).
+		Column("status", "error", "track_id", "path", "downloaded").
+		WherePK().
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
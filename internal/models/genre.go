@@ -0,0 +1,96 @@
+package models
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Genre is a genre tracks are tagged with, genres are told apart by their
+// normalised names like artists
+type Genre struct {
+	ID int64
+	// Name is the name as first seen in a tag
+	Name     string
+	NormName string    `sql:",unique"`
+	Added    time.Time `sql:"default:now()"`
+}
+
+// TrackArtist links a track to one of the artists of it's artist tag,
+// Position is the order the artist is listed in starting from 0
+type TrackArtist struct {
+	TrackID  int64 `sql:",pk"`
+	ArtistID int64 `sql:",pk"`
+	Position int   `sql:",notnull"`
+}
+
+// TrackGenre links a track to one of the genres of it's genre tag
+type TrackGenre struct {
+	TrackID  int64 `sql:",pk"`
+	GenreID  int64 `sql:",pk"`
+	Position int   `sql:",notnull"`
+}
+
+type GenreQuery struct {
+	DB orm.DB
+}
+
+// GetGenreByID returns a genre from the database by it's id
+func (gq *GenreQuery) GetGenreByID(id int64) (g *Genre, err error) {
+	g = new(Genre)
+	err = gq.DB.Model(g).Where("genre.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetGenres returns a page of genres ordered by name, ?name__ieq=%rock%
+// filters them by name
+func (gq *GenreQuery) GetGenres(queryValues url.Values) (genres []Genre, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("name")
+	f.Allow("name__ieq")
+	count, err = gq.DB.Model(&genres).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("genre.norm_name ASC", "genre.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// FindOrAddGenre returns the genre for a name from a tag, adding it if no
+// genre has the same normalised name. An empty name has no genre and
+// returns nil.
+func (gq *GenreQuery) FindOrAddGenre(name string) (g *Genre, err error) {
+	norm := utils.NormalizeName(name)
+	if norm == "" {
+		return
+	}
+	g = &Genre{Name: name, NormName: norm}
+	_, err = gq.DB.Model(g).OnConflict("(norm_name) DO NOTHING").Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if g.ID != 0 {
+		return
+	}
+	err = gq.DB.Model(g).Where("genre.norm_name = ?", norm).Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
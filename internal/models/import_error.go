@@ -0,0 +1,220 @@
+package models
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// Classes of import errors
+const (
+	// ImportErrorUnsupported is a media file in a format that can't be
+	// imported
+	ImportErrorUnsupported = "unsupported"
+	// ImportErrorTags is a file whose tags could not be read
+	ImportErrorTags = "tags"
+	// ImportErrorIO is a file that could not be read at all
+	ImportErrorIO = "io"
+	// ImportErrorDatabase is a file whose track could not be stored
+	ImportErrorDatabase = "database"
+	// ImportErrorOther is anything else
+	ImportErrorOther = "other"
+)
+
+// ImportError records a file that failed to import and why. There is one
+// per path, it's updated each time the file fails again and removed once it
+// imports.
+type ImportError struct {
+	ID   int64
+	Path string `sql:",unique"`
+	// LibraryPathID is the library path holding the file, zero if it's
+	// outside all of them
+	LibraryPathID int64
+	Class         string
+	Message       string
+	// Attempts is how many times the import failed
+	Attempts int       `sql:",notnull"`
+	Added    time.Time `sql:"default:now()"`
+	// Occurred is when the import last failed
+	Occurred time.Time
+}
+
+// TagError is returned when the tags of a file can't be read
+type TagError struct {
+	Path string
+	Err  error
+}
+
+func (e *TagError) Error() string {
+	return "could not read tags of '" + e.Path + "': " + e.Err.Error()
+}
+
+// ImportErrorClass tells the class of an error importing a file
+func ImportErrorClass(err error) string {
+	switch err.(type) {
+	case *TagError:
+		return ImportErrorTags
+	case *os.PathError, *os.LinkError, *os.SyscallError:
+		return ImportErrorIO
+	case pg.Error:
+		return ImportErrorDatabase
+	}
+	return ImportErrorOther
+}
+
+type ImportErrorQuery struct {
+	DB orm.DB
+	// LibraryPaths are the library paths errors are filed under, when nil
+	// they are loaded on first use and kept
+	LibraryPaths []LibraryPath
+}
+
+// GetImportErrors returns a page of the import errors of a library path,
+// most recent first. ?class= filters them by class.
+func (ieq *ImportErrorQuery) GetImportErrors(libraryPathID int64, queryValues url.Values) (errs []ImportError, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("class")
+	count, err = ieq.DB.Model(&errs).
+		Where("import_error.library_path_id = ?", libraryPathID).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("import_error.occurred DESC", "import_error.id ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetImportErrorsByIDs returns the import errors of a library path with the
+// given ids, or all of them if ids is empty
+func (ieq *ImportErrorQuery) GetImportErrorsByIDs(libraryPathID int64, ids []int64) (errs []ImportError, err error) {
+	q := ieq.DB.Model(&errs).
+		Where("import_error.library_path_id = ?", libraryPathID).
+		Order("import_error.id ASC")
+	if len(ids) > 0 {
+		q = q.Where("import_error.id IN (?)", pg.In(ids))
+	}
+	err = q.Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// Record stores the failure to import the file at path, counting another
+// attempt if it failed before. See ImportErrorClass for the class.
+func (ieq *ImportErrorQuery) Record(path, class string, cause error) (ie *ImportError, err error) {
+	paths, err := loadLibraryPaths(ieq.DB, &ieq.LibraryPaths)
+	if err != nil {
+		return
+	}
+	var libraryPathID int64
+	if lp := libraryPathFor(paths, path); lp != nil {
+		libraryPathID = lp.ID
+	}
+	ie = &ImportError{
+		Path:          path,
+		LibraryPathID: libraryPathID,
+		Class:         class,
+		Message:       cause.Error(),
+		Attempts:      1,
+		Added:         time.Now(),
+		Occurred:      time.Now(),
+	}
+	_, err = ieq.DB.Model(ie).
+		OnConflict("(path) DO UPDATE").
+		Set("library_path_id = EXCLUDED.library_path_id").
+		Set("class = EXCLUDED.class").
+		Set("message = EXCLUDED.message").
+		Set("occurred = EXCLUDED.occurred").
+		Set("attempts = import_error.attempts + 1").
+		Returning("*").
+		Insert()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// ClearPaths removes the import errors of files that imported
+func (ieq *ImportErrorQuery) ClearPaths(paths []string) (err error) {
+	if len(paths) == 0 {
+		return
+	}
+	_, err = ieq.DB.Model((*ImportError)(nil)).
+		Where("path IN (?)", pg.In(paths)).
+		Delete()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// ClearPath removes the import errors of path and of any file under it if
+// it's a directory, used when they are removed
+func (ieq *ImportErrorQuery) ClearPath(path string) (count int, err error) {
+	res, err := ieq.DB.Model((*ImportError)(nil)).
+		Where("path = ?", path).
+		WhereOr("path LIKE ?", dirPrefixPattern(path)).
+		Delete()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
+
+// ClearByIDs removes the import errors with the given ids
+func (ieq *ImportErrorQuery) ClearByIDs(ids []int64) (count int, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	res, err := ieq.DB.Model((*ImportError)(nil)).
+		Where("id IN (?)", pg.In(ids)).
+		Delete()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
+
+// loadLibraryPaths returns *paths, loading every library path into it
+// first when it's nil
+func loadLibraryPaths(db orm.DB, paths *[]LibraryPath) ([]LibraryPath, error) {
+	if *paths != nil {
+		return *paths, nil
+	}
+	all := []LibraryPath{}
+	if err := db.Model(&all).Select(); err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return nil, err
+	}
+	*paths = all
+	return all, nil
+}
+
+// libraryPathFor returns the innermost of paths holding the file at path,
+// or nil if there is none
+func libraryPathFor(paths []LibraryPath, path string) (lp *LibraryPath) {
+	longest := 0
+	for i := range paths {
+		root, aerr := paths[i].Root()
+		if aerr != nil || !paths[i].Contains(root, path) {
+			continue
+		}
+		if len(root) > longest {
+			lp, longest = &paths[i], len(root)
+		}
+	}
+	return
+}
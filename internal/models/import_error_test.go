@@ -0,0 +1,32 @@
+package models
+
+import "testing"
+
+func TestLibraryPathFor(t *testing.T) {
+	paths := []LibraryPath{
+		{ID: 1, Path: "/music"},
+		{ID: 2, Path: "/music/uploads"},
+		{ID: 3, Path: "s3://bucket/shows/"},
+	}
+	tests := []struct {
+		path string
+		id   int64
+	}{
+		{"/music/a.mp3", 1},
+		// nested library paths file under the innermost
+		{"/music/uploads/b.mp3", 2},
+		{"/music/uploads2/c.mp3", 1},
+		{"/musical/d.mp3", 0},
+		{"s3://bucket/shows/e.mp3", 3},
+		{"s3://bucket/showsx/f.mp3", 0},
+	}
+	for _, test := range tests {
+		var id int64
+		if lp := libraryPathFor(paths, test.path); lp != nil {
+			id = lp.ID
+		}
+		if id != test.id {
+			t.Errorf("%s: library path %d, want %d", test.path, id, test.id)
+		}
+	}
+}
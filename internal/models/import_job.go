@@ -0,0 +1,218 @@
+package models
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// States of an import job
+const (
+	// JobQueued is a job waiting for the media monitor to pick it up
+	JobQueued = "queued"
+	// JobRunning is a job the media monitor is working on
+	JobRunning = "running"
+	// JobDone is a job that finished
+	JobDone = "done"
+	// JobFailed is a job that was stopped by an error
+	JobFailed = "failed"
+)
+
+// ImportJob is a scan of a library path, it's counters are updated by the
+// media monitor as the scan runs
+type ImportJob struct {
+	ID            int64
+	LibraryPathID int64
+	Status        string
+	// Seen is the number of media files found so far, the rest count what
+	// became of them, see importer.Progress
+	Seen        int64 `sql:",notnull"`
+	Imported    int64 `sql:",notnull"`
+	Updated     int64 `sql:",notnull"`
+	Skipped     int64 `sql:",notnull"`
+	Errored     int64 `sql:",notnull"`
+	Unsupported int64 `sql:",notnull"`
+	// Error is why a failed job failed
+	Error    string
+	Queued   time.Time `sql:"default:now()"`
+	Started  time.Time
+	Finished time.Time
+}
+
+// jobCounterColumns are the columns of the job counters
+var jobCounterColumns = []string{"seen", "imported", "updated", "skipped", "errored", "unsupported"}
+
+type ImportJobQuery struct {
+	DB orm.DB
+}
+
+// GetImportJobs returns a page of import jobs, newest first.
+// ?library_path_id= and ?status= filter them.
+func (ijq *ImportJobQuery) GetImportJobs(queryValues url.Values) (jobs []ImportJob, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("library_path_id")
+	f.Allow("status")
+	count, err = ijq.DB.Model(&jobs).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("import_job.id DESC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+func (ijq *ImportJobQuery) GetImportJobByID(id int64) (job *ImportJob, err error) {
+	job = new(ImportJob)
+	err = ijq.DB.Model(job).Where("import_job.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// QueueJob queues a scan of the library path with the given id for the
+// media monitor. If one is already queued it's returned instead of queueing
+// another. It returns pg.ErrNoRows if there is no such library path.
+func (ijq *ImportJobQuery) QueueJob(libraryPathID int64) (job *ImportJob, err error) {
+	err = runInTransaction(ijq.DB, func(tx *pg.Tx) error {
+		lp := new(LibraryPath)
+		err := tx.Model(lp).Column("id").Where("id = ?", libraryPathID).For("UPDATE").Select()
+		if err != nil {
+			return err
+		}
+		job = new(ImportJob)
+		err = tx.Model(job).
+			Where("library_path_id = ?", libraryPathID).
+			Where("status = ?", JobQueued).
+			Limit(1).
+			Select()
+		if err != pg.ErrNoRows {
+			return err
+		}
+		job = &ImportJob{
+			LibraryPathID: libraryPathID,
+			Status:        JobQueued,
+			Queued:        time.Now(),
+		}
+		return tx.Insert(job)
+	})
+	if err != nil && err != pg.ErrNoRows {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// StartJob adds a running job for a scan of the library path that wasn't
+// queued, like the scheduled ones
+func (ijq *ImportJobQuery) StartJob(libraryPathID int64) (job *ImportJob, err error) {
+	now := time.Now()
+	job = &ImportJob{
+		LibraryPathID: libraryPathID,
+		Status:        JobRunning,
+		Queued:        now,
+		Started:       now,
+	}
+	err = ijq.DB.Insert(job)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// ClaimJob marks the oldest queued job running and returns it, or nil if
+// none are queued
+func (ijq *ImportJobQuery) ClaimJob() (job *ImportJob, err error) {
+	err = runInTransaction(ijq.DB, func(tx *pg.Tx) error {
+		job = new(ImportJob)
+		err := tx.Model(job).
+			Where("status = ?", JobQueued).
+			Order("id ASC").
+			Limit(1).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil {
+			return err
+		}
+		job.Status = JobRunning
+		job.Started = time.Now()
+		_, err = tx.Model(job).Column("status", "started").WherePK().Update()
+		return err
+	})
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// UpdateProgress writes the counters of a running job
+func (ijq *ImportJobQuery) UpdateProgress(job *ImportJob) (err error) {
+	_, err = ijq.DB.Model(job).Column(jobCounterColumns...).WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// FinishJob writes the final counters of a job and marks it done, or
+// failed if cause isn't nil
+func (ijq *ImportJobQuery) FinishJob(job *ImportJob, cause error) (err error) {
+	job.finish(cause, time.Now())
+	columns := append([]string{"status", "error", "finished"}, jobCounterColumns...)
+	_, err = ijq.DB.Model(job).Column(columns...).WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// finish marks the job done at now, or failed if cause isn't nil
+func (job *ImportJob) finish(cause error, now time.Time) {
+	job.Status = JobDone
+	if cause != nil {
+		job.Status = JobFailed
+		job.Error = cause.Error()
+	}
+	job.Finished = now
+}
+
+// FailRunningJobs marks every running job failed, used when the media
+// monitor starts as jobs left running were cut short
+func (ijq *ImportJobQuery) FailRunningJobs(reason string) (count int, err error) {
+	res, err := ijq.DB.Model((*ImportJob)(nil)).
+		Set("status = ?", JobFailed).
+		Set("error = ?", reason).
+		Set("finished = now()").
+		Where("status = ?", JobRunning).
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
+
+// PruneJobs deletes the jobs that finished before cutoff, queued and
+// running jobs are kept
+func (ijq *ImportJobQuery) PruneJobs(cutoff time.Time) (count int, err error) {
+	res, err := ijq.DB.Model((*ImportJob)(nil)).
+		Where("status IN (?)", pg.In([]string{JobDone, JobFailed})).
+		Where("finished < ?", cutoff).
+		Delete()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
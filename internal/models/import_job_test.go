@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFinishJob(t *testing.T) {
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		cause  error
+		status string
+		err    string
+	}{
+		{"done", nil, JobDone, ""},
+		{"failed", errors.New("disk gone"), JobFailed, "disk gone"},
+	}
+	for _, test := range tests {
+		job := &ImportJob{Status: JobRunning, Seen: 3}
+		job.finish(test.cause, now)
+		if job.Status != test.status || job.Error != test.err {
+			t.Errorf("%s: status %q error %q", test.name, job.Status, job.Error)
+		}
+		if !job.Finished.Equal(now) {
+			t.Errorf("%s: finished %s", test.name, job.Finished)
+		}
+		if job.Seen != 3 {
+			t.Errorf("%s: counters changed", test.name)
+		}
+	}
+}
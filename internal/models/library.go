@@ -2,15 +2,16 @@ package models
 
 import (
 	"errors"
-	"fmt"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-pg/pg"
 	//"github.com/go-pg/pg/orm"
 	"github.com/go-pg/pg/urlvalues"
 	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/storage"
 	"github.com/ryex/go-broadcaster/internal/utils"
 )
 
@@ -20,21 +21,55 @@ type LibraryPath struct {
 	Added     time.Time `sql:"default:now()"`
 	LastIndex time.Time
 	Indexing  bool
+	// Ignore are gitignore style patterns for files and directories left
+	// out of the library, on top of those in utils.IgnoreFileName files
+	Ignore []string `sql:",array"`
+	// Managed is set on library paths gobcast writes files into, like
+	// uploads, rather than only reading them
+	Managed bool `sql:",notnull"`
+	// Organise has the files of a managed library path moved into Layout
+	// after each scan, see package organise. The default layout is used
+	// when Layout is empty.
+	Organise bool `sql:",notnull"`
+	Layout   string
+	// WriteTags has tag edits made to tracks in the library path written
+	// back to their files, see TrackQuery.EditTrack
+	WriteTags bool `sql:",notnull"`
 }
 
-func (fp LibraryPath) SearchWalk(extensions []string, cb utils.SearchFunc) error {
-	rootPath, aerr := filepath.Abs(fp.Path)
-	if aerr != nil {
-		fmt.Println("could not get an absolute path")
-		return aerr
+// Remote tests if the library path is a prefix in an object store rather
+// than a local directory, see package storage
+func (fp LibraryPath) Remote() bool {
+	return storage.IsRemote(fp.Path)
+}
+
+// Root returns the absolute path of the library path, or it's URL without a
+// trailing slash when it's remote
+func (fp LibraryPath) Root() (string, error) {
+	if fp.Remote() {
+		return strings.TrimSuffix(fp.Path, "/"), nil
+	}
+	return filepath.Abs(fp.Path)
+}
+
+// Contains tests if path is inside the library path with root
+func (fp LibraryPath) Contains(root, path string) bool {
+	sep := string(filepath.Separator)
+	if fp.Remote() {
+		sep = "/"
 	}
+	return path == root || strings.HasPrefix(path, root+sep)
+}
 
-	werr := utils.WalkSearch(rootPath, extensions, cb)
-	if werr != nil {
-		fmt.Println("error in search walk")
-		return werr
+// IgnoreRules builds the rules deciding which files under the library path
+// are left out. Remote library paths only have their patterns, ignore files
+// are not read from object stores.
+func (fp LibraryPath) IgnoreRules() (*utils.Ignore, error) {
+	if fp.Remote() {
+		root, _ := fp.Root()
+		return utils.NewPatternIgnore(root, fp.Ignore)
 	}
-	return nil
+	return utils.NewIgnore(fp.Path, fp.Ignore)
 }
 
 type LibraryPathQuery struct {
@@ -52,6 +87,15 @@ func (lpq *LibraryPathQuery) GetLibraryPaths(queryValues url.Values) (paths []Li
 	return
 }
 
+// GetAllLibraryPaths returns every library path in the database
+func (lpq *LibraryPathQuery) GetAllLibraryPaths() (paths []LibraryPath, err error) {
+	err = lpq.DB.Model(&paths).Order("library_path.id ASC").Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
 func (lpq *LibraryPathQuery) GetLibraryPathByID(id int64) (lp *LibraryPath, err error) {
 	lp = new(LibraryPath)
 	err = lpq.DB.Model(lp).Where("library_path.id = ?", id).Select()
@@ -77,6 +121,144 @@ func (lpq *LibraryPathQuery) AddLibraryPath(path string) (lp *LibraryPath, err e
 	return
 }
 
+// Update uses the model to update the corasponding library path in the database
+func (lpq *LibraryPathQuery) Update(path *LibraryPath) (lp *LibraryPath, err error) {
+	lp = path
+	err = lpq.DB.Update(lp)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// StartIndexing flags the library path as being indexed
+func (lpq *LibraryPathQuery) StartIndexing(lp *LibraryPath) (err error) {
+	lp.Indexing = true
+	_, err = lpq.DB.Model(lp).Column("indexing").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// FinishIndexing clears the indexing flag on the library path and stamps
+// the time the index finished
+func (lpq *LibraryPathQuery) FinishIndexing(lp *LibraryPath) (err error) {
+	lp.Indexing = false
+	lp.LastIndex = time.Now()
+	_, err = lpq.DB.Model(lp).Column("indexing", "last_index").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// AbortIndexing clears the indexing flag on the library path without
+// stamping the index time, used when an index did not finish
+func (lpq *LibraryPathQuery) AbortIndexing(lp *LibraryPath) (err error) {
+	lp.Indexing = false
+	_, err = lpq.DB.Model(lp).Column("indexing").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// SetIgnore replaces the ignore patterns of the library path with the given
+// id, the patterns must be valid
+func (lpq *LibraryPathQuery) SetIgnore(id int64, patterns []string) (lp *LibraryPath, err error) {
+	err = utils.ValidateIgnorePatterns(patterns)
+	if err != nil {
+		return
+	}
+	lp = &LibraryPath{ID: id, Ignore: patterns}
+	res, err := lpq.DB.Model(lp).Column("ignore").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+		return
+	}
+	return lpq.GetLibraryPathByID(id)
+}
+
+// FindOrAddManaged returns the library path of the directory dir, adding it
+// if there is none, and makes sure it's flagged as managed
+func (lpq *LibraryPathQuery) FindOrAddManaged(dir string) (lp *LibraryPath, err error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	paths, err := lpq.GetAllLibraryPaths()
+	if err != nil {
+		return
+	}
+	for i := range paths {
+		if p, aerr := filepath.Abs(paths[i].Path); aerr == nil && p == root {
+			lp = &paths[i]
+			break
+		}
+	}
+	if lp == nil {
+		lp, err = lpq.AddLibraryPath(root)
+		if err != nil {
+			return
+		}
+	}
+	if lp.Managed {
+		return
+	}
+	lp.Managed = true
+	_, err = lpq.DB.Model(lp).Column("managed").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// ErrNotManaged is returned when organising a library path that isn't
+// managed
+var ErrNotManaged = errors.New("library path is not managed")
+
+// SetOrganise turns organising the library path with the given id on or
+// off and sets it's layout, only managed library paths can be organised.
+// The layout must have been validated.
+func (lpq *LibraryPathQuery) SetOrganise(id int64, organise bool, layout string) (lp *LibraryPath, err error) {
+	lp, err = lpq.GetLibraryPathByID(id)
+	if err != nil {
+		return
+	}
+	if organise && !lp.Managed {
+		err = ErrNotManaged
+		return
+	}
+	lp.Organise = organise
+	lp.Layout = layout
+	_, err = lpq.DB.Model(lp).Column("organise", "layout").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// SetWriteTags sets if tag edits are written back to the files of the
+// library path
+func (lpq *LibraryPathQuery) SetWriteTags(id int64, write bool) (lp *LibraryPath, err error) {
+	lp = &LibraryPath{ID: id, WriteTags: write}
+	res, err := lpq.DB.Model(lp).Column("write_tags").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+		return
+	}
+	return lpq.GetLibraryPathByID(id)
+}
+
 func (lpq *LibraryPathQuery) DeleteLibraryPathByID(id int64) (err error) {
 	lp := new(LibraryPath)
 	_, err = lpq.DB.Model(lp).Where("library_path.id = ?", id).Delete()
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/urlvalues"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// Playlist is a named list of tracks in order
+type Playlist struct {
+	ID          int64
+	Name        string
+	Description string
+	Added       time.Time `sql:"default:now()"`
+	Updated     time.Time `sql:"default:now()"`
+	// Source is the path of the playlist file the playlist was imported
+	// from, with the modification time and size the file had then. It's
+	// empty for playlists made by hand or uploaded.
+	Source      string
+	SourceMtime time.Time
+	SourceSize  int64
+	// Tracks are the entries of the playlist, only loaded by
+	// GetPlaylistByID
+	Tracks []PlaylistTrack `sql:"-"`
+	// Unresolved are the entries of an imported playlist file that
+	// matched no track, only loaded by GetPlaylistByID
+	Unresolved []UnresolvedEntry `sql:"-"`
+}
+
+// PlaylistTrack is an entry of a playlist, Position orders the entries
+// from zero
+type PlaylistTrack struct {
+	ID         int64
+	PlaylistID int64 `sql:",notnull"`
+	TrackID    int64 `sql:",notnull"`
+	Position   int   `sql:",notnull"`
+	Track      *Track
+	// Location is the path or URL of the entry as written in the playlist
+	// file it was imported from
+	Location string
+	// Manual is set when the entry was matched to it's track by hand
+	Manual bool `sql:",notnull"`
+}
+
+// UnresolvedEntry is an entry of an imported playlist file that matched no
+// track, it's kept to be matched by hand. Position is where the entry goes
+// among the tracks of the playlist.
+type UnresolvedEntry struct {
+	ID         int64
+	PlaylistID int64 `sql:",notnull"`
+	Position   int   `sql:",notnull"`
+	// Location is the path or URL of the entry as written in the file
+	Location string
+	Title    string
+	Artist   string
+	Album    string
+	Length   time.Duration
+}
+
+// SourceUnchanged tests if the file the playlist was imported from still
+// has the modification time and size it had then
+func (p *Playlist) SourceUnchanged(info os.FileInfo) bool {
+	return p.SourceSize == info.Size() &&
+		p.SourceMtime.Equal(info.ModTime().Truncate(time.Microsecond))
+}
+
+type PlaylistQuery struct {
+	DB orm.DB
+}
+
+// GetPlaylists returns a page of playlists, ?name= filters them
+func (pq *PlaylistQuery) GetPlaylists(queryValues url.Values) (playlists []Playlist, count int, err error) {
+	values := urlvalues.Values(queryValues)
+	f := urlvalues.NewFilter(values)
+	f.Allow("name")
+	f.Allow("name__ieq")
+	count, err = pq.DB.Model(&playlists).
+		Apply(f.Filters).
+		Apply(urlvalues.Pagination(values)).
+		Order("playlist.name ASC").
+		SelectAndCount()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetPlaylistByID returns a playlist with it's entries and their tracks
+func (pq *PlaylistQuery) GetPlaylistByID(id int64) (p *Playlist, err error) {
+	p = new(Playlist)
+	err = pq.DB.Model(p).Where("playlist.id = ?", id).Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	err = pq.DB.Model(&p.Tracks).
+		Relation("Track").
+		Where("playlist_track.playlist_id = ?", id).
+		Order("playlist_track.position ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	p.Unresolved, err = pq.GetUnresolved(id)
+	return
+}
+
+// GetPlaylistBySource returns the playlist imported from the playlist file
+// at path
+func (pq *PlaylistQuery) GetPlaylistBySource(path string) (p *Playlist, err error) {
+	p = new(Playlist)
+	err = pq.DB.Model(p).Where("playlist.source = ?", path).Select()
+	if err != nil && err != pg.ErrNoRows {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetUnresolved returns the unresolved entries of a playlist in order
+func (pq *PlaylistQuery) GetUnresolved(id int64) (entries []UnresolvedEntry, err error) {
+	err = pq.DB.Model(&entries).
+		Where("unresolved_entry.playlist_id = ?", id).
+		Order("unresolved_entry.position ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// SaveImport stores an imported playlist with it's tracks and unresolved
+// entries and returns them as stored. A playlist that was stored before has
+// it's name and source updated and it's entries replaced, unresolved
+// entries that were matched by hand keep their track.
+func (pq *PlaylistQuery) SaveImport(p *Playlist, tracks []PlaylistTrack, unresolved []UnresolvedEntry) (saved []PlaylistTrack, rest []UnresolvedEntry, err error) {
+	err = runInTransaction(pq.DB, func(tx *pg.Tx) error {
+		saved, rest = tracks, unresolved
+		p.Updated = time.Now()
+		if p.ID == 0 {
+			p.Added = p.Updated
+			if err := tx.Insert(p); err != nil {
+				return err
+			}
+		} else {
+			_, err := tx.Model(p).
+				Column("name", "source", "source_mtime", "source_size", "updated").
+				WherePK().
+				Update()
+			if err != nil {
+				return err
+			}
+			var manual []PlaylistTrack
+			err = tx.Model(&manual).
+				Where("playlist_track.playlist_id = ?", p.ID).
+				Where("playlist_track.manual").
+				Select()
+			if err != nil {
+				return err
+			}
+			saved, rest = keepMatches(tracks, unresolved, manual)
+			if _, err = tx.Model((*PlaylistTrack)(nil)).Where("playlist_id = ?", p.ID).Delete(); err != nil {
+				return err
+			}
+			if _, err = tx.Model((*UnresolvedEntry)(nil)).Where("playlist_id = ?", p.ID).Delete(); err != nil {
+				return err
+			}
+		}
+		for i := range saved {
+			saved[i].PlaylistID = p.ID
+		}
+		for i := range rest {
+			rest[i].PlaylistID = p.ID
+		}
+		if len(saved) > 0 {
+			if _, err := tx.Model(&saved).Insert(); err != nil {
+				return err
+			}
+		}
+		if len(rest) > 0 {
+			if _, err := tx.Model(&rest).Insert(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// keepMatches gives the unresolved entries of a playlist file that is
+// imported again the tracks their entries were matched to by hand before.
+// Entries are paired by their location, or by their position if they have
+// none. The tracks with those added in order and the entries that are
+// still unresolved are returned.
+func keepMatches(tracks []PlaylistTrack, unresolved []UnresolvedEntry, manual []PlaylistTrack) ([]PlaylistTrack, []UnresolvedEntry) {
+	kept := append([]PlaylistTrack(nil), tracks...)
+	var rest []UnresolvedEntry
+	used := make([]bool, len(manual))
+	for _, ue := range unresolved {
+		found := -1
+		for i, m := range manual {
+			if used[i] || m.Location != ue.Location {
+				continue
+			}
+			if ue.Location == "" && m.Position != ue.Position {
+				continue
+			}
+			found = i
+			break
+		}
+		if found < 0 {
+			rest = append(rest, ue)
+			continue
+		}
+		used[found] = true
+		kept = append(kept, PlaylistTrack{
+			TrackID:  manual[found].TrackID,
+			Position: ue.Position,
+			Location: ue.Location,
+			Manual:   true,
+		})
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Position < kept[j].Position })
+	return kept, rest
+}
+
+// MatchUnresolved puts the track with trackID in the place of the
+// unresolved entry with entryID of the playlist with id, manual tells if
+// it's matched by hand and is kept when the playlist file changes
+func (pq *PlaylistQuery) MatchUnresolved(id, entryID, trackID int64, manual bool) (pt *PlaylistTrack, err error) {
+	err = runInTransaction(pq.DB, func(tx *pg.Tx) error {
+		entry := new(UnresolvedEntry)
+		err := tx.Model(entry).
+			Where("unresolved_entry.id = ?", entryID).
+			Where("unresolved_entry.playlist_id = ?", id).
+			For("UPDATE").
+			Select()
+		if err != nil {
+			return err
+		}
+		pt = &PlaylistTrack{
+			PlaylistID: id,
+			TrackID:    trackID,
+			Position:   entry.Position,
+			Location:   entry.Location,
+			Manual:     manual,
+		}
+		if err = tx.Insert(pt); err != nil {
+			return err
+		}
+		if err = tx.Delete(entry); err != nil {
+			return err
+		}
+		_, err = tx.Model((*Playlist)(nil)).
+			Set("updated = now()").
+			Where("id = ?", id).
+			Update()
+		return err
+	})
+	if err != nil && err != pg.ErrNoRows {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// DeletePlaylistByID deletes a playlist and it's entries
+func (pq *PlaylistQuery) DeletePlaylistByID(id int64) (err error) {
+	p := &Playlist{ID: id}
+	err = pq.DB.Delete(p)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeepMatches(t *testing.T) {
+	manual := []PlaylistTrack{
+		{TrackID: 10, Position: 1, Location: "b.mp3", Manual: true},
+		{TrackID: 11, Position: 3, Manual: true},
+		{TrackID: 12, Position: 4, Location: "gone.mp3", Manual: true},
+	}
+	tracks := []PlaylistTrack{
+		{TrackID: 1, Position: 0, Location: "a.mp3"},
+		{TrackID: 2, Position: 2, Location: "c.mp3"},
+	}
+
+	tests := []struct {
+		name       string
+		unresolved []UnresolvedEntry
+		tracks     []int64
+		rest       []int
+	}{
+		{"nothing unresolved", nil, []int64{1, 2}, nil},
+		// an entry that moved is found by it's location
+		{"moved", []UnresolvedEntry{{Position: 5, Location: "b.mp3"}}, []int64{1, 2, 10}, nil},
+		// entries without a location are only kept where they were
+		{"no location", []UnresolvedEntry{{Position: 3}}, []int64{1, 2, 11}, nil},
+		{"no location moved", []UnresolvedEntry{{Position: 5}}, []int64{1, 2}, []int{5}},
+		{"new entry", []UnresolvedEntry{{Position: 1, Location: "d.mp3"}}, []int64{1, 2}, []int{1}},
+		// a match is used once
+		{"twice", []UnresolvedEntry{
+			{Position: 1, Location: "b.mp3"},
+			{Position: 3, Location: "b.mp3"},
+		}, []int64{1, 10, 2}, []int{3}},
+	}
+	for _, test := range tests {
+		kept, rest := keepMatches(tracks, test.unresolved, manual)
+		var ids []int64
+		for _, pt := range kept {
+			ids = append(ids, pt.TrackID)
+		}
+		if !reflect.DeepEqual(ids, test.tracks) {
+			t.Errorf("%s: tracks %v, want %v", test.name, ids, test.tracks)
+		}
+		var positions []int
+		for _, ue := range rest {
+			positions = append(positions, ue.Position)
+		}
+		if !reflect.DeepEqual(positions, test.rest) {
+			t.Errorf("%s: unresolved at %v, want %v", test.name, positions, test.rest)
+		}
+		for _, pt := range kept {
+			if pt.TrackID >= 10 && !pt.Manual {
+				t.Errorf("%s: kept match of track %d isn't manual", test.name, pt.TrackID)
+			}
+		}
+	}
+}
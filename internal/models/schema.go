@@ -17,7 +17,21 @@ func init() {
 // Models is a slice listing all modles present for use in Schema operations
 var Models = []interface{}{
 	(*LibraryPath)(nil),
+	(*Artwork)(nil),
+	(*Artist)(nil),
+	(*Album)(nil),
+	(*Genre)(nil),
 	(*Track)(nil),
+	(*TrackArtist)(nil),
+	(*TrackGenre)(nil),
+	(*ImportError)(nil),
+	(*ImportJob)(nil),
+	(*Playlist)(nil),
+	(*PlaylistTrack)(nil),
+	(*UnresolvedEntry)(nil),
+	(*DuplicateGroup)(nil),
+	(*FeedSubscription)(nil),
+	(*FeedEpisode)(nil),
 	(*User)(nil),
 	(*Role)(nil),
 	(*UserToRole)(nil),
@@ -4,12 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-pg/pg"
-	//"github.com/go-pg/pg/orm"
+	"github.com/go-pg/pg/orm"
 	"github.com/go-pg/pg/urlvalues"
 	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/tags"
+	"github.com/ryex/go-broadcaster/internal/utils"
 	taglib "github.com/wtolson/go-taglib"
 )
 
@@ -26,17 +31,85 @@ type Track struct {
 	Samplerate int
 	Path       string
 	Added      time.Time `sql:"default:now()"`
+	// Format and Codec are the container and codec sniffed from the
+	// content of the file, see audio.Sniff
+	Format string
+	Codec  string
+	// extended tags
+	TrackNumber int
+	DiscNumber  int
+	AlbumArtist string
+	Composer    string
+	Publisher   string
+	ISRC        string  `sql:"isrc"`
+	BPM         float64 `sql:"bpm"`
+	Comment     string
+	Copyright   string
+	Language    string
+	Mtime       time.Time
+	Size        int64
+	FastHash    string
+	SHA256      string `sql:"sha256"`
+	// Missing is set when the file of the track can no longer be found,
+	// missing tracks must not be scheduled
+	Missing      bool `sql:",notnull"`
+	MissingSince time.Time
+	// Loudness is the integrated loudness in LUFS, LoudnessRange the
+	// loudness range in LU and TruePeak the true peak in dBTP, measured per
+	// EBU R128. Gain is the gain in dB the playout applies to level the
+	// track. AnalyzedAt stays zero until the track has been measured.
+	// AnalysisError is why the file could not be measured, it isn't tried
+	// again until the file changes.
+	Loudness      float64
+	LoudnessRange float64
+	TruePeak      float64
+	Gain          float64
+	AnalyzedAt    time.Time
+	AnalysisError string
+	// CueIn and CueOut are the offsets the track is played from and to,
+	// detected from it's leading and trailing silence unless CueManual is
+	// set. A zero CueOut plays the track to the end.
+	CueIn     time.Duration
+	CueOut    time.Duration
+	CueManual bool `sql:",notnull"`
+	// Waveform is the path of the track's waveform peaks relative to the
+	// data directory, empty until they are generated
+	Waveform string
+	// ArtworkID is the cover art of the track, ArtworkChecked is set once
+	// the file and it's directory have been searched for it
+	ArtworkID      int64
+	ArtworkChecked bool `sql:",notnull"`
+	// ArtistID and AlbumID link the track to the Artist and Album of it's
+	// artist and album tags
+	ArtistID int64
+	AlbumID  int64
+	// Artists and Genres are each of the artists and genres in the artist
+	// and genre tags, the track is linked to all of them through
+	// TrackArtist and TrackGenre
+	Artists []string `sql:",array"`
+	Genres  []string `sql:",array"`
+	// ReplacedBy is the track that replaced this one when it was retired
+	// as a duplicate, see DuplicateGroupQuery.Resolve. Retired tracks must
+	// not be scheduled.
+	ReplacedBy int64
+	// EditedFields are the edit fields set by hand with EditTrack, they
+	// keep their values when the track is read again from it's file
+	EditedFields []string `sql:",array"`
 }
 
-func NewTrack(path string) (t *Track, err error) {
-	t = new(Track)
+// NewTrack reads the tags of the file at path into a new track, splitting
+// it's artists and genres on separators. It returns a TagError if the tags
+// can't be read.
+func NewTrack(path string, separators []string) (t *Track, err error) {
 	file, err := taglib.Read(path)
 	if err != nil {
 		logutils.Log.Error("Could not open file", err)
+		err = &TagError{Path: path, Err: err}
 		return
 	}
 	defer file.Close()
 
+	t = new(Track)
 	t.Path = path
 	t.Title = file.Title()
 	t.Album = file.Album()
@@ -48,16 +121,88 @@ func NewTrack(path string) (t *Track, err error) {
 	t.Length = file.Length()
 	t.Samplerate = file.Samplerate()
 	t.Added = time.Now()
+	t.Artists = tags.SplitOn(separators, t.Artist)
+	t.Genres = tags.SplitOn(separators, t.Genre)
+
+	ext, err := tags.Read(path, separators)
+	if err != nil {
+		// the basic tags are still worth having
+		logutils.Log.Error("Could not read extended tags", path, err)
+		err = nil
+		return
+	}
+	t.TrackNumber = ext.TrackNumber
+	t.DiscNumber = ext.DiscNumber
+	t.AlbumArtist = ext.AlbumArtist
+	t.Composer = ext.Composer
+	t.Publisher = ext.Publisher
+	t.ISRC = ext.ISRC
+	t.BPM = ext.BPM
+	t.Comment = ext.Comment
+	t.Copyright = ext.Copyright
+	t.Language = ext.Language
+	// the values as stored in the file are split better than taglib's
+	if len(ext.Artists) > 0 {
+		t.Artists = ext.Artists
+	}
+	if len(ext.Genres) > 0 {
+		t.Genres = ext.Genres
+	}
+	return
+}
+
+// Fingerprint stats the file of the track and records it's modification
+// time, size and fast hash
+func (t *Track) Fingerprint() (err error) {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return
+	}
+	hash, err := utils.FastHash(t.Path)
+	if err != nil {
+		return
+	}
+	// the database only stores microseconds
+	t.Mtime = info.ModTime().Truncate(time.Microsecond)
+	t.Size = info.Size()
+	t.FastHash = hash
 	return
 }
 
+// Unchanged tests if the file of the track still has the modification time
+// and size that where recorded for it
+func (t *Track) Unchanged(info os.FileInfo) bool {
+	return t.Size == info.Size() &&
+		t.Mtime.Equal(info.ModTime().Truncate(time.Microsecond))
+}
+
 func (t Track) String() string {
 	return fmt.Sprintf("{ Title: %v, Album: %v, Genre: %v, Year: %v, Length: %v, Bitrate: %v, Channels: %v, Samplerate: %v, Path: %v}",
 		t.Title, t.Album, t.Genre, t.Year, t.Length, t.Bitrate, t.Channels, t.Samplerate, t.Path)
 }
 
+// Available filters a track query down to the tracks that can be played,
+// any query used for scheduling should apply it.
+func Available(q *orm.Query) (*orm.Query, error) {
+	return q.Where("track.missing = false").Where("track.replaced_by IS NULL"), nil
+}
+
 type TrackQuery struct {
 	DB *pg.DB
+	// Separators split the artist and genre tags of the tracks read and
+	// edited, tags.Separators when nil
+	Separators []string
+	// LibraryPaths are the library paths the tracks are looked up in, when
+	// nil they are loaded on first use and kept
+	LibraryPaths []LibraryPath
+}
+
+// separators are the separators artist and genre tags are split on
+func (tq *TrackQuery) separators() []string {
+	if tq.Separators != nil {
+		return tq.Separators
+	}
+	return tags.Separators
 }
 
 func (tq *TrackQuery) GetTrackByID(id int64) (t *Track, err error) {
@@ -69,11 +214,65 @@ func (tq *TrackQuery) GetTrackByID(id int64) (t *Track, err error) {
 	return
 }
 
+// GetTrackByPath returns a track from the database by it's file path
+func (tq *TrackQuery) GetTrackByPath(path string) (t *Track, err error) {
+	t = new(Track)
+	err = tq.DB.Model(t).Where("track.path = ?", path).Limit(1).Select()
+	if err != nil && err != pg.ErrNoRows {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// trackFilterFields are the track columns GetTracks can filter on
+var trackFilterFields = []string{
+	"title", "album", "artist", "genre", "year",
+	"track_number", "disc_number", "album_artist", "composer", "publisher",
+	"isrc", "bpm", "comment", "copyright", "language",
+	"artist_id", "album_id", "format", "codec",
+}
+
+// trackFilterOps are the filter operators allowed on the filter fields
+var trackFilterOps = []string{"", "neq", "exclude", "gt", "gte", "lt", "lte", "ieq"}
+
+// TrackFilter builds the filter for the track fields from the query values,
+// see urlvalues.Filter for the operators. ?composer__ieq=%bach% matches any
+// composer containing "bach".
+func TrackFilter(values urlvalues.Values) *urlvalues.Filter {
+	f := urlvalues.NewFilter(values)
+	for _, field := range trackFilterFields {
+		for _, op := range trackFilterOps {
+			if op == "" {
+				f.Allow(field)
+			} else {
+				f.Allow(field + "__" + op)
+			}
+		}
+	}
+	return f
+}
+
+// GetTracks returns a page of tracks filtered by the query values
 func (tq *TrackQuery) GetTracks(queryValues url.Values) (tracks []Track, count int, err error) {
-	var pagervalues urlvalues.Values
-	err = urlvalues.Decode(queryValues, pagervalues)
+	values := urlvalues.Values(queryValues)
 	q := tq.DB.Model(&tracks)
-	count, err = q.Apply(urlvalues.Pagination(pagervalues)).SelectAndCount()
+	// missing tracks are left out unless asked for with ?missing=true
+	if missing, _ := values.Bool("missing"); missing {
+		q = q.Where("track.missing = true")
+	} else {
+		q = q.Apply(Available)
+	}
+	// ?with_artist=1 and ?with_genre=1 match any of a track's artists or
+	// genres
+	if id, _ := values.Int64("with_artist"); id > 0 {
+		q = q.Apply(WithArtist(id))
+	}
+	if id, _ := values.Int64("with_genre"); id > 0 {
+		q = q.Apply(WithGenre(id))
+	}
+	count, err = q.Apply(TrackFilter(values).Filters).
+		Apply(urlvalues.Pagination(values)).
+		SelectAndCount()
 	if err != nil {
 		logutils.Log.Error("db query error %s", err)
 	}
@@ -85,7 +284,15 @@ func (tq *TrackQuery) AddTrack(path string) (t *Track, err error) {
 		err = errors.New("empty path")
 		return
 	}
-	t, err = NewTrack(path)
+	t, err = NewTrack(path, tq.separators())
+	if err != nil {
+		ieq := ImportErrorQuery{
+			DB:           tq.DB,
+			LibraryPaths: tq.LibraryPaths,
+		}
+		ieq.Record(path, ImportErrorClass(err), err)
+		return
+	}
 	err = tq.DB.Insert(t)
 	if err != nil {
 		logutils.Log.Error("db query error %s", err)
@@ -93,6 +300,102 @@ func (tq *TrackQuery) AddTrack(path string) (t *Track, err error) {
 	return
 }
 
+// GetAvailableTracks returns every track that can be played with only the
+// given columns, all of them when none are given
+func (tq *TrackQuery) GetAvailableTracks(columns ...string) (tracks []Track, err error) {
+	q := tq.DB.Model(&tracks)
+	if len(columns) > 0 {
+		q = q.Column(columns...)
+	}
+	err = q.Apply(Available).Order("track.id ASC").Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetTracksByPathSuffix returns up to limit available tracks whose paths
+// end in suffix, ordered by id
+func (tq *TrackQuery) GetTracksByPathSuffix(suffix string, limit int) (tracks []Track, err error) {
+	err = tq.DB.Model(&tracks).
+		Where("track.path LIKE ?", "%"+likeEscaper.Replace(suffix)).
+		Apply(Available).
+		Order("track.id ASC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetTracksByTitle returns the available tracks with title, compared
+// without regard to case, ordered by id
+func (tq *TrackQuery) GetTracksByTitle(title string) (tracks []Track, err error) {
+	err = tq.DB.Model(&tracks).
+		Where("lower(track.title) = lower(?)", title).
+		Apply(Available).
+		Order("track.id ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// EnsureSHA256 computes the full SHA-256 of the track's file if it hasn't
+// been yet. It is only computed when needed as it reads the whole file.
+func (tq *TrackQuery) EnsureSHA256(t *Track) (err error) {
+	if t.SHA256 != "" {
+		return
+	}
+	sum, err := utils.FileSHA256(t.Path)
+	if err != nil {
+		return
+	}
+	t.SHA256 = sum
+	_, err = tq.DB.Model(t).Column("sha256").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// SetCue sets the cue points of a track by hand, they are kept over the
+// detected ones from then on
+func (tq *TrackQuery) SetCue(id int64, in, out time.Duration) (t *Track, err error) {
+	t = &Track{ID: id, CueIn: in, CueOut: out, CueManual: true}
+	res, err := tq.DB.Model(t).Column("cue_in", "cue_out", "cue_manual").WherePK().Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+		return
+	}
+	return tq.GetTrackByID(id)
+}
+
+// ResetCue drops the cue points set by hand, the track is measured again
+// on the next scan to detect them
+func (tq *TrackQuery) ResetCue(id int64) (t *Track, err error) {
+	res, err := tq.DB.Model((*Track)(nil)).
+		Set("cue_manual = false").
+		Set("analyzed_at = NULL").
+		Where("id = ?", id).
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+		return
+	}
+	return tq.GetTrackByID(id)
+}
+
 // DeleteTrackByID removes a track from the database useing the ID
 func (tq *TrackQuery) DeleteTrackByID(id int64) (err error) {
 	t := new(Track)
@@ -102,3 +405,122 @@ func (tq *TrackQuery) DeleteTrackByID(id int64) (err error) {
 	}
 	return
 }
+
+// GetPresentTracksUnderDir returns the id and path of every track not
+// already marked missing for a file inside dir or any of it's sub directories
+func (tq *TrackQuery) GetPresentTracksUnderDir(dir string) (tracks []Track, err error) {
+	err = tq.DB.Model(&tracks).
+		Column("track.id", "track.path").
+		Where("track.path LIKE ?", dirPrefixPattern(dir)).
+		Where("track.missing = false").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetWaveforms returns the waveforms used by any track
+func (tq *TrackQuery) GetWaveforms() (paths []string, err error) {
+	err = tq.DB.Model((*Track)(nil)).
+		ColumnExpr("DISTINCT track.waveform").
+		Where("track.waveform != ''").
+		Select(&paths)
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// WaveformUsed tests if any track uses the waveform at path
+func (tq *TrackQuery) WaveformUsed(path string) (used bool, err error) {
+	used, err = tq.DB.Model((*Track)(nil)).
+		Where("track.waveform = ?", path).
+		Exists()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// GetTracksUnderDir returns the present tracks whose files are under dir
+// with all of their fields, ordered by id
+func (tq *TrackQuery) GetTracksUnderDir(dir string) (tracks []Track, err error) {
+	err = tq.DB.Model(&tracks).
+		Where("track.path LIKE ?", dirPrefixPattern(dir)).
+		Where("track.missing = false").
+		Order("track.id ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return
+}
+
+// MovePath points the track with id at the path to after it's file was
+// moved there from the path from. It returns pg.ErrNoRows if the track
+// is no longer at from.
+func (tq *TrackQuery) MovePath(id int64, from, to string) (err error) {
+	res, err := tq.DB.Model((*Track)(nil)).
+		Set("path = ?", to).
+		Where("id = ?", id).
+		Where("path = ?", from).
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = pg.ErrNoRows
+	}
+	return
+}
+
+// MarkMissingByIDs flags the tracks with the given ids as missing
+func (tq *TrackQuery) MarkMissingByIDs(ids []int64) (count int, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	res, err := tq.DB.Model((*Track)(nil)).
+		Set("missing = true").
+		Set("missing_since = now()").
+		Where("id IN (?)", pg.In(ids)).
+		Where("missing = false").
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
+
+// MarkMissingByPath flags the track for a file path as missing, along with
+// every track inside it should the path have been a directory
+func (tq *TrackQuery) MarkMissingByPath(path string) (count int, err error) {
+	res, err := tq.DB.Model((*Track)(nil)).
+		Set("missing = true").
+		Set("missing_since = now()").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("path = ?", path).
+				WhereOr("path LIKE ?", dirPrefixPattern(path))
+			return q, nil
+		}).
+		Where("missing = false").
+		Update()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	count = res.RowsAffected()
+	return
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// dirPrefixPattern builds a LIKE pattern matching every path inside dir
+func dirPrefixPattern(dir string) string {
+	dir = strings.TrimSuffix(dir, string(filepath.Separator))
+	return likeEscaper.Replace(dir) + string(filepath.Separator) + "%"
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/tags"
+	taglib "github.com/wtolson/go-taglib"
+)
+
+// ErrNoEdits is returned when a track edit changes nothing
+var ErrNoEdits = errors.New("no editable fields given")
+
+// EditError is returned for a track edit setting a field to an invalid
+// value or a field that can't be edited
+type EditError struct {
+	Field string
+	Value string
+}
+
+func (e *EditError) Error() string {
+	return fmt.Sprintf("invalid %s '%s'", e.Field, e.Value)
+}
+
+// TrackEditFields are the columns of a track that can be edited by hand
+var TrackEditFields = []string{
+	"title", "album", "artist", "genre", "year",
+	"track_number", "disc_number", "album_artist", "composer", "publisher",
+	"isrc", "bpm", "comment", "copyright", "language",
+}
+
+// writableTags are the edit fields taglib can write back to a file, the
+// others are only stored on the track
+var writableTags = map[string]bool{
+	"title":        true,
+	"album":        true,
+	"artist":       true,
+	"genre":        true,
+	"year":         true,
+	"track_number": true,
+	"comment":      true,
+}
+
+// linkFields are the edit fields the artist, album and genre links of a
+// track are made from
+var linkFields = map[string]bool{
+	"album":        true,
+	"artist":       true,
+	"genre":        true,
+	"album_artist": true,
+}
+
+// TrackEdit is the outcome of editing a track
+type TrackEdit struct {
+	Track *Track
+	// Written are the fields written to the file of the track, NotWritten
+	// those only stored on the track because the file can't hold them, it's
+	// library path doesn't have WriteTags set or writing the file failed
+	Written    []string
+	NotWritten []string
+}
+
+// setField sets the edit field col of the track to value
+func (t *Track) setField(col, value string) (err error) {
+	value = strings.TrimSpace(value)
+	var n int
+	if col == "year" || col == "track_number" || col == "disc_number" {
+		if value != "" {
+			n, err = strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return &EditError{Field: col, Value: value}
+			}
+		}
+	}
+	switch col {
+	case "title":
+		t.Title = value
+	case "album":
+		t.Album = value
+	case "artist":
+		t.Artist = value
+	case "genre":
+		t.Genre = value
+	case "year":
+		t.Year = n
+	case "track_number":
+		t.TrackNumber = n
+	case "disc_number":
+		t.DiscNumber = n
+	case "album_artist":
+		t.AlbumArtist = value
+	case "composer":
+		t.Composer = value
+	case "publisher":
+		t.Publisher = value
+	case "isrc":
+		t.ISRC = strings.ToUpper(value)
+	case "bpm":
+		t.BPM = 0
+		if value != "" {
+			t.BPM, err = strconv.ParseFloat(value, 64)
+			if err != nil || t.BPM < 0 {
+				return &EditError{Field: col, Value: value}
+			}
+		}
+	case "comment":
+		t.Comment = value
+	case "copyright":
+		t.Copyright = value
+	case "language":
+		t.Language = value
+	default:
+		return &EditError{Field: col, Value: value}
+	}
+	return
+}
+
+// copyField sets the edit field col of the track to it's value on from, the
+// artists and genres split from an edited artist or genre come along
+func (t *Track) copyField(col string, from *Track) {
+	switch col {
+	case "title":
+		t.Title = from.Title
+	case "album":
+		t.Album = from.Album
+	case "artist":
+		t.Artist = from.Artist
+		t.Artists = from.Artists
+	case "genre":
+		t.Genre = from.Genre
+		t.Genres = from.Genres
+	case "year":
+		t.Year = from.Year
+	case "track_number":
+		t.TrackNumber = from.TrackNumber
+	case "disc_number":
+		t.DiscNumber = from.DiscNumber
+	case "album_artist":
+		t.AlbumArtist = from.AlbumArtist
+	case "composer":
+		t.Composer = from.Composer
+	case "publisher":
+		t.Publisher = from.Publisher
+	case "isrc":
+		t.ISRC = from.ISRC
+	case "bpm":
+		t.BPM = from.BPM
+	case "comment":
+		t.Comment = from.Comment
+	case "copyright":
+		t.Copyright = from.Copyright
+	case "language":
+		t.Language = from.Language
+	}
+}
+
+// markEdited adds the edit fields cols to those set by hand on the track
+func (t *Track) markEdited(cols []string) {
+	for _, col := range cols {
+		found := false
+		for _, e := range t.EditedFields {
+			if e == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.EditedFields = append(t.EditedFields, col)
+		}
+	}
+}
+
+// writeTags writes the fields of the track taglib supports to it's file
+func (t *Track) writeTags(fields []string) (err error) {
+	file, err := taglib.Read(t.Path)
+	if err != nil {
+		return &TagError{Path: t.Path, Err: err}
+	}
+	defer file.Close()
+	for _, col := range fields {
+		switch col {
+		case "title":
+			file.SetTitle(t.Title)
+		case "album":
+			file.SetAlbum(t.Album)
+		case "artist":
+			file.SetArtist(t.Artist)
+		case "genre":
+			file.SetGenre(t.Genre)
+		case "year":
+			file.SetYear(t.Year)
+		case "track_number":
+			file.SetTrack(t.TrackNumber)
+		case "comment":
+			file.SetComment(t.Comment)
+		}
+	}
+	if err = file.Save(); err != nil {
+		return &TagError{Path: t.Path, Err: err}
+	}
+	return
+}
+
+// EditTrack sets the fields of the track with id to the edits, keyed by the
+// names in TrackEditFields. The edited fields are kept in EditedFields so
+// they survive the track being read again from a changed file.
+// When the track's library path has WriteTags set the changed tags taglib
+// can write are saved to it's file as well once the edit is stored, so a
+// scan reading the file before it's new fingerprint is stored keeps the
+// edits. The fingerprint has the media monitor see the file as unchanged
+// instead of importing it again.
+func (tq *TrackQuery) EditTrack(id int64, edits map[string]string) (te *TrackEdit, err error) {
+	t, err := tq.GetTrackByID(id)
+	if err != nil {
+		return
+	}
+	var columns []string
+	relink := false
+	for _, col := range TrackEditFields {
+		value, ok := edits[col]
+		if !ok {
+			continue
+		}
+		if err = t.setField(col, value); err != nil {
+			return
+		}
+		columns = append(columns, col)
+		relink = relink || linkFields[col]
+	}
+	if len(columns) == 0 {
+		err = ErrNoEdits
+		return
+	}
+	t.markEdited(columns)
+
+	// objects in object stores are never written to
+	writeBack := false
+	if !t.Missing && !storage.IsRemote(t.Path) {
+		var paths []LibraryPath
+		paths, err = loadLibraryPaths(tq.DB, &tq.LibraryPaths)
+		if err != nil {
+			return
+		}
+		lp := libraryPathFor(paths, t.Path)
+		writeBack = lp != nil && lp.WriteTags
+	}
+
+	te = &TrackEdit{Track: t}
+	for _, col := range columns {
+		if writeBack && writableTags[col] {
+			te.Written = append(te.Written, col)
+		} else {
+			te.NotWritten = append(te.NotWritten, col)
+		}
+	}
+
+	err = tq.DB.RunInTransaction(func(tx *pg.Tx) error {
+		ti := &TrackImport{Track: t}
+		if relink {
+			t.Artists = tags.SplitOn(tq.separators(), t.Artist)
+			t.Genres = tags.SplitOn(tq.separators(), t.Genre)
+			if err := LinkImport(tx, ti); err != nil {
+				return err
+			}
+			columns = append(columns, "artists", "genres", "artist_id", "album_id")
+		}
+		_, err := tx.Model(t).Column(append(columns, "edited_fields")...).WherePK().Update()
+		if err != nil {
+			return err
+		}
+		if ti.Linked {
+			return saveLinks(tx, ti)
+		}
+		return nil
+	})
+	if err != nil {
+		logutils.Log.Errorf("could not edit track %d: %s", id, err)
+		te = nil
+		return
+	}
+
+	if len(te.Written) > 0 {
+		if werr := tq.writeBack(t, te.Written); werr != nil {
+			logutils.Log.Errorf("could not write the tags of track %d: %s", id, werr)
+			te.NotWritten = append(te.NotWritten, te.Written...)
+			te.Written = nil
+		}
+	}
+	return
+}
+
+// writeBack writes the fields of the track to it's file and stores the new
+// fingerprint of the file
+func (tq *TrackQuery) writeBack(t *Track, fields []string) error {
+	if err := t.writeTags(fields); err != nil {
+		return err
+	}
+	if err := t.Fingerprint(); err != nil {
+		return err
+	}
+	// worked out again from the new content when needed
+	t.SHA256 = ""
+	_, err := tq.DB.Model(t).Column("mtime", "size", "fast_hash", "sha256").WherePK().Update()
+	return err
+}
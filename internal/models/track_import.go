@@ -0,0 +1,372 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// ImportStatus describes what an import does with a file
+type ImportStatus int
+
+const (
+	// ImportUnchanged means the file matched it's stored fingerprint
+	// so it's tags where not read again
+	ImportUnchanged ImportStatus = iota
+	// ImportCreated means a new track is added for the file
+	ImportCreated
+	// ImportUpdated means the file changed and it's track is updated
+	ImportUpdated
+	// ImportRelinked means the file is a track that was moved, the track
+	// is pointed at it's new path
+	ImportRelinked
+)
+
+// TrackImport is the outcome of examining a file for import, it holds the
+// track to store and what has to be done with it
+type TrackImport struct {
+	Track  *Track
+	Status ImportStatus
+	// Columns limits the update of an existing track to these columns,
+	// when empty the whole track is written
+	Columns []string
+	// ArtistIDs and GenreIDs are the artists and genres the track is linked
+	// to in order, they are only written when Linked is set, see LinkImport
+	ArtistIDs []int64
+	GenreIDs  []int64
+	Linked    bool
+	// Local is the local copy of a file that isn't on the local disk, made
+	// to read it, see PrepareImportFrom. The caller removes it once done.
+	Local string
+	// OldWaveform is the waveform of a track whose file changed, it's
+	// removed once the track is stored with a new one unless another track
+	// has the same content
+	OldWaveform string
+}
+
+// LocalPath is the path the file of the track can be read from
+func (ti *TrackImport) LocalPath() string {
+	if ti.Local != "" {
+		return ti.Local
+	}
+	return ti.Track.Path
+}
+
+// NeedsSave tests if the import has anything to write to the database
+func (ti *TrackImport) NeedsSave() bool {
+	return ti.Status != ImportUnchanged || len(ti.Columns) > 0
+}
+
+// PrepareImport examines the file at path and works out what has to be
+// stored for it without writing anything to the database.
+// Files that still have the modification time and size or the fast hash
+// recorded for their track are skipped without reading their tags, and new
+// files with the content of a track whose file is gone relink that track.
+func (tq *TrackQuery) PrepareImport(path string) (ti *TrackImport, err error) {
+	if path == "" {
+		err = errors.New("empty path")
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	return tq.PrepareImportFrom(path, info, nil)
+}
+
+// PrepareImportFrom is PrepareImport for a file that may not be on the local
+// disk, like an object in an object store. info describes the file at path
+// and fetch makes a local copy of it, it's only called if the file has to be
+// read. The copy is left in the Local field of the import for the caller to
+// remove, it's removed here on errors. A nil fetch, or one returning path
+// itself, reads path in place.
+func (tq *TrackQuery) PrepareImportFrom(path string, info os.FileInfo, fetch func() (string, error)) (ti *TrackImport, err error) {
+	existing, err := tq.GetTrackByPath(path)
+	if err != nil && err != pg.ErrNoRows {
+		return
+	}
+	found := err == nil
+	err = nil
+
+	if found && existing.Unchanged(info) {
+		ti = &TrackImport{Track: existing, Status: ImportUnchanged}
+		if existing.Missing {
+			existing.Missing = false
+			existing.MissingSince = time.Time{}
+			ti.Columns = []string{"missing", "missing_since"}
+		}
+		return
+	}
+
+	local := path
+	if fetch != nil {
+		local, err = fetch()
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil && local != path {
+				os.Remove(local)
+			}
+		}()
+	}
+
+	fp := &Track{Path: local}
+	err = fp.Fingerprint()
+	if err != nil {
+		return
+	}
+	// a local copy has the size but not the modification time of the file
+	fp.Mtime = info.ModTime().Truncate(time.Microsecond)
+	fp.Size = info.Size()
+
+	if found && existing.FastHash == fp.FastHash {
+		// only touched, the content is the same
+		existing.Mtime = fp.Mtime
+		existing.Size = fp.Size
+		existing.Missing = false
+		existing.MissingSince = time.Time{}
+		ti = &TrackImport{
+			Track:   existing,
+			Status:  ImportUnchanged,
+			Columns: []string{"mtime", "size", "missing", "missing_since"},
+		}
+		if local != path {
+			os.Remove(local)
+		}
+		return
+	}
+
+	if !found {
+		var moved *Track
+		moved, err = tq.findMoved(fp)
+		if err != nil {
+			return
+		}
+		if moved != nil {
+			logutils.Log.Infof("Relinking track %d from '%s' to '%s'", moved.ID, moved.Path, path)
+			moved.Path = path
+			moved.Mtime = fp.Mtime
+			moved.Size = fp.Size
+			moved.Missing = false
+			moved.MissingSince = time.Time{}
+			ti = &TrackImport{
+				Track:   moved,
+				Status:  ImportRelinked,
+				Columns: []string{"path", "mtime", "size", "missing", "missing_since"},
+			}
+			if local != path {
+				ti.Local = local
+			}
+			return
+		}
+	}
+
+	t, err := NewTrack(local, tq.separators())
+	if err != nil {
+		if terr, ok := err.(*TagError); ok {
+			terr.Path = path
+		}
+		return
+	}
+	t.Path = path
+	t.Mtime = fp.Mtime
+	t.Size = fp.Size
+	t.FastHash = fp.FastHash
+
+	ti = &TrackImport{Track: t, Status: ImportCreated}
+	if local != path {
+		ti.Local = local
+	}
+	if found {
+		t.carryOver(existing)
+		ti.Status = ImportUpdated
+		ti.OldWaveform = existing.Waveform
+	}
+	return
+}
+
+// carryOver keeps what isn't read from the file when the track is read
+// again into t from the file of existing, it's identity, cues and fields set
+// by hand and whether it was retired as a duplicate
+func (t *Track) carryOver(existing *Track) {
+	t.ID = existing.ID
+	t.Added = existing.Added
+	if existing.CueManual {
+		t.CueIn = existing.CueIn
+		t.CueOut = existing.CueOut
+		t.CueManual = true
+	}
+	t.ReplacedBy = existing.ReplacedBy
+	for _, col := range existing.EditedFields {
+		t.copyField(col, existing)
+	}
+	t.EditedFields = existing.EditedFields
+}
+
+// SaveImports writes a batch of prepared imports to the database in a
+// single transaction, new tracks are inserted together. Import errors
+// recorded for their files are cleared.
+func (tq *TrackQuery) SaveImports(imports []*TrackImport) error {
+	err := tq.DB.RunInTransaction(func(tx *pg.Tx) error {
+		var created []*Track
+		for _, ti := range imports {
+			var err error
+			switch {
+			case ti.Status == ImportCreated:
+				created = append(created, ti.Track)
+			case len(ti.Columns) > 0:
+				_, err = tx.Model(ti.Track).Column(ti.Columns...).WherePK().Update()
+			case ti.Status == ImportUpdated:
+				err = tx.Update(ti.Track)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		created, err := recheckCreated(tx, imports, created)
+		if err != nil {
+			return err
+		}
+		if len(created) > 0 {
+			_, err := tx.Model(&created).Insert()
+			if err != nil {
+				return err
+			}
+		}
+		// new tracks only have their ids once inserted
+		paths := make([]string, 0, len(imports))
+		for _, ti := range imports {
+			paths = append(paths, ti.Track.Path)
+			if !ti.Linked {
+				continue
+			}
+			if err := saveLinks(tx, ti); err != nil {
+				return err
+			}
+		}
+		// files that failed before and import now are fixed
+		ieq := ImportErrorQuery{
+			DB: tx,
+		}
+		return ieq.ClearPaths(paths)
+	})
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+	}
+	return err
+}
+
+// trackInsertLock is the advisory lock held while new tracks are inserted
+const trackInsertLock = 0x676f6263 // "gobc"
+
+// recheckCreated looks for tracks added for the files of new tracks since
+// they where prepared, like by an upload being imported while the media
+// monitor sees it's file appear. Those are updated instead of added twice,
+// the tracks still to insert are returned. The lock taken is held until the
+// transaction ends so the check and the insert happen together.
+func recheckCreated(tx *pg.Tx, imports []*TrackImport, created []*Track) ([]*Track, error) {
+	if len(created) == 0 {
+		return created, nil
+	}
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", trackInsertLock)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(created))
+	for i, t := range created {
+		paths[i] = t.Path
+	}
+	var existing []Track
+	err = tx.Model(&existing).
+		Where("path IN (?)", pg.In(paths)).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return created, nil
+	}
+
+	byPath := make(map[string]Track, len(existing))
+	for _, t := range existing {
+		byPath[t.Path] = t
+	}
+	created = created[:0]
+	for _, ti := range imports {
+		if ti.Status != ImportCreated {
+			continue
+		}
+		t, ok := byPath[ti.Track.Path]
+		if !ok {
+			created = append(created, ti.Track)
+			continue
+		}
+		ti.Track.carryOver(&t)
+		ti.Status = ImportUpdated
+		if err = tx.Update(ti.Track); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// findMoved looks for a track with the same content as the file fp was
+// fingerprinted from whose own file is gone, meaning the file was moved.
+// If both have a full SHA-256 they must also match.
+func (tq *TrackQuery) findMoved(fp *Track) (moved *Track, err error) {
+	var candidates []Track
+	err = tq.DB.Model(&candidates).
+		Where("track.fast_hash = ?", fp.FastHash).
+		Where("track.size = ?", fp.Size).
+		Order("track.missing DESC", "track.id ASC").
+		Select()
+	if err != nil {
+		logutils.Log.Error("db query error %s", err)
+		return
+	}
+	return pickMoved(candidates, fp.Path, fileGone)
+}
+
+// fileGone tests if the file at path is gone, objects in object stores are
+// left to the next scan to tell
+func fileGone(path string) bool {
+	if storage.IsRemote(path) {
+		return false
+	}
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// pickMoved returns the first of candidates the file at path may have been
+// moved from, a track marked missing or whose file is gone as told by gone.
+// Candidates with a full SHA-256 must match the file's.
+func pickMoved(candidates []Track, path string, gone func(string) bool) (*Track, error) {
+	var sum string
+	for i := range candidates {
+		c := &candidates[i]
+		// the file may have been moved but not noticed yet
+		if !c.Missing && !gone(c.Path) {
+			continue
+		}
+		if c.SHA256 != "" {
+			if sum == "" {
+				var err error
+				if sum, err = utils.FileSHA256(path); err != nil {
+					return nil, err
+				}
+			}
+			if sum != c.SHA256 {
+				continue
+			}
+		}
+		return c, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+func TestPickMoved(t *testing.T) {
+	f, err := ioutil.TempFile("", "gobcast-moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("content")
+	f.Close()
+	sum, err := utils.FileSHA256(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gone := map[string]bool{"/old/gone.mp3": true}
+	tests := []struct {
+		name       string
+		candidates []Track
+		want       int64
+	}{
+		{"none", nil, 0},
+		{"missing", []Track{{ID: 1, Missing: true}}, 1},
+		// it's file is still there, this is a copy
+		{"present", []Track{{ID: 1, Path: "/old/here.mp3"}}, 0},
+		{"not noticed yet", []Track{{ID: 1, Path: "/old/gone.mp3"}}, 1},
+		{"other content", []Track{{ID: 1, Missing: true, SHA256: "beef"}}, 0},
+		{"same content", []Track{{ID: 1, Missing: true, SHA256: sum}}, 1},
+		// the order of the candidates decides
+		{"first", []Track{
+			{ID: 1, Missing: true, SHA256: "beef"},
+			{ID: 2, Missing: true},
+			{ID: 3, Missing: true},
+		}, 2},
+	}
+	for _, test := range tests {
+		moved, err := pickMoved(test.candidates, f.Name(), func(p string) bool { return gone[p] })
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var id int64
+		if moved != nil {
+			id = moved.ID
+		}
+		if id != test.want {
+			t.Errorf("%s: picked %d, want %d", test.name, id, test.want)
+		}
+	}
+
+	if fileGone(f.Name()) || !fileGone(f.Name()+".gone") {
+		t.Error("gone wrong for local files")
+	}
+	if fileGone("s3://bucket/gone.mp3") {
+		t.Error("objects can't be told gone")
+	}
+}
+
+func TestCarryOver(t *testing.T) {
+	added := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	existing := &Track{
+		ID:         7,
+		Added:      added,
+		Title:      "Old",
+		CueIn:      time.Second,
+		CueOut:     time.Minute,
+		CueManual:  true,
+		ReplacedBy: 3,
+	}
+
+	// the file of a retired track changed, it stays retired
+	read := &Track{Title: "New", CueIn: 2 * time.Second}
+	read.carryOver(existing)
+	if read.ID != 7 || !read.Added.Equal(added) {
+		t.Errorf("identity lost: id %d added %s", read.ID, read.Added)
+	}
+	if read.ReplacedBy != 3 {
+		t.Errorf("retired track replaced by %d, want 3", read.ReplacedBy)
+	}
+	if read.CueIn != time.Second || read.CueOut != time.Minute || !read.CueManual {
+		t.Errorf("manual cues lost: %s %s %v", read.CueIn, read.CueOut, read.CueManual)
+	}
+	if read.Title != "New" {
+		t.Errorf("title read from the file replaced by %q", read.Title)
+	}
+
+	// detected cues are detected again
+	existing.CueManual = false
+	existing.ReplacedBy = 0
+	read = &Track{CueIn: 2 * time.Second}
+	read.carryOver(existing)
+	if read.CueIn != 2*time.Second || read.CueManual || read.ReplacedBy != 0 {
+		t.Errorf("carried over cue %s manual %v replaced by %d", read.CueIn, read.CueManual, read.ReplacedBy)
+	}
+}
+
+func TestCarryOverEdits(t *testing.T) {
+	existing := &Track{ID: 7, Title: "Old", Composer: "Someone", Artist: "A; B"}
+	if err := existing.setField("composer", "Edited"); err != nil {
+		t.Fatal(err)
+	}
+	if err := existing.setField("artist", "C & D"); err != nil {
+		t.Fatal(err)
+	}
+	// as split by EditTrack
+	existing.Artists = []string{"C", "D"}
+	existing.markEdited([]string{"composer", "artist"})
+	existing.markEdited([]string{"composer"})
+	if len(existing.EditedFields) != 2 {
+		t.Fatalf("edited fields %v", existing.EditedFields)
+	}
+
+	// the file was touched and is read again
+	read := &Track{Title: "New", Composer: "Someone", Artist: "A; B", Artists: []string{"A", "B"}}
+	read.carryOver(existing)
+	if read.Composer != "Edited" || read.Artist != "C & D" {
+		t.Errorf("edits lost: composer %q artist %q", read.Composer, read.Artist)
+	}
+	if len(read.Artists) != 2 || read.Artists[0] != "C" {
+		t.Errorf("artists %v not made from the edited artist", read.Artists)
+	}
+	if read.Title != "New" {
+		t.Errorf("unedited title %q not read from the file", read.Title)
+	}
+	if len(read.EditedFields) != 2 {
+		t.Errorf("edited fields %v not kept", read.EditedFields)
+	}
+}
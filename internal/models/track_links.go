@@ -0,0 +1,142 @@
+package models
+
+import (
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/ryex/go-broadcaster/internal/tags"
+)
+
+// ArtistNames are the artists of the track. Tracks stored before tags were
+// read as several values have their artist tag split instead.
+func (t *Track) ArtistNames() []string {
+	if len(t.Artists) > 0 {
+		return t.Artists
+	}
+	return tags.Split(t.Artist)
+}
+
+// GenreNames are the genres of the track, see ArtistNames
+func (t *Track) GenreNames() []string {
+	if len(t.Genres) > 0 {
+		return t.Genres
+	}
+	return tags.Split(t.Genre)
+}
+
+// LinkImport points the track of an import at the artists, album and
+// genres of it's tags, adding them if they are new. The track's own artist
+// is the first of it's artists. The links to all of it's artists and
+// genres are written along with the import by SaveImports.
+func LinkImport(db orm.DB, ti *TrackImport) (err error) {
+	t := ti.Track
+	aq := ArtistQuery{DB: db}
+	ti.ArtistIDs = ti.ArtistIDs[:0]
+	for _, name := range t.ArtistNames() {
+		var a *Artist
+		a, err = aq.FindOrAddArtist(name)
+		if err != nil {
+			return
+		}
+		if a != nil && !containsID(ti.ArtistIDs, a.ID) {
+			ti.ArtistIDs = append(ti.ArtistIDs, a.ID)
+		}
+	}
+	gq := GenreQuery{DB: db}
+	ti.GenreIDs = ti.GenreIDs[:0]
+	for _, name := range t.GenreNames() {
+		var g *Genre
+		g, err = gq.FindOrAddGenre(name)
+		if err != nil {
+			return
+		}
+		if g != nil && !containsID(ti.GenreIDs, g.ID) {
+			ti.GenreIDs = append(ti.GenreIDs, g.ID)
+		}
+	}
+
+	var artistID, albumArtistID, albumID int64
+	if len(ti.ArtistIDs) > 0 {
+		artistID = ti.ArtistIDs[0]
+	}
+	albumArtistID = artistID
+	if t.AlbumArtist != "" {
+		var a *Artist
+		a, err = aq.FindOrAddArtist(t.AlbumArtist)
+		if err != nil {
+			return
+		}
+		if a != nil {
+			albumArtistID = a.ID
+		}
+	}
+	alq := AlbumQuery{DB: db}
+	album, err := alq.FindOrAddAlbum(t.Album, albumArtistID)
+	if err != nil {
+		return
+	}
+	if album != nil {
+		albumID = album.ID
+	}
+
+	t.ArtistID = artistID
+	t.AlbumID = albumID
+	ti.Linked = true
+	return
+}
+
+// saveLinks replaces the artist and genre links of an imported track
+func saveLinks(tx *pg.Tx, ti *TrackImport) error {
+	id := ti.Track.ID
+	_, err := tx.Model((*TrackArtist)(nil)).Where("track_id = ?", id).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*TrackGenre)(nil)).Where("track_id = ?", id).Delete()
+	if err != nil {
+		return err
+	}
+
+	if len(ti.ArtistIDs) > 0 {
+		links := make([]TrackArtist, len(ti.ArtistIDs))
+		for i, aid := range ti.ArtistIDs {
+			links[i] = TrackArtist{TrackID: id, ArtistID: aid, Position: i}
+		}
+		_, err = tx.Model(&links).Insert()
+		if err != nil {
+			return err
+		}
+	}
+	if len(ti.GenreIDs) > 0 {
+		links := make([]TrackGenre, len(ti.GenreIDs))
+		for i, gid := range ti.GenreIDs {
+			links[i] = TrackGenre{TrackID: id, GenreID: gid, Position: i}
+		}
+		_, err = tx.Model(&links).Insert()
+	}
+	return err
+}
+
+// WithArtist filters a track query down to the tracks featuring the artist
+// with the given id, not only those it is the first artist of
+func WithArtist(id int64) func(*orm.Query) (*orm.Query, error) {
+	return func(q *orm.Query) (*orm.Query, error) {
+		return q.Where("EXISTS (SELECT 1 FROM track_artists AS ta WHERE ta.track_id = track.id AND ta.artist_id = ?)", id), nil
+	}
+}
+
+// WithGenre filters a track query down to the tracks with the genre with
+// the given id among their genres
+func WithGenre(id int64) func(*orm.Query) (*orm.Query, error) {
+	return func(q *orm.Query) (*orm.Query, error) {
+		return q.Where("EXISTS (SELECT 1 FROM track_genres AS tg WHERE tg.track_id = track.id AND tg.genre_id = ?)", id), nil
+	}
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
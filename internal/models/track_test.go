@@ -0,0 +1,42 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// fileInfo is an os.FileInfo with a size and modification time
+type fileInfo struct {
+	os.FileInfo
+	size  int64
+	mtime time.Time
+}
+
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.mtime }
+
+func TestUnchanged(t *testing.T) {
+	mtime := time.Date(2018, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	// as stored by the database
+	track := &Track{Size: 1000, Mtime: mtime.Truncate(time.Microsecond)}
+
+	tests := []struct {
+		name string
+		info fileInfo
+		want bool
+	}{
+		{"same", fileInfo{size: 1000, mtime: mtime}, true},
+		// the file system may keep more than the database
+		{"within a microsecond", fileInfo{size: 1000, mtime: mtime.Add(100)}, true},
+		{"touched", fileInfo{size: 1000, mtime: mtime.Add(time.Second)}, false},
+		{"older", fileInfo{size: 1000, mtime: mtime.Add(-time.Microsecond)}, false},
+		{"resized", fileInfo{size: 999, mtime: mtime}, false},
+		{"other zone", fileInfo{size: 1000, mtime: mtime.In(time.FixedZone("x", 3600))}, true},
+	}
+	for _, test := range tests {
+		if got := track.Unchanged(test.info); got != test.want {
+			t.Errorf("%s: unchanged %v, want %v", test.name, got, test.want)
+		}
+	}
+}
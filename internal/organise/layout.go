@@ -0,0 +1,182 @@
+// Package organise moves the files of a managed library path into a
+// layout built from the tags of their tracks, like
+// "{albumartist}/{year} - {album}/{disc}-{track} {title}.{ext}".
+package organise
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ryex/go-broadcaster/internal/audio"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultLayout is used for library paths without a layout of their own
+const DefaultLayout = "{albumartist}/{year} - {album}/{disc}-{track} {title}.{ext}"
+
+// fields are the values a layout can use by name
+var fields = map[string]func(t *models.Track) string{
+	"albumartist": func(t *models.Track) string {
+		if t.AlbumArtist != "" {
+			return t.AlbumArtist
+		}
+		return orUnknown(t.Artist, "Unknown Artist")
+	},
+	"artist": func(t *models.Track) string {
+		return orUnknown(t.Artist, "Unknown Artist")
+	},
+	"album": func(t *models.Track) string {
+		return orUnknown(t.Album, "Unknown Album")
+	},
+	"title": func(t *models.Track) string {
+		if t.Title != "" {
+			return t.Title
+		}
+		base := filepath.Base(t.Path)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	},
+	"genre":    func(t *models.Track) string { return t.Genre },
+	"composer": func(t *models.Track) string { return t.Composer },
+	"year":     func(t *models.Track) string { return number(t.Year, 0) },
+	"track":    func(t *models.Track) string { return number(t.TrackNumber, 2) },
+	"disc":     func(t *models.Track) string { return number(t.DiscNumber, 0) },
+	"ext": func(t *models.Track) string {
+		ext := filepath.Ext(t.Path)
+		if ext == "" {
+			ext = audio.Format{Container: t.Format, Codec: t.Codec}.Ext()
+		}
+		return strings.ToLower(strings.TrimPrefix(ext, "."))
+	},
+}
+
+func orUnknown(v, unknown string) string {
+	if strings.TrimSpace(v) == "" {
+		return unknown
+	}
+	return v
+}
+
+// number formats n zero padded to width, zero is left out
+func number(n, width int) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// Layout is a parsed layout template. Fields are written in braces and may
+// give a zero padded width for numbers, like {track:3}. Slashes separate
+// directories.
+type Layout struct {
+	raw   string
+	parts []part
+}
+
+type part struct {
+	literal string
+	field   string
+	width   int
+}
+
+// ParseLayout parses a layout template, it must name a relative path
+// ending in the file's extension
+func ParseLayout(s string) (*Layout, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("empty layout")
+	}
+	if strings.HasPrefix(s, "/") || filepath.IsAbs(s) {
+		return nil, errors.New("layout must be relative")
+	}
+	l := &Layout{raw: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			l.parts = append(l.parts, part{literal: rest})
+			break
+		}
+		if open > 0 {
+			l.parts = append(l.parts, part{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed field in layout '%s'", s)
+		}
+		name := rest[open+1 : open+end]
+		p := part{field: name}
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			width, err := strconv.Atoi(name[i+1:])
+			if err != nil || width < 0 || width > 9 {
+				return nil, fmt.Errorf("bad width in layout field '%s'", name)
+			}
+			p.field, p.width = name[:i], width
+		}
+		if _, ok := fields[p.field]; !ok {
+			return nil, fmt.Errorf("unknown layout field '%s'", p.field)
+		}
+		l.parts = append(l.parts, p)
+		rest = rest[open+end+1:]
+	}
+	for _, seg := range strings.Split(s, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return nil, fmt.Errorf("bad directory '%s' in layout '%s'", seg, s)
+		}
+	}
+	if !strings.HasSuffix(s, ".{ext}") {
+		return nil, errors.New("layout must end in .{ext}")
+	}
+	return l, nil
+}
+
+func (l *Layout) String() string {
+	return l.raw
+}
+
+// Path returns where the file of t goes in the layout, relative to the
+// library path. Values are cleaned so they can't add directories and each
+// directory and the file name are made safe for any file system.
+func (l *Layout) Path(t *models.Track) string {
+	var b strings.Builder
+	for _, p := range l.parts {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		v := fields[p.field](t)
+		if p.width > 0 {
+			if n, err := strconv.Atoi(v); err == nil {
+				v = number(n, p.width)
+			}
+		}
+		// values must not split the path
+		v = strings.Replace(v, "/", "_", -1)
+		v = strings.Replace(v, `\`, "_", -1)
+		b.WriteString(v)
+	}
+	segs := strings.Split(b.String(), "/")
+	for i, seg := range segs {
+		segs[i] = cleanSegment(seg, i == len(segs)-1)
+	}
+	return filepath.Join(segs...)
+}
+
+// cleanSegment tidies a directory or file name left with dangling
+// separators by empty values, like " - Album" when there is no year
+func cleanSegment(seg string, file bool) string {
+	ext := ""
+	if i := strings.LastIndexByte(seg, '.'); file && i >= 0 {
+		seg, ext = seg[:i], seg[i:]
+	}
+	seg = strings.Trim(seg, " -_.")
+	for strings.Contains(seg, "  ") {
+		seg = strings.Replace(seg, "  ", " ", -1)
+	}
+	if seg == "" {
+		seg = "_"
+	}
+	return utils.SanitizeFileName(seg + ext)
+}
@@ -0,0 +1,113 @@
+package organise
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestLayoutPath(t *testing.T) {
+	l, err := ParseLayout(DefaultLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		track models.Track
+		want  string
+	}{
+		{
+			models.Track{
+				Path: "/lib/final_FINAL2.MP3", Artist: "Guest", AlbumArtist: "Various Artists",
+				Album: "Live: 1999", Year: 1999, DiscNumber: 1, TrackNumber: 3, Title: "Intro / Outro",
+			},
+			"Various Artists/1999 - Live_ 1999/1-03 Intro _ Outro.mp3",
+		},
+		{
+			models.Track{Path: "/lib/show.flac", Artist: "AC/DC", Title: "Song"},
+			"AC_DC/Unknown Album/Song.flac",
+		},
+		{
+			models.Track{Path: "/lib/final_FINAL2.mp3", TrackNumber: 7},
+			"Unknown Artist/Unknown Album/07 final_FINAL2.mp3",
+		},
+		{
+			models.Track{Path: "/lib/noext", Title: "..", Format: "ogg", Codec: "opus"},
+			"Unknown Artist/Unknown Album/_.opus",
+		},
+	}
+	for _, test := range tests {
+		if got := l.Path(&test.track); got != filepath.FromSlash(test.want) {
+			t.Errorf("%s: got %q, want %q", test.track.Path, got, test.want)
+		}
+	}
+
+	l, err = ParseLayout("{artist}/{track:3}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Path(&models.Track{Path: "a.mp3", Artist: "A", TrackNumber: 5}); got != filepath.FromSlash("A/005.mp3") {
+		t.Errorf("padded track gave %q", got)
+	}
+}
+
+func TestParseLayoutErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"/abs/{title}.{ext}",
+		"{artist}/../{title}.{ext}",
+		"{artist}//{title}.{ext}",
+		"{nope}.{ext}",
+		"{title.{ext}",
+		"{track:x}.{ext}",
+		"{artist}/{title}",
+	} {
+		if _, err := ParseLayout(s); err == nil {
+			t.Errorf("ParseLayout(%q) gave no error", s)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	root, err := ioutil.TempDir("", "gobcast-organise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	l, err := ParseLayout("{artist}/{title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file that isn't a track already has the first place
+	if err = os.MkdirAll(filepath.Join(root, "A"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "A", "Song.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tracks := []models.Track{
+		{ID: 1, Path: filepath.Join(root, "x.mp3"), Artist: "A", Title: "Song"},
+		{ID: 2, Path: filepath.Join(root, "y.mp3"), Artist: "A", Title: "Song"},
+		{ID: 3, Path: filepath.Join(root, "B", "Other.mp3"), Artist: "B", Title: "Other"},
+		{ID: 4, Path: filepath.Join(root, "A", "Dup (3).mp3"), Artist: "A", Title: "Dup"},
+	}
+	moves := plan(root, l, tracks)
+	want := []Move{
+		{TrackID: 1, From: tracks[0].Path, To: filepath.Join(root, "A", "Song (1).mp3")},
+		{TrackID: 2, From: tracks[1].Path, To: filepath.Join(root, "A", "Song (2).mp3")},
+		{TrackID: 4, From: tracks[3].Path, To: filepath.Join(root, "A", "Dup.mp3")},
+	}
+	if len(moves) != len(want) {
+		t.Fatalf("planned %v, want %v", moves, want)
+	}
+	for i := range want {
+		if moves[i] != want[i] {
+			t.Errorf("move %d is %v, want %v", i, moves[i], want[i])
+		}
+	}
+}
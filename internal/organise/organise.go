@@ -0,0 +1,179 @@
+package organise
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Move is a planned or done move of the file of a track
+type Move struct {
+	TrackID int64  `json:"track_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	// Error is why the move failed, the file is left where it was
+	Error string `json:"error,omitempty"`
+}
+
+// Organiser moves the files of the tracks of a managed library path into
+// it's layout
+type Organiser struct {
+	DB *pg.DB
+	// DryRun only plans the moves without making them
+	DryRun bool
+}
+
+// LayoutOf returns the layout of the library path
+func LayoutOf(lp *models.LibraryPath) (*Layout, error) {
+	if lp.Layout == "" {
+		return ParseLayout(DefaultLayout)
+	}
+	return ParseLayout(lp.Layout)
+}
+
+// Organise moves every file of the library path that isn't where the
+// layout puts it, pointing it's track at the new path. Files are never
+// replaced, when the place of a file is taken a number is added to it's
+// name. It returns the moves planned, or made unless it's a dry run.
+func (o *Organiser) Organise(ctx context.Context, lp *models.LibraryPath) ([]Move, error) {
+	if !lp.Managed {
+		return nil, models.ErrNotManaged
+	}
+	layout, err := LayoutOf(lp)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(lp.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	tq := models.TrackQuery{
+		DB: o.DB,
+	}
+	tracks, err := tq.GetTracksUnderDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.organise(ctx, &tq, root, layout, tracks)
+}
+
+// trackMover points a track at the new path of it's file, it's a
+// models.TrackQuery outside of tests
+type trackMover interface {
+	MovePath(id int64, from, to string) error
+}
+
+// organise plans the moves of the tracks under root and makes them unless
+// it's a dry run
+func (o *Organiser) organise(ctx context.Context, tm trackMover, root string, layout *Layout, tracks []models.Track) ([]Move, error) {
+	moves := plan(root, layout, tracks)
+	if o.DryRun || len(moves) == 0 {
+		return moves, nil
+	}
+
+	moved := 0
+	for i := range moves {
+		if err := ctx.Err(); err != nil {
+			return moves[:i], err
+		}
+		if o.move(tm, root, &moves[i]) {
+			moved++
+		}
+	}
+	logutils.Log.Infof("Organised '%s': moved %d of %d files", root, moved, len(moves))
+	return moves, nil
+}
+
+// plan works out where each track that isn't in place goes. Paths staying
+// put are claimed first so no file is planned onto them.
+func plan(root string, layout *Layout, tracks []models.Track) []Move {
+	taken := make(map[string]bool, len(tracks))
+	dests := make([]string, len(tracks))
+	for i := range tracks {
+		dests[i] = filepath.Join(root, layout.Path(&tracks[i]))
+		if dests[i] == tracks[i].Path {
+			taken[dests[i]] = true
+		}
+	}
+
+	moves := []Move{}
+	for i, t := range tracks {
+		if dests[i] == t.Path {
+			continue
+		}
+		dest := freePath(dests[i], t.Path, taken)
+		taken[dest] = true
+		if dest == t.Path {
+			// already in place under a numbered name
+			continue
+		}
+		moves = append(moves, Move{TrackID: t.ID, From: t.Path, To: dest})
+	}
+	return moves
+}
+
+// freePath returns dest, or dest with a number added to it's name if it's
+// taken by another file or planned move. The current path of the file
+// counts as free.
+func freePath(dest, current string, taken map[string]bool) string {
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	path := dest
+	for i := 1; ; i++ {
+		if path == current || (!taken[path] && !utils.FileExists(path)) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// move makes a planned move, the file is moved back if it's track can't be
+// updated
+func (o *Organiser) move(tm trackMover, root string, m *Move) bool {
+	err := os.MkdirAll(filepath.Dir(m.To), 0755)
+	if err != nil {
+		m.Error = err.Error()
+		return false
+	}
+	to, err := utils.MoveFileUnique(m.From, m.To)
+	if err != nil {
+		logutils.Log.Errorf("Could not move '%s' to '%s': %s", m.From, m.To, err)
+		m.Error = err.Error()
+		return false
+	}
+	m.To = to
+
+	err = tm.MovePath(m.TrackID, m.From, to)
+	if err != nil {
+		logutils.Log.Errorf("Could not point track %d at '%s': %s", m.TrackID, to, err)
+		m.Error = err.Error()
+		if berr := utils.MoveFile(to, m.From); berr != nil {
+			logutils.Log.Errorf("Could not move '%s' back to '%s': %s", to, m.From, berr)
+		}
+		return false
+	}
+	removeEmptyDirs(filepath.Dir(m.From), root)
+	return true
+}
+
+// removeEmptyDirs removes dir and it's parents up to root while they are
+// empty
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		// Remove fails on directories that are not empty
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,238 @@
+package organise
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/ryex/go-broadcaster/internal/logutils"
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	logutils.SetupLogging("organise-test", false, ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeMover records the tracks pointed at new paths, failing for the
+// tracks in fail
+type fakeMover struct {
+	moved map[int64]string
+	fail  map[int64]bool
+}
+
+func (m *fakeMover) MovePath(id int64, from, to string) error {
+	if m.fail[id] {
+		return errors.New("database gone")
+	}
+	if m.moved == nil {
+		m.moved = make(map[int64]string)
+	}
+	m.moved[id] = to
+	return nil
+}
+
+// makeFiles creates the files at the slash separated paths under a new
+// temporary root, each holding it's own path
+func makeFiles(t *testing.T, paths ...string) string {
+	root, err := ioutil.TempDir("", "gobcast-organise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if err = os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(full, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// listFiles returns the slash separated paths of every file and directory
+// under root
+func listFiles(t *testing.T, root string) []string {
+	var found []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if info.IsDir() {
+			rel += "/"
+		}
+		found = append(found, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFreePath(t *testing.T) {
+	root := makeFiles(t, "A/Song.mp3", "A/Song (1).mp3")
+	defer os.RemoveAll(root)
+	dest := filepath.Join(root, "A", "Song.mp3")
+	at := func(name string) string {
+		return filepath.Join(root, "A", name)
+	}
+
+	tests := []struct {
+		current string
+		taken   []string
+		want    string
+	}{
+		// files on disk push the name up
+		{filepath.Join(root, "x.mp3"), nil, at("Song (2).mp3")},
+		// so do planned moves
+		{filepath.Join(root, "x.mp3"), []string{at("Song (2).mp3")}, at("Song (3).mp3")},
+		// the file itself doesn't
+		{at("Song (1).mp3"), nil, at("Song (1).mp3")},
+		{dest, nil, dest},
+	}
+	for _, test := range tests {
+		taken := make(map[string]bool)
+		for _, p := range test.taken {
+			taken[p] = true
+		}
+		if got := freePath(dest, test.current, taken); got != test.want {
+			t.Errorf("freePath from %s gave %s, want %s", test.current, got, test.want)
+		}
+	}
+
+	// names without an extension are numbered at the end
+	if got := freePath(filepath.Join(root, "A"), "", nil); got != filepath.Join(root, "A (1)") {
+		t.Errorf("directory name numbered as %s", got)
+	}
+}
+
+func TestOrganise(t *testing.T) {
+	root := makeFiles(t, "in/x.mp3", "in/deep/y.mp3", "keep/z.mp3", "B/Other.mp3")
+	defer os.RemoveAll(root)
+	l, err := ParseLayout("{artist}/{title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks := []models.Track{
+		{ID: 1, Path: filepath.Join(root, "in", "x.mp3"), Artist: "A", Title: "Song"},
+		{ID: 2, Path: filepath.Join(root, "in", "deep", "y.mp3"), Artist: "A", Title: "Song"},
+		{ID: 3, Path: filepath.Join(root, "B", "Other.mp3"), Artist: "B", Title: "Other"},
+	}
+	before := listFiles(t, root)
+
+	// a dry run plans the moves and leaves the files alone
+	o := &Organiser{DryRun: true}
+	tm := new(fakeMover)
+	moves, err := o.organise(context.Background(), tm, root, l, tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 {
+		t.Fatalf("dry run planned %v", moves)
+	}
+	if got := listFiles(t, root); !equalPaths(got, before) {
+		t.Errorf("dry run changed the files to %v", got)
+	}
+	if len(tm.moved) != 0 {
+		t.Errorf("dry run moved tracks %v", tm.moved)
+	}
+
+	o.DryRun = false
+	moves, err = o.organise(context.Background(), tm, root, l, tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range moves {
+		if m.Error != "" {
+			t.Errorf("move of %s failed: %s", m.From, m.Error)
+		}
+	}
+	// emptied directories go, others stay
+	want := []string{"A/", "A/Song (1).mp3", "A/Song.mp3", "B/", "B/Other.mp3", "keep/", "keep/z.mp3"}
+	if got := listFiles(t, root); !equalPaths(got, want) {
+		t.Errorf("organised into %v, want %v", got, want)
+	}
+	if tm.moved[1] != filepath.Join(root, "A", "Song.mp3") || tm.moved[2] != filepath.Join(root, "A", "Song (1).mp3") {
+		t.Errorf("tracks pointed at %v", tm.moved)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, "A", "Song (1).mp3"))
+	if err != nil || string(data) != "in/deep/y.mp3" {
+		t.Errorf("moved file holds %q, %v", data, err)
+	}
+}
+
+func TestMoveRollback(t *testing.T) {
+	root := makeFiles(t, "in/x.mp3")
+	defer os.RemoveAll(root)
+	from := filepath.Join(root, "in", "x.mp3")
+	m := &Move{TrackID: 1, From: from, To: filepath.Join(root, "A", "Song.mp3")}
+
+	o := new(Organiser)
+	tm := &fakeMover{fail: map[int64]bool{1: true}}
+	if o.move(tm, root, m) {
+		t.Fatal("move succeeded without pointing the track at it")
+	}
+	if m.Error == "" {
+		t.Error("failed move has no error")
+	}
+	// the file is back where the track says it is
+	want := []string{"A/", "in/", "in/x.mp3"}
+	if got := listFiles(t, root); !equalPaths(got, want) {
+		t.Errorf("rolled back to %v, want %v", got, want)
+	}
+}
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	root := makeFiles(t, "a/b/c/.keep", "a/other.mp3")
+	defer os.RemoveAll(root)
+	if err := os.Remove(filepath.Join(root, "a", "b", "c", ".keep")); err != nil {
+		t.Fatal(err)
+	}
+
+	removeEmptyDirs(filepath.Join(root, "a", "b", "c"), root)
+	want := []string{"a/", "a/other.mp3"}
+	if got := listFiles(t, root); !equalPaths(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+
+	// the root itself and directories outside it are never removed
+	if err := os.Remove(filepath.Join(root, "a", "other.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	removeEmptyDirs(filepath.Join(root, "a"), filepath.Join(root, "a"))
+	outside, err := ioutil.TempDir("", "gobcast-organise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	removeEmptyDirs(outside, root)
+	if _, err = os.Stat(filepath.Join(root, "a")); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+	if _, err = os.Stat(outside); err != nil {
+		t.Errorf("directory outside root removed: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package playlists
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/config"
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Importer imports playlist files as playlists
+type Importer struct {
+	DB      *pg.DB
+	Storage *storage.Resolver
+	Matcher Matcher
+}
+
+// NewImporter creates an Importer using the storage settings of cfg
+func NewImporter(db *pg.DB, cfg *config.Config) *Importer {
+	return &Importer{
+		DB:      db,
+		Storage: storage.NewResolver(cfg),
+		Matcher: Matcher{
+			DB:              db,
+			LengthTolerance: DefaultLengthTolerance,
+		},
+	}
+}
+
+// Result is the outcome of importing a playlist file
+type Result struct {
+	Playlist *models.Playlist `json:"playlist"`
+	// Resolved is the number of entries matched to tracks
+	Resolved int `json:"resolved"`
+	// Unresolved are the entries that matched no track
+	Unresolved []models.UnresolvedEntry `json:"unresolved"`
+	// Unchanged is set when the file is the same as when it was imported
+	// before, only it's unresolved entries where matched again and
+	// Resolved counts those that matched now
+	Unchanged bool `json:"unchanged"`
+}
+
+// Find returns the playlist files under the library path at root that are
+// not ignored, local library paths are walked with opts
+func (imp *Importer) Find(ctx context.Context, root string, opts utils.WalkOptions) (paths []string, err error) {
+	st, prefix, err := imp.Storage.ResolveDir(root)
+	if err != nil {
+		return
+	}
+	if !storage.IsRemote(root) {
+		st = &storage.Local{Walk: opts}
+	}
+	err = st.List(ctx, prefix, func(obj storage.Object) error {
+		p := st.Path(obj.Key)
+		if !IsPlaylist(p) || opts.Ignore != nil && opts.Ignore.Ignored(p, false) {
+			return nil
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	return
+}
+
+// ImportFile imports the playlist file at path, a local path or the URL of
+// an object. A file imported before has it's playlist replaced when it
+// changed since.
+func (imp *Importer) ImportFile(ctx context.Context, p string) (*Result, error) {
+	st, key, err := imp.Storage.Resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := st.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	pq := models.PlaylistQuery{
+		DB: imp.DB,
+	}
+	playlist, err := pq.GetPlaylistBySource(p)
+	if err != nil && err != pg.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && playlist.SourceUnchanged(obj.Info()) {
+		return imp.rematch(playlist, dirOf(p))
+	}
+	if err == pg.ErrNoRows {
+		playlist = new(models.Playlist)
+	}
+
+	f, err := st.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := Parse(f, key)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist.Name = playlistName(file, p)
+	playlist.Source = p
+	playlist.SourceMtime = obj.ModTime.Truncate(time.Microsecond)
+	playlist.SourceSize = obj.Size
+	return imp.save(playlist, file, dirOf(p))
+}
+
+// Import imports a parsed playlist file that isn't in a library, like an
+// upload, as a new playlist named name, or by the file's title if name is
+// empty. With no directory to take them from, relative entries can only be
+// matched by the end of their path or their metadata.
+func (imp *Importer) Import(file *File, name string) (*Result, error) {
+	if name == "" {
+		name = file.Title
+	}
+	return imp.save(&models.Playlist{Name: name}, file, "")
+}
+
+// save matches the entries of file to tracks and stores the playlist
+func (imp *Importer) save(playlist *models.Playlist, file *File, dir string) (*Result, error) {
+	res := &Result{Playlist: playlist}
+	var tracks []models.PlaylistTrack
+	for i, e := range file.Entries {
+		id, err := imp.Matcher.Match(e, dir)
+		if err != nil {
+			return nil, err
+		}
+		if id != 0 {
+			tracks = append(tracks, models.PlaylistTrack{TrackID: id, Position: i, Location: e.Location})
+			continue
+		}
+		res.Unresolved = append(res.Unresolved, models.UnresolvedEntry{
+			Position: i,
+			Location: e.Location,
+			Title:    e.Title,
+			Artist:   e.Artist,
+			Album:    e.Album,
+			Length:   e.Length,
+		})
+	}
+
+	pq := models.PlaylistQuery{
+		DB: imp.DB,
+	}
+	tracks, unresolved, err := pq.SaveImport(playlist, tracks, res.Unresolved)
+	if err != nil {
+		return nil, err
+	}
+	res.Resolved = len(tracks)
+	res.Unresolved = unresolved
+	return res, nil
+}
+
+// rematch matches the unresolved entries of an imported playlist again, the
+// tracks they are for may have been imported since
+func (imp *Importer) rematch(playlist *models.Playlist, dir string) (*Result, error) {
+	pq := models.PlaylistQuery{
+		DB: imp.DB,
+	}
+	entries, err := pq.GetUnresolved(playlist.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Playlist: playlist, Unchanged: true}
+	for _, ue := range entries {
+		id, err := imp.Matcher.Match(Entry{
+			Location: ue.Location,
+			Title:    ue.Title,
+			Artist:   ue.Artist,
+			Album:    ue.Album,
+			Length:   ue.Length,
+		}, dir)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			res.Unresolved = append(res.Unresolved, ue)
+			continue
+		}
+		if _, err = pq.MatchUnresolved(playlist.ID, ue.ID, id, false); err != nil {
+			return nil, err
+		}
+		res.Resolved++
+	}
+	return res, nil
+}
+
+// playlistName names the playlist of a file, by it's title or else the name
+// of the file at p
+func playlistName(file *File, p string) string {
+	if file.Title != "" {
+		return file.Title
+	}
+	base := path.Base(strings.Replace(p, `\`, "/", -1))
+	return strings.TrimSuffix(base, path.Ext(base))
+}
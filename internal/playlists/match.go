@@ -0,0 +1,183 @@
+package playlists
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+	"github.com/ryex/go-broadcaster/internal/storage"
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// DefaultLengthTolerance is how far the length of a track may be from the
+// length an entry gives for the track to match it by metadata
+const DefaultLengthTolerance = 3 * time.Second
+
+// Matcher finds the tracks the entries of playlist files are for
+type Matcher struct {
+	DB              *pg.DB
+	LengthTolerance time.Duration
+}
+
+// Match returns the id of the track entry is for, or 0 when no track
+// matches. dir is the directory of the playlist file relative entries are
+// taken from, it's empty for files that are not in a library.
+func (m *Matcher) Match(e Entry, dir string) (int64, error) {
+	tq := models.TrackQuery{
+		DB: m.DB,
+	}
+
+	p, abs := locate(e.Location, dir)
+	if abs {
+		t, err := tq.GetTrackByPath(p)
+		if err == nil {
+			if t.ReplacedBy != 0 {
+				return t.ReplacedBy, nil
+			}
+			return t.ID, nil
+		}
+		if err != pg.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	// files written on other machines, or whose tracks where moved since,
+	// only share the end of their paths with the tracks
+	if p != "" {
+		for _, suffix := range pathSuffixes(p) {
+			tracks, err := tq.GetTracksByPathSuffix(suffix, 2)
+			if err != nil {
+				return 0, err
+			}
+			if len(tracks) == 1 {
+				return tracks[0].ID, nil
+			}
+			if len(tracks) > 1 {
+				break
+			}
+		}
+	}
+
+	artist, title := e.Artist, e.Title
+	if title == "" && p != "" {
+		base := path.Base(p)
+		artist, title = splitArtistTitle(strings.TrimSuffix(base, path.Ext(base)))
+	}
+	if title == "" {
+		return 0, nil
+	}
+	tracks, err := tq.GetTracksByTitle(title)
+	if err != nil {
+		return 0, err
+	}
+	tolerance := m.LengthTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultLengthTolerance
+	}
+	if t := pickByMetadata(tracks, artist, e.Length, tolerance); t != nil {
+		return t.ID, nil
+	}
+	return 0, nil
+}
+
+// locate turns the location of an entry into a slash separated path,
+// relative locations are taken from dir when it's set. abs tells if the
+// path can be the path of a track, locations written on Windows or that
+// are relative to nothing can't. URLs other than file:// and s3:// ones
+// have no path.
+func locate(location, dir string) (p string, abs bool) {
+	if storage.IsRemote(location) {
+		return location, true
+	}
+	if strings.HasPrefix(strings.ToLower(location), "file:") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", false
+		}
+		location = u.Path
+		// file:///C:/Music/a.mp3
+		if len(location) > 2 && location[0] == '/' && location[2] == ':' {
+			location = location[1:]
+		}
+	} else if strings.Contains(location, "://") {
+		return "", false
+	}
+
+	location = strings.Replace(location, `\`, "/", -1)
+	if len(location) > 1 && location[1] == ':' {
+		return path.Clean(location), false
+	}
+	if strings.HasPrefix(location, "/") {
+		return filepath.ToSlash(filepath.Clean(location)), true
+	}
+	if dir == "" {
+		return path.Clean(location), false
+	}
+	if storage.IsRemote(dir) {
+		rest := strings.TrimPrefix(dir, storage.S3Scheme+"://")
+		return storage.S3Scheme + "://" + path.Join(rest, location), true
+	}
+	return filepath.Join(dir, filepath.FromSlash(location)), true
+}
+
+// dirOf returns the directory of the playlist file at p
+func dirOf(p string) string {
+	if storage.IsRemote(p) {
+		rest := strings.TrimPrefix(p, storage.S3Scheme+"://")
+		return storage.S3Scheme + "://" + path.Dir(rest)
+	}
+	return filepath.Dir(p)
+}
+
+// pathSuffixes returns the ends of p tracks are looked up by, it's last
+// directory and name then only it's name
+func pathSuffixes(p string) []string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	base := parts[len(parts)-1]
+	if base == "" || base == "." || base == ".." {
+		return nil
+	}
+	if len(parts) < 2 || parts[len(parts)-2] == ".." || strings.HasSuffix(parts[len(parts)-2], ":") {
+		return []string{"/" + base}
+	}
+	return []string{"/" + parts[len(parts)-2] + "/" + base, "/" + base}
+}
+
+// pickByMetadata picks the track an entry with artist and length is for
+// out of the tracks with it's title. Tracks of other artists are passed
+// over and when the length is known the track closest to it within
+// tolerance is picked. Without an artist or a length to go by only a single
+// track is trusted.
+func pickByMetadata(tracks []models.Track, artist string, length, tolerance time.Duration) *models.Track {
+	var candidates []*models.Track
+	name := utils.NormalizeName(artist)
+	for i := range tracks {
+		if artist == "" || utils.NormalizeName(tracks[i].Artist) == name {
+			candidates = append(candidates, &tracks[i])
+		}
+	}
+	if length <= 0 {
+		if len(candidates) == 1 || artist != "" && len(candidates) > 0 {
+			return candidates[0]
+		}
+		return nil
+	}
+
+	var best *models.Track
+	var bestDiff time.Duration
+	for _, t := range candidates {
+		diff := t.Length - length
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= tolerance && (best == nil || diff < bestDiff) {
+			best, bestDiff = t, diff
+		}
+	}
+	return best
+}
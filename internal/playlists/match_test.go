@@ -0,0 +1,92 @@
+package playlists
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/models"
+)
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		location string
+		dir      string
+		path     string
+		abs      bool
+	}{
+		{"/music/a.mp3", "/lists", "/music/a.mp3", true},
+		{"Jazz/a.mp3", "/music/lists", "/music/lists/Jazz/a.mp3", true},
+		{"../a.mp3", "/music/lists", "/music/a.mp3", true},
+		{`..\Jazz\a.mp3`, "/music/lists", "/music/Jazz/a.mp3", true},
+		{"file:///music/Miles%20Davis/a.mp3", "", "/music/Miles Davis/a.mp3", true},
+		{"file:///C:/Music/a.mp3", "", "C:/Music/a.mp3", false},
+		{`C:\Music\Jazz\a.mp3`, "/lists", "C:/Music/Jazz/a.mp3", false},
+		{"Jazz/a.mp3", "", "Jazz/a.mp3", false},
+		{"http://stream.example.com/live", "/lists", "", false},
+		{"s3://library/a.mp3", "/lists", "s3://library/a.mp3", true},
+		{"../Jazz/a.mp3", "s3://library/music/lists", "s3://library/music/Jazz/a.mp3", true},
+	}
+	for _, tc := range tests {
+		p, abs := locate(tc.location, tc.dir)
+		if p != tc.path || abs != tc.abs {
+			t.Errorf("locate(%q, %q) = %q, %v, want %q, %v", tc.location, tc.dir, p, abs, tc.path, tc.abs)
+		}
+	}
+	if d := dirOf("s3://library/music/list.m3u"); d != "s3://library/music" {
+		t.Errorf("directory of remote file is %s", d)
+	}
+}
+
+func TestPathSuffixes(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"C:/Music/Jazz/a.mp3", []string{"/Jazz/a.mp3", "/a.mp3"}},
+		{"C:/a.mp3", []string{"/a.mp3"}},
+		{"../a.mp3", []string{"/a.mp3"}},
+		{"a.mp3", []string{"/a.mp3"}},
+		{"..", nil},
+	}
+	for _, tc := range tests {
+		if got := pathSuffixes(tc.path); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("pathSuffixes(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestPickByMetadata(t *testing.T) {
+	tracks := []models.Track{
+		{ID: 1, Artist: "The Beatles", Length: 180 * time.Second},
+		{ID: 2, Artist: "Beatles, The", Length: 200 * time.Second},
+		{ID: 3, Artist: "Someone Else", Length: 201 * time.Second},
+	}
+	tests := []struct {
+		name   string
+		artist string
+		length time.Duration
+		want   int64
+	}{
+		{"closest length", "beatles", 199 * time.Second, 2},
+		{"outside tolerance", "beatles", 190 * time.Second, 0},
+		{"first of artist", "the beatles", 0, 1},
+		{"other artist", "Someone Else", 0, 3},
+		{"no artist by length", "", 201 * time.Second, 3},
+		{"no artist or length", "", 0, 0},
+		{"unknown artist", "Nobody", 180 * time.Second, 0},
+	}
+	for _, tc := range tests {
+		got := pickByMetadata(tracks, tc.artist, tc.length, 3*time.Second)
+		var id int64
+		if got != nil {
+			id = got.ID
+		}
+		if id != tc.want {
+			t.Errorf("%s: picked %d, want %d", tc.name, id, tc.want)
+		}
+	}
+	if got := pickByMetadata(tracks[2:], "", 0, 3*time.Second); got == nil || got.ID != 3 {
+		t.Errorf("single track not picked: %v", got)
+	}
+}
@@ -0,0 +1,235 @@
+// Package playlists imports playlist files, like the M3U, PLS and XSPF files
+// other playout systems keep next to the audio, as playlists of tracks.
+//
+// The entries of a file are matched to tracks by their path, relative
+// entries taken from the directory of the file, then by the end of their
+// path for files written on other machines and last by their artist, title
+// and length. Entries that match no track are kept to be matched by hand.
+package playlists
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Exts are the extensions of the playlist files that can be imported
+var Exts = []string{".m3u", ".m3u8", ".pls", ".xspf"}
+
+// ErrUnknownFormat is returned for files that are not playlists
+var ErrUnknownFormat = errors.New("unknown playlist format")
+
+// MaxFileSize is the largest playlist file read, files are cut off there
+const MaxFileSize = 16 << 20
+
+// IsPlaylist tests if path has the extension of a playlist file
+func IsPlaylist(path string) bool {
+	return utils.HasExtension(path, Exts)
+}
+
+// File is a parsed playlist file
+type File struct {
+	// Title is the title the file gives the playlist, if any
+	Title   string
+	Entries []Entry
+}
+
+// Entry is an item of a playlist file, only Location is always set
+type Entry struct {
+	// Location is the path or URL of the entry as written in the file
+	Location string
+	Title    string
+	Artist   string
+	Album    string
+	// Length is zero when the file doesn't tell it
+	Length time.Duration
+}
+
+// Parse reads the playlist file called name from r, it's format is told
+// by the extension of name
+func Parse(r io.Reader, name string) (*File, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxFileSize))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8":
+		return parseM3U(text(data)), nil
+	case ".pls":
+		return parsePLS(text(data)), nil
+	case ".xspf":
+		return parseXSPF(data)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// text decodes the content of a text playlist file. Files that are not
+// valid UTF-8 are taken to be Latin-1, as older M3U files usually are.
+func text(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// parseM3U parses a plain or extended M3U file
+func parseM3U(s string) *File {
+	f := new(File)
+	var info Entry
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			f.Title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			info.Location = line
+			f.Entries = append(f.Entries, info)
+			info = Entry{}
+		}
+	}
+	return f
+}
+
+// parseExtInf parses the "length,Artist - Title" of an #EXTINF line, the
+// length may be followed by attributes
+func parseExtInf(s string) Entry {
+	var e Entry
+	i := strings.IndexByte(s, ',')
+	if i < 0 {
+		return e
+	}
+	length := s[:i]
+	if j := strings.IndexAny(length, " \t"); j >= 0 {
+		length = length[:j]
+	}
+	if secs, err := strconv.ParseFloat(length, 64); err == nil && secs > 0 {
+		e.Length = time.Duration(secs * float64(time.Second))
+	}
+	e.Artist, e.Title = splitArtistTitle(strings.TrimSpace(s[i+1:]))
+	return e
+}
+
+// splitArtistTitle splits "Artist - Title", without a separator it's all
+// the title
+func splitArtistTitle(s string) (artist, title string) {
+	if i := strings.Index(s, " - "); i >= 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+3:])
+	}
+	return "", s
+}
+
+// parsePLS parses a PLS file, entries are ordered by their number
+func parsePLS(s string) *File {
+	entries := make(map[int]*Entry)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, '=')
+		if i < 0 || strings.HasPrefix(line, "[") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			continue
+		}
+		e, ok := entries[n]
+		if !ok {
+			e = new(Entry)
+			entries[n] = e
+		}
+		switch field {
+		case "file":
+			e.Location = value
+		case "title":
+			e.Artist, e.Title = splitArtistTitle(value)
+		case "length":
+			if secs, lerr := strconv.Atoi(value); lerr == nil && secs > 0 {
+				e.Length = time.Duration(secs) * time.Second
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n, e := range entries {
+		if e.Location != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	f := new(File)
+	for _, n := range numbers {
+		f.Entries = append(f.Entries, *entries[n])
+	}
+	return f
+}
+
+// xspfPlaylist is the part of an XSPF file that is read
+type xspfPlaylist struct {
+	Title  string `xml:"title"`
+	Tracks []struct {
+		Locations []string `xml:"location"`
+		Title     string   `xml:"title"`
+		Creator   string   `xml:"creator"`
+		Album     string   `xml:"album"`
+		// Duration is in milliseconds
+		Duration int64 `xml:"duration"`
+	} `xml:"trackList>track"`
+}
+
+// parseXSPF parses an XSPF file, the first location of each track is used
+// and tracks without one are skipped
+func parseXSPF(data []byte) (*File, error) {
+	var p xspfPlaylist
+	if err := xml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	f := &File{Title: strings.TrimSpace(p.Title)}
+	for _, t := range p.Tracks {
+		if len(t.Locations) == 0 || strings.TrimSpace(t.Locations[0]) == "" {
+			continue
+		}
+		// locations are URIs, relative ones are only escaped paths
+		loc := strings.TrimSpace(t.Locations[0])
+		if u, err := url.Parse(loc); err == nil && u.Scheme == "" {
+			loc = u.Path
+		}
+		f.Entries = append(f.Entries, Entry{
+			Location: loc,
+			Title:    strings.TrimSpace(t.Title),
+			Artist:   strings.TrimSpace(t.Creator),
+			Album:    strings.TrimSpace(t.Album),
+			Length:   time.Duration(t.Duration) * time.Millisecond,
+		})
+	}
+	return f, nil
+}
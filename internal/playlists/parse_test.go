@@ -0,0 +1,118 @@
+package playlists
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseM3U(t *testing.T) {
+	data := "\xef\xbb\xbf#EXTM3U\n" +
+		"#PLAYLIST:Morning Show\n" +
+		"#EXTINF:215,Miles Davis - So What\n" +
+		"Jazz/So What.mp3\n" +
+		"\n" +
+		"# a comment\n" +
+		"#EXTINF:-1 tvg-id=\"x\",Station ID\n" +
+		"C:\\Radio\\ids\\id1.wav\n" +
+		"/music/b.flac\n"
+	f, err := Parse(strings.NewReader(data), "show.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &File{
+		Title: "Morning Show",
+		Entries: []Entry{
+			{Location: "Jazz/So What.mp3", Artist: "Miles Davis", Title: "So What", Length: 215 * time.Second},
+			{Location: `C:\Radio\ids\id1.wav`, Title: "Station ID"},
+			{Location: "/music/b.flac"},
+		},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("got %+v, want %+v", f, want)
+	}
+
+	// Latin-1 files are decoded
+	f, err = Parse(strings.NewReader("#EXTINF:10,Bj\xf6rk - J\xf3ga\nj.mp3\n"), "a.M3U")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Entries) != 1 || f.Entries[0].Artist != "Björk" || f.Entries[0].Title != "Jóga" {
+		t.Errorf("latin-1 entry parsed as %+v", f.Entries)
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	data := "[playlist]\n" +
+		"NumberOfEntries=3\n" +
+		"File2=http://stream.example.com/live\n" +
+		"Title2=Live\n" +
+		"Length2=-1\n" +
+		"File1=../a.mp3\n" +
+		"Title1=Artist - Song\n" +
+		"Length1=180\n" +
+		"Title3=no file\n" +
+		"Version=2\n"
+	f, err := Parse(strings.NewReader(data), "list.pls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Location: "../a.mp3", Artist: "Artist", Title: "Song", Length: 180 * time.Second},
+		{Location: "http://stream.example.com/live", Title: "Live"},
+	}
+	if !reflect.DeepEqual(f.Entries, want) {
+		t.Errorf("got %+v, want %+v", f.Entries, want)
+	}
+}
+
+func TestParseXSPF(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Drive Time</title>
+  <trackList>
+    <track>
+      <location>file:///music/Miles%20Davis/So%20What.mp3</location>
+      <location>http://example.com/so-what.mp3</location>
+      <title>So What</title>
+      <creator>Miles Davis</creator>
+      <album>Kind of Blue</album>
+      <duration>562000</duration>
+    </track>
+    <track>
+      <title>No location</title>
+    </track>
+    <track>
+      <location>sub/A%20Song.ogg</location>
+    </track>
+  </trackList>
+</playlist>`
+	f, err := Parse(strings.NewReader(data), "drive.xspf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &File{
+		Title: "Drive Time",
+		Entries: []Entry{
+			{
+				Location: "file:///music/Miles%20Davis/So%20What.mp3",
+				Title:    "So What",
+				Artist:   "Miles Davis",
+				Album:    "Kind of Blue",
+				Length:   562 * time.Second,
+			},
+			{Location: "sub/A Song.ogg"},
+		},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("got %+v, want %+v", f, want)
+	}
+
+	if _, err = Parse(strings.NewReader("<playlist"), "bad.xspf"); err == nil {
+		t.Error("broken xspf parsed")
+	}
+	if _, err = Parse(strings.NewReader(""), "a.txt"); err != ErrUnknownFormat {
+		t.Errorf("unknown format gave %v", err)
+	}
+}
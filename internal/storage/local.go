@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"os"
+
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Local is the local file system, the keys of it's objects are their
+// absolute file paths
+type Local struct {
+	// Walk are the options directories are listed with
+	Walk utils.WalkOptions
+}
+
+// List calls fn for every file in the directory prefix and below it
+func (l *Local) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	w := utils.NewFileWalker(ctx, prefix, l.Walk)
+	for w.Next() {
+		if err := fn(localObject(w.Path(), w.Info())); err != nil {
+			return err
+		}
+	}
+	return w.Err()
+}
+
+// Stat describes the file at key
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	info, err := os.Stat(key)
+	if err != nil {
+		return Object{}, err
+	}
+	return localObject(key, info), nil
+}
+
+// Open opens the file at key
+func (l *Local) Open(ctx context.Context, key string) (File, error) {
+	f, err := os.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &localFile{File: f, size: info.Size()}, nil
+}
+
+// Path returns key, local tracks are stored with their file path
+func (l *Local) Path(key string) string {
+	return key
+}
+
+func localObject(path string, info os.FileInfo) Object {
+	return Object{
+		Key:     path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+}
+
+type localFile struct {
+	*os.File
+	size int64
+}
+
+func (f *localFile) Size() int64 {
+	return f.size
+}
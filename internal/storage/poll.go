@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/logutils"
+)
+
+// Op is the kind of change made to an object
+type Op int
+
+const (
+	// Created is an object that appeared
+	Created Op = iota + 1
+	// Modified is an object whose size, modification time or ETag changed
+	Modified
+	// Removed is an object that is gone
+	Removed
+)
+
+func (op Op) String() string {
+	switch op {
+	case Created:
+		return "created"
+	case Modified:
+		return "modified"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// Event is a change to an object found by Poll
+type Event struct {
+	Op     Op
+	Object Object
+}
+
+// Poll lists the objects under prefix every interval and sends the changes
+// since the listing before down the returned channel, which is closed once
+// ctx is done. This is how storages without change notifications, like
+// object stores, are watched. The first listing only records the objects
+// later listings are compared with, and failed listings are logged and
+// skipped so no object is reported removed because of them.
+func Poll(ctx context.Context, st Storage, prefix string, interval time.Duration) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		p := &poller{st: st, prefix: prefix}
+		if err := p.init(ctx); err != nil && ctx.Err() == nil {
+			logutils.Log.Errorf("Error listing '%s': %s", st.Path(prefix), err)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			changes, err := p.poll(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logutils.Log.Errorf("Error listing '%s': %s", st.Path(prefix), err)
+				}
+				continue
+			}
+			for _, ev := range changes {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// poller compares listings of the objects under a prefix
+type poller struct {
+	st     Storage
+	prefix string
+	// objects is the last listing, nil until there was one
+	objects map[string]Object
+}
+
+// init records the objects listed now
+func (p *poller) init(ctx context.Context) error {
+	objects, err := Snapshot(ctx, p.st, p.prefix)
+	if err != nil {
+		return err
+	}
+	p.objects = objects
+	return nil
+}
+
+// poll lists the objects again and returns what changed, sorted by key
+// within each kind of change. If there was no listing before it only
+// records this one.
+func (p *poller) poll(ctx context.Context) ([]Event, error) {
+	objects, err := Snapshot(ctx, p.st, p.prefix)
+	if err != nil {
+		return nil, err
+	}
+	old := p.objects
+	p.objects = objects
+	if old == nil {
+		return nil, nil
+	}
+
+	var created, modified, removed []Event
+	for key, o := range objects {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			created = append(created, Event{Op: Created, Object: o})
+		case o.Changed(prev):
+			modified = append(modified, Event{Op: Modified, Object: o})
+		}
+	}
+	for key, o := range old {
+		if _, ok := objects[key]; !ok {
+			removed = append(removed, Event{Op: Removed, Object: o})
+		}
+	}
+	sortEvents(created)
+	sortEvents(modified)
+	sortEvents(removed)
+	return append(append(created, modified...), removed...), nil
+}
+
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Object.Key < events[j].Object.Key
+	})
+}
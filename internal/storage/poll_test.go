@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPoller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobcast-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.mp3", "a")
+	write("b.mp3", "b")
+	write("sub/c.mp3", "c")
+
+	ctx := context.Background()
+	p := &poller{st: &Local{}, prefix: dir}
+	if err = p.init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events, err := p.poll(ctx)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("unchanged tree gave %v, %v", events, err)
+	}
+
+	write("b.mp3", "longer b")
+	write("sub/d.mp3", "d")
+	os.Remove(filepath.Join(dir, "a.mp3"))
+	events, err = p.poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		op   Op
+		name string
+	}{
+		{Created, "sub/d.mp3"},
+		{Modified, "b.mp3"},
+		{Removed, "a.mp3"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	for i, w := range want {
+		if events[i].Op != w.op || events[i].Object.Key != filepath.Join(dir, w.name) {
+			t.Errorf("event %d is %s %s, want %s %s", i, events[i].Op, events[i].Object.Key, w.op, w.name)
+		}
+	}
+
+	// a failed listing reports nothing and keeps the last one
+	p.prefix = filepath.Join(dir, "gone")
+	if _, err = p.poll(ctx); err == nil {
+		t.Fatal("listing a missing directory succeeded")
+	}
+	p.prefix = dir
+	if events, err = p.poll(ctx); err != nil || len(events) != 0 {
+		t.Errorf("poll after failure gave %v, %v", events, err)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ryex/go-broadcaster/internal/config"
+)
+
+// S3Scheme is the URL scheme of the paths of objects in an object store
+const S3Scheme = "s3"
+
+// ErrNoS3 is returned for s3:// paths when no object store is configured
+var ErrNoS3 = errors.New("no s3 endpoint configured")
+
+// IsRemote tests if path is the URL of an object in an object store rather
+// than a local file path
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, S3Scheme+"://")
+}
+
+// Resolver finds the storage holding the file at a track or library path.
+// It is safe for concurrent use.
+type Resolver struct {
+	// Local is the storage of local paths
+	Local *Local
+	// S3 is the object store s3:// paths are in
+	S3 config.S3Config
+	// Client makes the requests to the object store, http.DefaultClient
+	// when nil
+	Client *http.Client
+
+	mu      sync.Mutex
+	buckets map[string]*S3
+}
+
+// NewResolver creates a Resolver using the storage settings of cfg
+func NewResolver(cfg *config.Config) *Resolver {
+	return &Resolver{
+		Local: &Local{},
+		S3:    cfg.S3,
+	}
+}
+
+// Resolve returns the storage holding the file at path and it's key in that
+// storage. For local paths the key is the path itself, for s3://bucket/key
+// URLs it's the key within the bucket.
+func (r *Resolver) Resolve(path string) (Storage, string, error) {
+	if !IsRemote(path) {
+		return r.Local, path, nil
+	}
+	rest := strings.TrimPrefix(path, S3Scheme+"://")
+	bucket := rest
+	key := ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		bucket, key = rest[:i], rest[i+1:]
+	}
+	if bucket == "" {
+		return nil, "", fmt.Errorf("no bucket in '%s'", path)
+	}
+	if r.S3.Endpoint == "" {
+		return nil, "", ErrNoS3
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buckets == nil {
+		r.buckets = make(map[string]*S3)
+	}
+	s, ok := r.buckets[bucket]
+	if !ok {
+		s = &S3{
+			Endpoint:  r.S3.Endpoint,
+			Region:    r.S3.Region,
+			Bucket:    bucket,
+			AccessKey: r.S3.AccessKey,
+			SecretKey: r.S3.SecretKey,
+			Client:    r.Client,
+		}
+		r.buckets[bucket] = s
+	}
+	return s, key, nil
+}
+
+// ResolveDir resolves the path of a directory like a library path, see
+// Resolve. Keys in an object store are made to end in a slash so listing
+// them doesn't take in objects next to the directory sharing it's name.
+func (r *Resolver) ResolveDir(path string) (Storage, string, error) {
+	st, key, err := r.Resolve(path)
+	if err == nil && IsRemote(path) && key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return st, key, err
+}
+
+// Exists tests if there is a file at path, errors other than it not
+// existing count as it being there so files are not given up on because
+// their storage can't be reached
+func (r *Resolver) Exists(ctx context.Context, path string) bool {
+	st, key, err := r.Resolve(path)
+	if err != nil {
+		return true
+	}
+	_, err = st.Stat(ctx, key)
+	return !IsNotExist(err)
+}
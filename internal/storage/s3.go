@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is the region requests are signed for when none is set
+const DefaultRegion = "us-east-1"
+
+// S3 is a bucket in an S3 compatible object store like MinIO. Objects are
+// addressed path style, as MinIO and most other stores expect.
+type S3 struct {
+	// Endpoint is the URL of the object store, like
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Endpoint string
+	// Region requests are signed for, DefaultRegion when empty
+	Region string
+	Bucket string
+	// AccessKey and SecretKey sign the requests, they are sent unsigned
+	// when AccessKey is empty
+	AccessKey string
+	SecretKey string
+	// Client makes the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// S3Error is an error response of an object store
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// listResult is the response of a ListObjectsV2 request
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List calls fn for every object whose key starts with prefix. The
+// modification times are cut down to whole seconds to match those of Stat.
+func (s *S3) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, "GET", "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, c := range result.Contents {
+			err = fn(Object{
+				Key:     c.Key,
+				Size:    c.Size,
+				ModTime: c.LastModified.Truncate(time.Second),
+				ETag:    strings.Trim(c.ETag, `"`),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Stat describes the object with key
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	resp, err := s.do(ctx, "HEAD", key, nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	return s.responseObject(key, resp)
+}
+
+// Open opens the object with key, it's content is fetched in ranges as it
+// is read
+func (s *S3) Open(ctx context.Context, key string) (File, error) {
+	obj, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3File{s: s, ctx: ctx, obj: obj}, nil
+}
+
+// Path returns the s3:// URL of the object with key
+func (s *S3) Path(key string) string {
+	return S3Scheme + "://" + s.Bucket + "/" + key
+}
+
+// responseObject describes an object from the headers of a response
+func (s *S3) responseObject(key string, resp *http.Response) (Object, error) {
+	obj := Object{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		t, err := http.ParseTime(lm)
+		if err != nil {
+			return obj, err
+		}
+		obj.ModTime = t
+	}
+	return obj, nil
+}
+
+// do sends a signed request for the object with key, or for the bucket if
+// key is empty. Responses other than 2xx are returned as errors, ErrNotExist
+// for missing objects.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u := *endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.AccessKey != "" {
+		region := s.Region
+		if region == "" {
+			region = DefaultRegion
+		}
+		signV4(req, s.AccessKey, s.SecretKey, region, time.Now())
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, ErrNotExist
+	}
+	serr := &S3Error{StatusCode: resp.StatusCode}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(body, serr)
+	return nil, serr
+}
+
+// s3File reads an object through ranged GET requests. A request is kept
+// open while the object is read in order and dropped when seeking.
+type s3File struct {
+	s   *S3
+	ctx context.Context
+	obj Object
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func (f *s3File) Size() int64 {
+	return f.obj.Size
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.offset >= f.obj.Size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		resp, err := f.get(f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.body = resp.Body
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF && f.offset < f.obj.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.obj.Size
+	}
+	if offset < 0 {
+		return f.offset, fmt.Errorf("s3: seek to negative offset %d", offset)
+	}
+	if offset != f.offset {
+		f.closeBody()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.obj.Size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p)) - 1
+	if end >= f.obj.Size {
+		end = f.obj.Size - 1
+	}
+	resp, err := f.get(off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *s3File) Close() error {
+	f.closeBody()
+	return nil
+}
+
+func (f *s3File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+// get requests the bytes from start to end of the object, or to it's end if
+// end is negative. The request fails if the object was replaced since it
+// was opened.
+func (f *s3File) get(start, end int64) (*http.Response, error) {
+	rng := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		rng += strconv.FormatInt(end, 10)
+	}
+	header := http.Header{
+		"Range": {rng},
+	}
+	if f.obj.ETag != "" {
+		header.Set("If-Match", `"`+f.obj.ETag+`"`)
+	}
+	return f.s.do(f.ctx, "GET", f.obj.Key, nil, header)
+}
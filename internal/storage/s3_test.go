@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "minio"
+	testSecretKey = "minio123"
+	testBucket    = "library"
+)
+
+// fakeS3 is a stand in for a MinIO server holding a single bucket. It
+// checks the signature of every request and lists two objects per page so
+// continuation is exercised.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+	mtimes  map[string]time.Time
+	// ranges are the Range headers of the object requests in order
+	ranges []string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		t:       t,
+		objects: make(map[string][]byte),
+		mtimes:  make(map[string]time.Time),
+	}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeS3) put(key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = data
+	f.mtimes[key] = time.Date(2019, 6, 1, 12, 0, len(f.mtimes), 250e6, time.UTC)
+}
+
+func etagOf(data []byte) string {
+	return fmt.Sprintf("%x", len(data)*7919)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.checkSignature(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error>`)
+		return
+	}
+	prefix := "/" + testBucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message></Error>`)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	if key == "" {
+		f.list(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	data, ok := f.objects[key]
+	mtime := f.mtimes[key]
+	if r.Method == "GET" {
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+	}
+	f.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := `"` + etagOf(data) + `"`
+	if im := r.Header.Get("If-Match"); im != "" && im != etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", mtime.Format(http.TimeFormat))
+	if r.Method == "HEAD" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		return
+	}
+
+	start, end := 0, len(data)-1
+	if rng := r.Header.Get("Range"); rng != "" {
+		parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		start, _ = strconv.Atoi(parts[0])
+		if parts[1] != "" {
+			end, _ = strconv.Atoi(parts[1])
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	w.Write(data[start : end+1])
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) && key > q.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}
+	for i, key := range keys {
+		if i == 2 {
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[i-1]
+			break
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: f.mtimes[key].Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + etagOf(f.objects[key]) + `"`,
+			Size:         len(f.objects[key]),
+		})
+	}
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// checkSignature signs the request as received again and compares the
+// result with the signature sent
+func (f *fakeS3) checkSignature(r *http.Request) bool {
+	now, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return false
+	}
+	req.URL.RawQuery = r.URL.RawQuery
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	signV4(req, testAccessKey, testSecretKey, DefaultRegion, now)
+	return req.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func testS3(url string) *S3 {
+	return &S3{
+		Endpoint:  url,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+	}
+}
+
+func TestS3List(t *testing.T) {
+	f, srv := newFakeS3(t)
+	defer srv.Close()
+	for _, key := range []string{"music/a.mp3", "music/b c.flac", "music/sub/(d).ogg", "musicals/e.mp3", "other.mp3"} {
+		f.put(key, []byte(key))
+	}
+
+	s := testS3(srv.URL)
+	objects, err := Snapshot(context.Background(), s, "music/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("listed %d objects, want 3: %v", len(objects), objects)
+	}
+	o, ok := objects["music/sub/(d).ogg"]
+	if !ok {
+		t.Fatalf("object missing from listing: %v", objects)
+	}
+	if o.Size != int64(len("music/sub/(d).ogg")) || o.ETag != etagOf([]byte(o.Key)) {
+		t.Errorf("unexpected object %+v", o)
+	}
+	if o.ModTime.Nanosecond() != 0 {
+		t.Errorf("modification time %s is not whole seconds", o.ModTime)
+	}
+
+	bad := testS3(srv.URL)
+	bad.SecretKey = "wrong"
+	err = bad.List(context.Background(), "", func(Object) error { return nil })
+	if serr, ok := err.(*S3Error); !ok || serr.Code != "SignatureDoesNotMatch" {
+		t.Errorf("listing with a bad key gave %v", err)
+	}
+}
+
+func TestS3StatOpen(t *testing.T) {
+	f, srv := newFakeS3(t)
+	defer srv.Close()
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	key := "music/Miles Davis (Live).mp3"
+	f.put(key, data)
+	ctx := context.Background()
+	s := testS3(srv.URL)
+
+	if s.Path(key) != "s3://library/"+key {
+		t.Errorf("unexpected path %s", s.Path(key))
+	}
+
+	if _, err := s.Stat(ctx, "music/gone.mp3"); !IsNotExist(err) {
+		t.Errorf("stat of missing object gave %v", err)
+	}
+	if _, err := s.Open(ctx, "music/gone.mp3"); !IsNotExist(err) {
+		t.Errorf("open of missing object gave %v", err)
+	}
+
+	o, err := s.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Size != 1000 || !o.ModTime.Equal(f.mtimes[key].Truncate(time.Second)) {
+		t.Errorf("unexpected stat %+v", o)
+	}
+
+	file, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if file.Size() != 1000 {
+		t.Errorf("size %d, want 1000", file.Size())
+	}
+
+	buf := make([]byte, 10)
+	if _, err = io.ReadFull(file, buf); err != nil || buf[9] != 9 {
+		t.Fatalf("read %v, %v", buf, err)
+	}
+	if _, err = file.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(file)
+	if err != nil || len(rest) != 10 || rest[0] != byte(990%256) {
+		t.Fatalf("read to end %v, %v", rest, err)
+	}
+
+	n, err := file.ReadAt(buf, 500)
+	if err != nil || n != 10 || buf[0] != byte(500%256) {
+		t.Errorf("read at 500 gave %d, %v, %v", n, err, buf)
+	}
+	n, err = file.ReadAt(buf, 995)
+	if err != io.EOF || n != 5 {
+		t.Errorf("read at the end gave %d, %v", n, err)
+	}
+
+	want := []string{"bytes=0-", "bytes=990-", "bytes=500-509", "bytes=995-999"}
+	if strings.Join(f.ranges, " ") != strings.Join(want, " ") {
+		t.Errorf("requested ranges %v, want %v", f.ranges, want)
+	}
+
+	// replacing the object fails reads of the old one
+	f.put(key, data[:500])
+	if _, err = file.ReadAt(buf, 0); err == nil {
+		t.Error("read of replaced object succeeded")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	f, srv := newFakeS3(t)
+	defer srv.Close()
+	f.put("music/a.flac", []byte("fLaC data"))
+
+	dir, err := ioutil.TempDir("", "gobcast-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name, err := Fetch(context.Background(), testS3(srv.URL), "music/a.flac", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil || string(data) != "fLaC data" {
+		t.Errorf("fetched %q, %v", data, err)
+	}
+	if filepath.Ext(name) != ".flac" {
+		t.Errorf("fetched copy %s lost it's extension", name)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	r := &Resolver{Local: &Local{}}
+	st, key, err := r.Resolve("/music/a.mp3")
+	if err != nil || st != r.Local || key != "/music/a.mp3" {
+		t.Errorf("local path resolved to %v, %q, %v", st, key, err)
+	}
+	if _, _, err = r.Resolve("s3://library/a.mp3"); err != ErrNoS3 {
+		t.Errorf("s3 path without endpoint gave %v", err)
+	}
+
+	r.S3.Endpoint = "http://localhost:9000"
+	st, key, err = r.Resolve("s3://library/music/a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := st.(*S3); !ok || s.Bucket != "library" || key != "music/a.mp3" {
+		t.Errorf("s3 path resolved to %v, %q", st, key)
+	}
+	if st.Path(key) != "s3://library/music/a.mp3" {
+		t.Errorf("path of resolved key is %s", st.Path(key))
+	}
+	if _, key, _ = r.ResolveDir("s3://library/music"); key != "music/" {
+		t.Errorf("directory key %q, want music/", key)
+	}
+	if _, key, _ = r.ResolveDir("s3://library"); key != "" {
+		t.Errorf("bucket key %q, want empty", key)
+	}
+	if _, _, err = r.Resolve("s3:///a.mp3"); err == nil {
+		t.Error("path without bucket resolved")
+	}
+}
@@ -0,0 +1,127 @@
+// Package storage gives access to the files of a library wherever they are
+// kept, on the local file system or in an S3 compatible object store.
+//
+// Files are called objects and are addressed by a key within their
+// storage. Tracks store the path of their file as given by Storage.Path,
+// which is the file path for local files and an s3:// URL for objects in
+// an object store. A Resolver finds the storage and key of such a path.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned for objects that don't exist
+var ErrNotExist = errors.New("object does not exist")
+
+// IsNotExist tests if err means an object doesn't exist
+func IsNotExist(err error) bool {
+	return err == ErrNotExist || os.IsNotExist(err)
+}
+
+// Object describes a file in a storage
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// ETag identifies the content of objects in an object store, it's
+	// empty for local files
+	ETag string `json:"etag,omitempty"`
+}
+
+// Info returns the object as an os.FileInfo
+func (o Object) Info() os.FileInfo {
+	return objectInfo{o}
+}
+
+// Changed tests if the object differs from it's earlier state old
+func (o Object) Changed(old Object) bool {
+	return o.Size != old.Size || !o.ModTime.Equal(old.ModTime) || o.ETag != old.ETag
+}
+
+type objectInfo struct {
+	o Object
+}
+
+func (oi objectInfo) Name() string       { return path.Base(oi.o.Key) }
+func (oi objectInfo) Size() int64        { return oi.o.Size }
+func (oi objectInfo) Mode() os.FileMode  { return 0444 }
+func (oi objectInfo) ModTime() time.Time { return oi.o.ModTime }
+func (oi objectInfo) IsDir() bool        { return false }
+func (oi objectInfo) Sys() interface{}   { return nil }
+
+// File is an opened object. Remote objects are read in ranges as needed so
+// seeking around a large object doesn't download all of it.
+type File interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	// Size is the size of the object when it was opened
+	Size() int64
+}
+
+// Storage is a place library files are kept
+type Storage interface {
+	// List calls fn for every object under prefix. An error returned by
+	// fn stops the listing and is returned.
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+	// Stat describes the object with key
+	Stat(ctx context.Context, key string) (Object, error)
+	// Open opens the object with key for reading
+	Open(ctx context.Context, key string) (File, error)
+	// Path returns the path a track of the object with key is stored with
+	Path(key string) string
+}
+
+// Snapshot lists the objects under prefix by their keys
+func Snapshot(ctx context.Context, st Storage, prefix string) (map[string]Object, error) {
+	objects := make(map[string]Object)
+	err := st.List(ctx, prefix, func(o Object) error {
+		objects[o.Key] = o
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Fetch copies the object with key into a new temporary file in dir and
+// returns it's path, which keeps the extension of the key. The caller must
+// remove it.
+func Fetch(ctx context.Context, st Storage, key, dir string) (name string, err error) {
+	in, err := st.Open(ctx, key)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	ext := path.Ext(key)
+	if strings.ContainsAny(ext, "*/") {
+		ext = ""
+	}
+	out, err := ioutil.TempFile(dir, "fetch*"+ext)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return out.Name(), err
+}
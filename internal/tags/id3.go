@@ -0,0 +1,274 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3 frame flags that change how the frame data is stored
+const (
+	id3v23Compressed = 0x0080
+	id3v23Encrypted  = 0x0040
+	id3v23Grouped    = 0x0020
+	id3v24Grouped    = 0x0040
+	id3v24Compressed = 0x0008
+	id3v24Encrypted  = 0x0004
+	id3v24Unsynced   = 0x0002
+	id3v24DataLength = 0x0001
+)
+
+// errNoID3v2 is returned when a file doesn't start with an ID3v2 tag
+var errNoID3v2 = errors.New("no ID3v2 tag")
+
+// readID3Text reads the values of the text frames in ids from the ID3v2 tag
+// at the start of r. Unlike most readers the null separated values of
+// ID3v2.4 frames and repeated frames are kept as separate values.
+// ids has the four letter frame ids, the three letter ones of ID3v2.2 are
+// mapped to them.
+func readID3Text(r io.Reader, ids ...string) (map[string][]string, error) {
+	var h [10]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	if string(h[:3]) != "ID3" {
+		return nil, errNoID3v2
+	}
+	version, flags := h[3], h[5]
+	if version < 2 || version > 4 {
+		return nil, errors.New("unsupported ID3v2 version")
+	}
+	data := make([]byte, synchsafe(h[6:10]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		// ID3v2.4 unsynchronises frame by frame instead
+		data = removeUnsync(data)
+	}
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		n := int(binary.BigEndian.Uint32(data)) + 4
+		if version == 4 {
+			n = synchsafe(data[:4])
+		}
+		if n > len(data) {
+			return nil, errors.New("invalid ID3v2 extended header")
+		}
+		data = data[n:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	values := make(map[string][]string)
+	for len(data) >= headerLen && data[0] != 0 {
+		id := string(data[:idLen])
+		var size int
+		var fflags uint16
+		switch version {
+		case 2:
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+			id = id3v22Frames[id]
+		case 3:
+			size = int(binary.BigEndian.Uint32(data[4:]))
+			fflags = binary.BigEndian.Uint16(data[8:])
+		case 4:
+			size = synchsafe(data[4:8])
+			fflags = binary.BigEndian.Uint16(data[8:])
+		}
+		data = data[headerLen:]
+		if size < 0 || size > len(data) {
+			break
+		}
+		frame := data[:size]
+		data = data[size:]
+		if !containsString(ids, id) {
+			continue
+		}
+
+		switch version {
+		case 3:
+			if fflags&(id3v23Compressed|id3v23Encrypted) != 0 {
+				continue
+			}
+			if fflags&id3v23Grouped != 0 && len(frame) > 0 {
+				frame = frame[1:]
+			}
+		case 4:
+			if fflags&(id3v24Compressed|id3v24Encrypted) != 0 {
+				continue
+			}
+			if fflags&id3v24Grouped != 0 && len(frame) > 0 {
+				frame = frame[1:]
+			}
+			if fflags&id3v24DataLength != 0 && len(frame) >= 4 {
+				frame = frame[4:]
+			}
+			if fflags&id3v24Unsynced != 0 || flags&0x80 != 0 {
+				frame = removeUnsync(frame)
+			}
+		}
+		values[id] = append(values[id], decodeID3Text(frame)...)
+	}
+	return values, nil
+}
+
+// id3v22Frames maps the ID3v2.2 text frames read to their later names
+var id3v22Frames = map[string]string{
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TCO": "TCON",
+}
+
+// synchsafe decodes a 28 bit integer stored in 7 bits per byte
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// removeUnsync reverses the ID3v2 unsynchronisation, which inserts a zero
+// byte after every 0xff
+func removeUnsync(b []byte) []byte {
+	return bytes.Replace(b, []byte{0xff, 0x00}, []byte{0xff}, -1)
+}
+
+// decodeID3Text decodes the data of a text frame into it's null separated
+// values
+func decodeID3Text(b []byte) []string {
+	if len(b) < 1 {
+		return nil
+	}
+	enc, b := b[0], b[1:]
+	var values []string
+	switch enc {
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		var units []uint16
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if len(units) == 0 && (u == 0xfeff || u == 0xfffe) {
+				// every value may start with it's own byte order mark
+				if u == 0xfffe {
+					if order == binary.ByteOrder(binary.BigEndian) {
+						order = binary.LittleEndian
+					} else {
+						order = binary.BigEndian
+					}
+				}
+				continue
+			}
+			if u == 0 {
+				values = append(values, string(utf16.Decode(units)))
+				units = units[:0]
+				continue
+			}
+			units = append(units, u)
+		}
+		values = append(values, string(utf16.Decode(units)))
+	case 3:
+		values = strings.Split(string(b), "\x00")
+	default:
+		for _, v := range bytes.Split(b, []byte{0}) {
+			values = append(values, latin1(v))
+		}
+	}
+
+	// the last value may be null terminated too
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// id3Genres resolves the genres of TCON frames, which may refer to the
+// ID3v1 genres by number as "17" or, before ID3v2.4, as "(17)" followed by
+// an optional refinement like "(17)Rock & Roll"
+func id3Genres(values []string) []string {
+	var genres []string
+	for _, v := range values {
+		for strings.HasPrefix(v, "(") && !strings.HasPrefix(v, "((") {
+			end := strings.Index(v, ")")
+			if end < 0 {
+				break
+			}
+			if g := id3Genre(v[1:end]); g != "" {
+				genres = append(genres, g)
+			}
+			v = v[end+1:]
+		}
+		// a refinement starting with a "(" has it doubled
+		v = strings.TrimPrefix(v, "(")
+		if g := id3Genre(v); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
+
+// id3Genre resolves a single genre reference
+func id3Genre(ref string) string {
+	switch ref {
+	case "RX":
+		return "Remix"
+	case "CR":
+		return "Cover"
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil {
+		return ref
+	}
+	if n >= 0 && n < len(id3v1Genres) {
+		return id3v1Genres[n]
+	}
+	return ""
+}
+
+// id3v1Genres are the genres of ID3v1 and their Winamp extensions by number
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebob", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore", "Terror",
+	"Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover",
+	"Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock",
+	"Baroque", "Bhangra", "Big Beat", "Breakbeat", "Chillout", "Downtempo",
+	"Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo",
+	"Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock", "New Romantic",
+	"Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance", "Shoegaze",
+	"Space Rock", "Trop Rock", "World Music", "Neoclassical", "Audiobook",
+	"Audio Theatre", "Neue Deutsche Welle", "Podcast", "Indie Rock",
+	"G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
@@ -0,0 +1,78 @@
+package tags
+
+import (
+	"strings"
+)
+
+// Separators split single tag values that hold several artists or genres,
+// like "Artist A; Artist B". They are matched ignoring ASCII case. Values
+// stored natively as several values, like the null separated values of
+// ID3v2.4 frames and repeated Vorbis comment fields, are split on them too.
+// They are the default of the whole process and only meant to be set while
+// it starts, code with separators of it's own uses SplitOn.
+var Separators = []string{";", " / ", " feat. ", " ft. ", " featuring "}
+
+// Split splits tag values on the Separators, see SplitOn
+func Split(values ...string) []string {
+	return SplitOn(Separators, values...)
+}
+
+// SplitOn splits tag values on separators, dropping empty and repeated
+// values and surrounding whitespace
+func SplitOn(separators []string, values ...string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range splitValue(v, separators) {
+			part = strings.TrimSpace(part)
+			if part == "" || containsString(out, part) {
+				continue
+			}
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// splitValue splits one value on the earliest separator in it, repeatedly
+func splitValue(v string, separators []string) []string {
+	var parts []string
+	lower := asciiLower(v)
+	for {
+		at, n := -1, 0
+		for _, sep := range separators {
+			if sep == "" {
+				continue
+			}
+			i := strings.Index(lower, asciiLower(sep))
+			if i >= 0 && (at < 0 || i < at) {
+				at, n = i, len(sep)
+			}
+		}
+		if at < 0 {
+			return append(parts, v)
+		}
+		parts = append(parts, v[:at])
+		v, lower = v[at+n:], lower[at+n:]
+	}
+}
+
+// asciiLower lower cases the ASCII letters of s only, so the result has
+// the same byte offsets as s
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{[]string{"Artist A; Artist B"}, []string{"Artist A", "Artist B"}},
+		{[]string{"Artist A Feat. Artist B"}, []string{"Artist A", "Artist B"}},
+		{[]string{"Rock / Pop;Jazz"}, []string{"Rock", "Pop", "Jazz"}},
+		{[]string{"AC/DC"}, []string{"AC/DC"}},
+		{[]string{"A", "B; A", " "}, []string{"A", "B"}},
+		{[]string{""}, nil},
+	}
+	for _, tc := range tests {
+		if got := Split(tc.values...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Split(%q) = %q, want %q", tc.values, got, tc.want)
+		}
+	}
+
+	// separators of their own leave the defaults alone
+	if got := SplitOn([]string{" & "}, "A & B; C"); !reflect.DeepEqual(got, []string{"A", "B; C"}) {
+		t.Errorf("SplitOn gave %q", got)
+	}
+	if got := SplitOn(nil, "A; B"); !reflect.DeepEqual(got, []string{"A; B"}) {
+		t.Errorf("SplitOn without separators gave %q", got)
+	}
+}
+
+// id3Tag builds an ID3v2 tag of the given major version holding frames
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	n := len(body)
+	h := []byte{'I', 'D', '3', version, 0, 0,
+		byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(h, body...)
+}
+
+func id3Frame(version byte, id string, data []byte) []byte {
+	n := len(data)
+	f := []byte(id)
+	if version == 4 {
+		f = append(f, byte(n>>21&0x7f), byte(n>>14&0x7f), byte(n>>7&0x7f), byte(n&0x7f))
+	} else {
+		f = append(f, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	f = append(f, 0, 0)
+	return append(f, data...)
+}
+
+func TestReadID3Text(t *testing.T) {
+	utf16 := []byte{1, 0xff, 0xfe, 'B', 0, 0xf6, 0, 'r', 0, 'k', 0, 0, 0, 0xfe, 0xff, 0, 'X', 0, 0}
+	tests := []struct {
+		name    string
+		tag     []byte
+		artists []string
+		genres  []string
+	}{
+		{
+			"v2.4 null separated",
+			id3Tag(4,
+				id3Frame(4, "TPE1", []byte("\x03Artist A\x00Artist B\x00")),
+				id3Frame(4, "TCON", []byte("\x0317\x00Shoegaze")),
+			),
+			[]string{"Artist A", "Artist B"},
+			[]string{"Rock", "Shoegaze"},
+		},
+		{
+			"v2.3 references and repeated frames",
+			id3Tag(3,
+				id3Frame(3, "TPE1", utf16),
+				id3Frame(3, "TIT2", []byte("\x00Title")),
+				id3Frame(3, "TPE1", []byte("\x00Sigur R\xf3s")),
+				id3Frame(3, "TCON", []byte("\x00(17)(RX)((Not a ref)")),
+			),
+			[]string{"Börk", "X", "Sigur Rós"},
+			[]string{"Rock", "Remix", "(Not a ref)"},
+		},
+	}
+	for _, tc := range tests {
+		values, err := readID3Text(bytes.NewReader(tc.tag), "TPE1", "TCON")
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(values["TPE1"], tc.artists) {
+			t.Errorf("%s: artists %q, want %q", tc.name, values["TPE1"], tc.artists)
+		}
+		if genres := id3Genres(values["TCON"]); !reflect.DeepEqual(genres, tc.genres) {
+			t.Errorf("%s: genres %q, want %q", tc.name, genres, tc.genres)
+		}
+	}
+}
+
+func TestReadFLACComments(t *testing.T) {
+	var block bytes.Buffer
+	put := func(s string) {
+		binary.Write(&block, binary.LittleEndian, uint32(len(s)))
+		block.WriteString(s)
+	}
+	put("vendor")
+	binary.Write(&block, binary.LittleEndian, uint32(3))
+	put("ARTIST=Artist A")
+	put("artist=Artist B")
+	put("GENRE=Jazz")
+
+	var file bytes.Buffer
+	file.WriteString("fLaC")
+	// an empty padding block then the comments as the last block
+	file.Write([]byte{1, 0, 0, 0})
+	n := block.Len()
+	file.Write([]byte{0x80 | 4, byte(n >> 16), byte(n >> 8), byte(n)})
+	file.Write(block.Bytes())
+
+	comments, err := readVorbisComments(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Artist A", "Artist B"}; !reflect.DeepEqual(comments["artist"], want) {
+		t.Errorf("artists %q, want %q", comments["artist"], want)
+	}
+	if want := []string{"Jazz"}; !reflect.DeepEqual(comments["genre"], want) {
+		t.Errorf("genres %q, want %q", comments["genre"], want)
+	}
+}
+
+func TestID3v1Genres(t *testing.T) {
+	if len(id3v1Genres) != 192 {
+		t.Errorf("%d ID3v1 genres, want 192", len(id3v1Genres))
+	}
+}
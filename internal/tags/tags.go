@@ -0,0 +1,257 @@
+// Package tags reads the tags of media files that taglib doesn't expose
+// through it's basic interface, like disc numbers, composers and ISRCs.
+//
+// ID3v2, Vorbis comments (FLAC and Ogg) and MP4 atoms are supported. The
+// same field is stored under different names by each of them.
+package tags
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// Extended are the tags read on top of the basic ones from taglib
+type Extended struct {
+	TrackNumber int
+	DiscNumber  int
+	AlbumArtist string
+	Composer    string
+	Publisher   string
+	ISRC        string
+	BPM         float64
+	Comment     string
+	Copyright   string
+	Language    string
+	// Artists and Genres hold each artist and genre of the file, see SplitOn
+	Artists []string
+	Genres  []string
+}
+
+// field names of the Extended tags
+const (
+	FieldTrackNumber = "track_number"
+	FieldDiscNumber  = "disc_number"
+	FieldAlbumArtist = "album_artist"
+	FieldComposer    = "composer"
+	FieldPublisher   = "publisher"
+	FieldISRC        = "isrc"
+	FieldBPM         = "bpm"
+	FieldComment     = "comment"
+	FieldCopyright   = "copyright"
+	FieldLanguage    = "language"
+)
+
+// format groups the tag formats that name their fields the same way
+type format int
+
+const (
+	formatID3v22 format = iota
+	formatID3v23
+	formatVorbis
+	formatMP4
+)
+
+// fieldNames maps each field to the names it is read from per tag format, in
+// order of preference. Vorbis comment names are lower case.
+var fieldNames = map[string]map[format][]string{
+	FieldTrackNumber: {
+		formatID3v22: {"TRK"},
+		formatID3v23: {"TRCK"},
+		formatVorbis: {"tracknumber"},
+		formatMP4:    {"trkn"},
+	},
+	FieldDiscNumber: {
+		formatID3v22: {"TPA"},
+		formatID3v23: {"TPOS"},
+		formatVorbis: {"discnumber"},
+		formatMP4:    {"disk"},
+	},
+	FieldAlbumArtist: {
+		formatID3v22: {"TP2"},
+		formatID3v23: {"TPE2"},
+		formatVorbis: {"albumartist", "album artist", "album_artist"},
+		formatMP4:    {"aART"},
+	},
+	FieldComposer: {
+		formatID3v22: {"TCM"},
+		formatID3v23: {"TCOM"},
+		formatVorbis: {"composer"},
+		formatMP4:    {"\xa9wrt"},
+	},
+	FieldPublisher: {
+		formatID3v22: {"TPB"},
+		formatID3v23: {"TPUB"},
+		formatVorbis: {"organization", "label", "publisher"},
+	},
+	FieldISRC: {
+		formatID3v22: {"TRC"},
+		formatID3v23: {"TSRC"},
+		formatVorbis: {"isrc"},
+	},
+	// the MP4 tempo atom is read wrongly as a single byte so it's left out
+	FieldBPM: {
+		formatID3v22: {"TBP"},
+		formatID3v23: {"TBPM"},
+		formatVorbis: {"bpm", "tempo"},
+	},
+	FieldComment: {
+		formatID3v22: {"COM"},
+		formatID3v23: {"COMM"},
+		formatVorbis: {"comment", "description"},
+		formatMP4:    {"\xa9cmt"},
+	},
+	FieldCopyright: {
+		formatID3v22: {"TCR"},
+		formatID3v23: {"TCOP"},
+		formatVorbis: {"copyright"},
+		formatMP4:    {"cprt"},
+	},
+	FieldLanguage: {
+		formatID3v22: {"TLA"},
+		formatID3v23: {"TLAN"},
+		formatVorbis: {"language"},
+	},
+}
+
+// Read reads the extended tags of the file at path, splitting the artists
+// and genres on separators. Files without tags return empty tags.
+func Read(path string, separators []string) (*Extended, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ext := new(Extended)
+	m, err := tag.ReadFrom(f)
+	if err == tag.ErrNoTagsFound {
+		return ext, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ext.Artists, ext.Genres = readMulti(f, m, separators)
+
+	r := reader{raw: m.Raw()}
+	switch m.Format() {
+	case tag.ID3v2_2:
+		r.format = formatID3v22
+	case tag.ID3v2_3, tag.ID3v2_4:
+		r.format = formatID3v23
+	case tag.VORBIS:
+		r.format = formatVorbis
+	case tag.MP4:
+		r.format = formatMP4
+	default:
+		// ID3v1 has none of the extended fields
+		return ext, nil
+	}
+
+	ext.TrackNumber = r.number(FieldTrackNumber)
+	ext.DiscNumber = r.number(FieldDiscNumber)
+	ext.AlbumArtist = r.text(FieldAlbumArtist)
+	ext.Composer = r.text(FieldComposer)
+	ext.Publisher = r.text(FieldPublisher)
+	ext.ISRC = strings.ToUpper(strings.Replace(r.text(FieldISRC), "-", "", -1))
+	ext.BPM, _ = strconv.ParseFloat(r.text(FieldBPM), 64)
+	ext.Comment = r.text(FieldComment)
+	ext.Copyright = r.text(FieldCopyright)
+	ext.Language = r.text(FieldLanguage)
+	return ext, nil
+}
+
+// reader looks fields up in the raw tags of one format
+type reader struct {
+	format format
+	raw    map[string]interface{}
+}
+
+// values returns every value stored for a field. Repeated ID3v2 frames are
+// stored with a numbered suffix.
+func (r reader) values(field string) []interface{} {
+	var values []interface{}
+	for _, name := range fieldNames[field][r.format] {
+		if v, ok := r.raw[name]; ok {
+			values = append(values, v)
+		}
+		if r.format != formatID3v22 && r.format != formatID3v23 {
+			continue
+		}
+		var repeated []string
+		for k := range r.raw {
+			if strings.HasPrefix(k, name+"_") {
+				repeated = append(repeated, k)
+			}
+		}
+		sort.Strings(repeated)
+		for _, k := range repeated {
+			values = append(values, r.raw[k])
+		}
+	}
+	return values
+}
+
+// text returns the first non empty value of a field. Of the ID3v2 comments
+// only those without a description are used, the others are mostly data
+// left by other software.
+func (r reader) text(field string) string {
+	for _, v := range r.values(field) {
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case *tag.Comm:
+			if v.Description != "" {
+				continue
+			}
+			s = v.Text
+		case int:
+			s = strconv.Itoa(v)
+		}
+		s = strings.TrimSpace(strings.Trim(s, "\x00"))
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// number reads a field holding a number like a track number, which may be
+// written along with the total as "3/12"
+func (r reader) number(field string) int {
+	s := r.text(field)
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// readMulti reads the artists and genres of a file, as stored in the file
+// where it's tags support several values and split from the single value
+// otherwise
+func readMulti(f io.ReadSeeker, m tag.Metadata, separators []string) (artists, genres []string) {
+	artists, genres = []string{m.Artist()}, []string{m.Genre()}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return SplitOn(separators, artists...), SplitOn(separators, genres...)
+	}
+	switch m.Format() {
+	case tag.ID3v2_2, tag.ID3v2_3, tag.ID3v2_4:
+		values, err := readID3Text(f, "TPE1", "TCON")
+		if err == nil {
+			artists, genres = values["TPE1"], id3Genres(values["TCON"])
+		}
+	case tag.VORBIS:
+		comments, err := readVorbisComments(f)
+		if err == nil {
+			artists, genres = comments["artist"], comments["genre"]
+		}
+	}
+	return SplitOn(separators, artists...), SplitOn(separators, genres...)
+}
@@ -0,0 +1,189 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxCommentSize is the largest Vorbis comment block read, they may hold
+// embedded pictures but nothing larger
+const maxCommentSize = 32 << 20
+
+// readVorbisComments reads the Vorbis comments of a FLAC or Ogg file, keyed
+// by their lower case field names. Repeated fields are kept as separate
+// values, which is how Vorbis comments store several values.
+func readVorbisComments(r io.ReadSeeker) (map[string][]string, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	switch string(magic[:]) {
+	case "OggS":
+		return readOggComments(r)
+	case "ID3\x03", "ID3\x04", "ID3\x02", "fLaC":
+		return readFLACComments(r)
+	}
+	return nil, errors.New("not a FLAC or Ogg file")
+}
+
+// readFLACComments reads the comments from the metadata blocks of a FLAC
+// file, skipping an ID3v2 tag some software puts before them
+func readFLACComments(r io.Reader) (map[string][]string, error) {
+	var h [10]byte
+	if _, err := io.ReadFull(r, h[:4]); err != nil {
+		return nil, err
+	}
+	if string(h[:3]) == "ID3" {
+		if _, err := io.ReadFull(r, h[4:]); err != nil {
+			return nil, err
+		}
+		n := int64(synchsafe(h[6:10]))
+		if h[5]&0x10 != 0 {
+			// footer
+			n += 10
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, n); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, h[:4]); err != nil {
+			return nil, err
+		}
+	}
+	if string(h[:4]) != "fLaC" {
+		return nil, errors.New("not a FLAC file")
+	}
+
+	for {
+		var bh [4]byte
+		if _, err := io.ReadFull(r, bh[:]); err != nil {
+			return nil, err
+		}
+		last, kind := bh[0]&0x80 != 0, bh[0]&0x7f
+		size := int64(bh[1])<<16 | int64(bh[2])<<8 | int64(bh[3])
+		if kind == 4 {
+			if size > maxCommentSize {
+				return nil, errors.New("comment block too large")
+			}
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, err
+			}
+			return parseVorbisComments(block)
+		}
+		if last {
+			return map[string][]string{}, nil
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readOggComments reads the comment header of the first logical stream of
+// an Ogg file, which is it's second packet for both Vorbis and Opus
+func readOggComments(r io.Reader) (map[string][]string, error) {
+	var serial uint32
+	var packet []byte
+	packets := 0
+	first := true
+	for {
+		var h [27]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return nil, err
+		}
+		if string(h[:4]) != "OggS" {
+			return nil, errors.New("invalid Ogg page")
+		}
+		segments := make([]byte, h[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, err
+		}
+		pageSerial := binary.LittleEndian.Uint32(h[14:])
+		if first {
+			serial = pageSerial
+			first = false
+		}
+		for _, n := range segments {
+			seg := make([]byte, n)
+			if _, err := io.ReadFull(r, seg); err != nil {
+				return nil, err
+			}
+			if pageSerial != serial {
+				continue
+			}
+			if packets == 1 {
+				packet = append(packet, seg...)
+				if len(packet) > maxCommentSize {
+					return nil, errors.New("comment header too large")
+				}
+			}
+			if n < 255 {
+				// a lacing value below 255 ends the packet
+				packets++
+				if packets == 2 {
+					return parseOggCommentHeader(packet)
+				}
+			}
+		}
+	}
+}
+
+// parseOggCommentHeader strips the codec specific prefix of a comment
+// header packet
+func parseOggCommentHeader(p []byte) (map[string][]string, error) {
+	switch {
+	case bytes.HasPrefix(p, []byte("\x03vorbis")):
+		return parseVorbisComments(p[7:])
+	case bytes.HasPrefix(p, []byte("OpusTags")):
+		return parseVorbisComments(p[8:])
+	}
+	return nil, errors.New("unsupported Ogg codec")
+}
+
+// parseVorbisComments parses a Vorbis comment block, the vendor string then
+// the number of comments and the comments each prefixed by their length
+func parseVorbisComments(b []byte) (map[string][]string, error) {
+	errInvalid := errors.New("invalid Vorbis comments")
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+
+	if _, ok := next(); !ok {
+		return nil, errInvalid
+	}
+	if len(b) < 4 {
+		return nil, errInvalid
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	comments := make(map[string][]string)
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			return nil, errInvalid
+		}
+		kv := strings.SplitN(string(c), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(kv[0])
+		comments[key] = append(comments[key], kv[1])
+	}
+	return comments, nil
+}
@@ -0,0 +1,380 @@
+// Package tus stores the partial uploads of the tus resumable upload
+// protocol, see https://tus.io/protocols/resumable-upload.html.
+//
+// Each upload is a data file the chunks are appended to and an info file
+// holding it's length, metadata and expiry, both named after the upload id.
+// Uploads expire a while after they where last written to unless they are
+// finished first.
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryex/go-broadcaster/internal/utils"
+)
+
+// Version is the version of the protocol implemented
+const Version = "1.0.0"
+
+// Extensions are the protocol extensions implemented
+const Extensions = "creation,termination,expiration"
+
+// DefaultExpiry is used when no expiry is given to NewStore
+const DefaultExpiry = 24 * time.Hour
+
+var (
+	// ErrNotFound is returned for uploads that don't exist
+	ErrNotFound = errors.New("upload not found")
+	// ErrExpired is returned for uploads that expired but are yet to be
+	// removed
+	ErrExpired = errors.New("upload expired")
+	// ErrOffsetMismatch is returned when a chunk doesn't start where the
+	// upload left off
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrLocked is returned when a chunk is sent while another chunk of
+	// the same upload is still being written
+	ErrLocked = errors.New("upload is being written")
+	// ErrTooLarge is returned when an upload is longer than allowed
+	ErrTooLarge = errors.New("upload too large")
+	// ErrEmpty is returned for uploads of no bytes, they would be complete
+	// before any chunk was sent and no file is empty
+	ErrEmpty = errors.New("empty upload")
+	// ErrBadMetadata is returned for an Upload-Metadata header that can't
+	// be parsed
+	ErrBadMetadata = errors.New("bad upload metadata")
+)
+
+// Upload is the state of an upload
+type Upload struct {
+	ID     string `json:"id"`
+	Length int64  `json:"length"`
+	// Offset is how much of the upload has been received
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata"`
+	Created  time.Time         `json:"created"`
+	Expires  time.Time         `json:"expires"`
+	// Done is set once a complete upload has been handled, Path is where
+	// it was stored to be imported by the job JobID or Error why it wasn't
+	Done  bool   `json:"done"`
+	Path  string `json:"path,omitempty"`
+	JobID int64  `json:"job_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Complete tests if all of the upload has been received
+func (u *Upload) Complete() bool {
+	return u.Offset >= u.Length
+}
+
+// Store keeps uploads on disk in a directory
+type Store struct {
+	Dir string
+	// Expiry is how long after it was last written an upload expires
+	Expiry time.Duration
+	// MaxSize is the longest upload allowed, unlimited if zero
+	MaxSize int64
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewStore creates a store keeping it's uploads in dir, creating dir if
+// needed
+func NewStore(dir string, expiry time.Duration, maxSize int64) (*Store, error) {
+	if expiry <= 0 {
+		expiry = DefaultExpiry
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		Dir:     dir,
+		Expiry:  expiry,
+		MaxSize: maxSize,
+		busy:    make(map[string]bool),
+	}
+	return s, nil
+}
+
+// DataPath returns the path of the data file of the upload with id
+func (s *Store) DataPath(id string) string {
+	return filepath.Join(s.Dir, id+".bin")
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.Dir, id+".info")
+}
+
+// Create starts a new upload of length bytes, length must not be zero
+func (s *Store) Create(length int64, metadata map[string]string) (*Upload, error) {
+	if length < 0 {
+		return nil, errors.New("negative upload length")
+	}
+	if length == 0 {
+		return nil, ErrEmpty
+	}
+	if s.MaxSize > 0 && length > s.MaxSize {
+		return nil, ErrTooLarge
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	u := &Upload{
+		ID:       hex.EncodeToString(b[:]),
+		Length:   length,
+		Metadata: metadata,
+		Created:  now,
+		Expires:  now.Add(s.Expiry),
+	}
+	f, err := os.OpenFile(s.DataPath(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err = s.save(u); err != nil {
+		os.Remove(s.DataPath(u.ID))
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get returns the upload with id
+func (s *Store) Get(id string) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	u, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(u.Expires) {
+		return u, ErrExpired
+	}
+	return u, nil
+}
+
+// Write appends a chunk of the upload with id read from r, which must
+// start at offset. It reads no further than the length of the upload and
+// keeps what was read even if r fails part way. The upload is returned
+// along with whether this chunk completed it, a completed upload stays
+// locked until Finish is called so it's data can't be removed while it's
+// handled.
+func (s *Store) Write(id string, offset int64, r io.Reader) (u *Upload, completed bool, err error) {
+	if !s.lock(id) {
+		return nil, false, ErrLocked
+	}
+	defer func() {
+		if !completed {
+			s.unlock(id)
+		}
+	}()
+
+	u, err = s.Get(id)
+	if err != nil {
+		return
+	}
+	if u.Offset != offset {
+		return u, false, ErrOffsetMismatch
+	}
+	if u.Complete() {
+		return u, false, nil
+	}
+
+	f, err := os.OpenFile(s.DataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	n, err := io.Copy(f, io.LimitReader(r, u.Length-u.Offset))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	u.Offset += n
+	u.Expires = time.Now().Add(s.Expiry)
+	if serr := s.save(u); err == nil {
+		err = serr
+	}
+	return u, err == nil && u.Complete(), err
+}
+
+// Finish records the outcome of handling a complete upload and unlocks it,
+// it's data file is expected to have been moved away
+func (s *Store) Finish(id, path string, jobID int64, cause error) error {
+	defer s.unlock(id)
+	u, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	u.Done = true
+	u.Path = path
+	u.JobID = jobID
+	if cause != nil {
+		u.Error = cause.Error()
+	}
+	os.Remove(s.DataPath(id))
+	return s.save(u)
+}
+
+// Terminate removes the upload with id
+func (s *Store) Terminate(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	if !s.lock(id) {
+		return ErrLocked
+	}
+	defer s.unlock(id)
+	if _, err := s.load(id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// Expire removes the uploads that expired, returning how many there where
+func (s *Store) Expire() (count int, err error) {
+	names, err := filepath.Glob(filepath.Join(s.Dir, "*.info"))
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+	now := time.Now()
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), ".info")
+		if !validID(id) || !s.lock(id) {
+			continue
+		}
+		u, lerr := s.load(id)
+		if lerr == nil && now.After(u.Expires) {
+			if err = s.remove(id); err != nil {
+				s.unlock(id)
+				return
+			}
+			count++
+		}
+		s.unlock(id)
+	}
+	return
+}
+
+func (s *Store) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+func (s *Store) unlock(id string) {
+	s.mu.Lock()
+	delete(s.busy, id)
+	s.mu.Unlock()
+}
+
+// load reads the info of the upload with id, the offset is taken from the
+// size of it's data file as a write may have been cut short before the
+// info was saved
+func (s *Store) load(id string) (*Upload, error) {
+	data, err := ioutil.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u := new(Upload)
+	if err = json.Unmarshal(data, u); err != nil {
+		return nil, err
+	}
+	if info, serr := os.Stat(s.DataPath(id)); serr == nil {
+		u.Offset = info.Size()
+	}
+	return u, nil
+}
+
+func (s *Store) save(u *Upload) error {
+	return utils.WriteFileAtomic(s.infoPath(u.ID), 0644, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(u)
+	})
+}
+
+func (s *Store) remove(id string) error {
+	err := os.Remove(s.DataPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(s.infoPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// validID tests if id could be an upload id, so ids from requests can't
+// point outside the store
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// ParseMetadata parses an Upload-Metadata header, a comma separated list
+// of keys each followed by a space and it's base64 encoded value if it has
+// one
+func ParseMetadata(header string) (map[string]string, error) {
+	m := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			m[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, ErrBadMetadata
+			}
+			m[fields[0]] = string(value)
+		default:
+			return nil, ErrBadMetadata
+		}
+	}
+	return m, nil
+}
+
+// FormatMetadata formats metadata for an Upload-Metadata header
+func FormatMetadata(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		if m[k] == "" {
+			pairs[i] = k
+		} else {
+			pairs[i] = fmt.Sprintf("%s %s", k, base64.StdEncoding.EncodeToString([]byte(m[k])))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,160 @@
+package tus
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "gobcast-tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(dir, time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// failingReader returns some data then fails, like a dropped connection
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStoreWrite(t *testing.T) {
+	s := newTestStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	if _, err := s.Create(101, nil); err != ErrTooLarge {
+		t.Errorf("too large upload gave %v", err)
+	}
+	if _, err := s.Create(0, nil); err != ErrEmpty {
+		t.Errorf("empty upload gave %v", err)
+	}
+
+	u, err := s.Create(10, map[string]string{"filename": "show.mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, done, err := s.Write(u.ID, 0, strings.NewReader("0123"))
+	if err != nil || done || u.Offset != 4 {
+		t.Fatalf("first chunk gave offset %d, %v, %v", u.Offset, done, err)
+	}
+	if _, _, err = s.Write(u.ID, 2, strings.NewReader("2345")); err != ErrOffsetMismatch {
+		t.Errorf("chunk at the wrong offset gave %v", err)
+	}
+
+	// what arrived before the connection dropped is kept
+	u, _, err = s.Write(u.ID, 4, &failingReader{data: "45"})
+	if err == nil || u.Offset != 6 {
+		t.Errorf("dropped chunk gave offset %d, %v", u.Offset, err)
+	}
+	if u, err = s.Get(u.ID); err != nil || u.Offset != 6 || u.Metadata["filename"] != "show.mp3" {
+		t.Errorf("got %+v, %v", u, err)
+	}
+
+	// anything past the length is left unread
+	u, done, err = s.Write(u.ID, 6, strings.NewReader("6789extra"))
+	if err != nil || !done || u.Offset != 10 {
+		t.Fatalf("last chunk gave offset %d, %v, %v", u.Offset, done, err)
+	}
+	data, err := ioutil.ReadFile(s.DataPath(u.ID))
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("upload holds %q, %v", data, err)
+	}
+
+	// nothing can touch it until it's finished
+	if err = s.Terminate(u.ID); err != ErrLocked {
+		t.Errorf("terminating a completed upload gave %v", err)
+	}
+	if _, _, err = s.Write(u.ID, 10, strings.NewReader("")); err != ErrLocked {
+		t.Errorf("writing a completed upload gave %v", err)
+	}
+
+	if err = s.Finish(u.ID, "/library/show.mp3", 42, nil); err != nil {
+		t.Fatal(err)
+	}
+	u, err = s.Get(u.ID)
+	if err != nil || !u.Done || u.Path != "/library/show.mp3" || u.JobID != 42 || u.Offset != 10 {
+		t.Errorf("finished upload is %+v, %v", u, err)
+	}
+
+	if err = s.Terminate(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(u.ID); err != ErrNotFound {
+		t.Errorf("terminated upload gave %v", err)
+	}
+	if _, err = s.Get("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("bad id gave %v", err)
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	s := newTestStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	old, err := s.Create(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := s.Create(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Expires = time.Now().Add(-time.Minute)
+	if err = s.save(old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(old.ID); err != ErrExpired {
+		t.Errorf("expired upload gave %v", err)
+	}
+	if _, _, err = s.Write(old.ID, 0, strings.NewReader("x")); err != ErrExpired {
+		t.Errorf("writing an expired upload gave %v", err)
+	}
+
+	count, err := s.Expire()
+	if err != nil || count != 1 {
+		t.Errorf("expired %d, %v", count, err)
+	}
+	if _, err = os.Stat(s.DataPath(old.ID)); !os.IsNotExist(err) {
+		t.Error("expired data left behind")
+	}
+	if _, err = s.Get(fresh.ID); err != nil {
+		t.Errorf("fresh upload gave %v", err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	m, err := ParseMetadata("filename c2hvdy5tcDM=,is_confidential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["filename"] != "show.mp3" {
+		t.Errorf("filename is %q", m["filename"])
+	}
+	if v, ok := m["is_confidential"]; !ok || v != "" {
+		t.Errorf("key without value is %q, %v", v, ok)
+	}
+	if got := FormatMetadata(m); got != "filename c2hvdy5tcDM=,is_confidential" {
+		t.Errorf("formatted as %q", got)
+	}
+	if _, err = ParseMetadata("filename !!!"); err != ErrBadMetadata {
+		t.Errorf("bad value gave %v", err)
+	}
+}
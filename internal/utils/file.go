@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFileName is the longest file name in bytes most file systems allow
+const maxFileName = 255
+
+// WriteFileAtomic writes a file through a temporary file in the same
+// directory that is renamed into place, so readers never see it partly
+// written. Missing parent directories are created.
+func WriteFileAtomic(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	// temporary files are only readable by their owner
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// FileExists tests if there is a file at path
+func FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// SanitizeFileName makes name safe to use as a single file name on any
+// common file system. Path separators, characters reserved on Windows and
+// control characters are replaced with underscores, leading and trailing
+// dots and spaces are dropped and overly long names are cut short, keeping
+// their extension.
+func SanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			return '_'
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > maxFileName {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFileName/2 {
+			ext = ""
+		}
+		base := name[:maxFileName-len(ext)]
+		// don't cut a character in half
+		for len(base) > 0 && !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = strings.TrimRight(base, " .") + ext
+	}
+	if name == "" {
+		name = "_"
+	}
+	return name
+}
+
+// MoveFile moves the file at src to dst without replacing a file already
+// at dst, in which case it returns an error satisfying os.IsExist. Files
+// are copied when they can't be linked, like across file systems.
+func MoveFile(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return os.Remove(src)
+	}
+	if os.IsExist(err) {
+		return err
+	}
+
+	tmp, err := copyTemp(src, filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	err = os.Link(tmp, dst)
+	if err != nil && !os.IsExist(err) {
+		// the file system doesn't do links at all
+		if _, serr := os.Lstat(dst); serr == nil {
+			return &os.LinkError{Op: "move", Old: src, New: dst, Err: os.ErrExist}
+		}
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// MoveFileUnique moves the file at src to dst like MoveFile. If dst is
+// taken a number is added to it's name until a free one is found, the path
+// the file was moved to is returned.
+func MoveFileUnique(src, dst string) (string, error) {
+	ext := filepath.Ext(dst)
+	base := strings.TrimSuffix(dst, ext)
+	path := dst
+	for i := 1; ; i++ {
+		err := MoveFile(src, path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// copyTemp copies the file at src to a temporary file in dir, keeping it's
+// permissions
+func copyTemp(src, dir string) (path string, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return
+	}
+
+	out, err := ioutil.TempFile(dir, "."+filepath.Base(src))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	return out.Name(), os.Chmod(out.Name(), info.Mode().Perm())
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"final_FINAL2.mp3", "final_FINAL2.mp3"},
+		{"AC/DC: Live?.flac", "AC_DC_ Live_.flac"},
+		{" ..hidden. ", "hidden"},
+		{"tab\there", "tab_here"},
+		{"..", "_"},
+		{"", "_"},
+		{"Sigur Rós", "Sigur Rós"},
+	}
+	for _, test := range tests {
+		if got := SanitizeFileName(test.name); got != test.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	long := SanitizeFileName(strings.Repeat("é", 200) + ".flac")
+	if len(long) > maxFileName || !strings.HasSuffix(long, "é.flac") {
+		t.Errorf("long name cut to %q", long)
+	}
+}
+
+func TestMoveFileUnique(t *testing.T) {
+	root := makeTree(t, "in/a.mp3", "in/b.mp3", "out/a.mp3")
+	defer os.RemoveAll(root)
+
+	dst := filepath.Join(root, "out", "a.mp3")
+	path, err := MoveFileUnique(filepath.Join(root, "in", "a.mp3"), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "out", "a (1).mp3"); path != want {
+		t.Errorf("moved to %s, want %s", path, want)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "in/a.mp3" {
+		t.Errorf("moved file holds %q, %v", data, err)
+	}
+	if data, _ = ioutil.ReadFile(dst); string(data) != "out/a.mp3" {
+		t.Errorf("existing file replaced with %q", data)
+	}
+	if FileExists(filepath.Join(root, "in", "a.mp3")) {
+		t.Error("source left behind")
+	}
+
+	err = MoveFile(filepath.Join(root, "in", "b.mp3"), dst)
+	if !os.IsExist(err) {
+		t.Errorf("moving onto an existing file gave %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/cespare/xxhash"
+)
+
+// FastHashChunk is the number of bytes read from both the start and the end
+// of a file to build it's fast hash
+const FastHashChunk = 64 * 1024
+
+// FastHash returns a hex encoded xxhash of the size of the file at path and
+// the first and last FastHashChunk bytes of it's content. It is cheap enough
+// to compute for every file in a large library and changes whenever the
+// tags or the length of the file change.
+func FastHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := xxhash.New()
+	sizeBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sizeBytes, uint64(size))
+	h.Write(sizeBytes)
+
+	buf := make([]byte, FastHashChunk)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	h.Write(buf[:n])
+
+	if size > 2*FastHashChunk {
+		n, err = file.ReadAt(buf, size-FastHashChunk)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		h.Write(buf[:n])
+	} else if size > FastHashChunk {
+		// the tail overlaps the head, hash whatever is left
+		n, err = io.ReadFull(file, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return "", err
+		}
+		h.Write(buf[:n])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 of the full content of the
+// file at path
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
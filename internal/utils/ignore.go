@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the name of the files holding ignore patterns for the
+// directory they are in and everything below it
+const IgnoreFileName = ".gobcastignore"
+
+// ignorePattern is a parsed gitignore style pattern
+type ignorePattern struct {
+	// segments are the slash separated parts of the pattern, a pattern
+	// that isn't anchored to it's directory starts with "**"
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnorePattern parses a single gitignore style pattern. It returns
+// nil for blank lines and comments.
+func parseIgnorePattern(line string) (*ignorePattern, error) {
+	line = strings.TrimRight(line, "\r")
+	// trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	p := new(ignorePattern)
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	// a slash anywhere but the end anchors the pattern to it's directory,
+	// otherwise it matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(line, "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	for _, s := range p.segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("bad ignore pattern %q: %s", line, err)
+		}
+	}
+	return p, nil
+}
+
+// match tests the pattern against the slash separated parts of a path
+// relative to the directory the pattern is from
+func (p *ignorePattern) match(parts []string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, parts)
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				// a trailing "**" matches everything inside
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// ValidateIgnorePatterns checks each of a list of patterns parses
+func ValidateIgnorePatterns(patterns []string) error {
+	for _, line := range patterns {
+		if _, err := parseIgnorePattern(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ignore decides which files below a root directory are left out of the
+// library. It applies gitignore style patterns given for the root, then
+// those of the IgnoreFileName files in the root and the directories below
+// it, which take precedence the deeper they are. As with gitignore the last
+// matching pattern decides, "!" patterns include paths again and nothing
+// inside an ignored directory can be included again.
+//
+// The ignore files are read once and cached, Forget drops the cached file
+// of a directory once it changes. An Ignore is safe for concurrent use.
+type Ignore struct {
+	root     string
+	patterns []*ignorePattern
+	// noFiles is set when there are no ignore files to read
+	noFiles bool
+
+	mu    sync.Mutex
+	files map[string][]*ignorePattern
+}
+
+// NewIgnore creates an Ignore for the tree under root with patterns
+// applying to it as a whole
+func NewIgnore(root string, patterns []string) (*Ignore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return newIgnore(root, patterns)
+}
+
+// NewPatternIgnore creates an Ignore for a tree that isn't on the local
+// disk, like one in an object store. The root is used as is and only
+// patterns apply, there are no ignore files to read.
+func NewPatternIgnore(root string, patterns []string) (*Ignore, error) {
+	ig, err := newIgnore(root, patterns)
+	if err != nil {
+		return nil, err
+	}
+	ig.noFiles = true
+	return ig, nil
+}
+
+func newIgnore(root string, patterns []string) (*Ignore, error) {
+	ig := &Ignore{
+		root:  root,
+		files: make(map[string][]*ignorePattern),
+	}
+	for _, line := range patterns {
+		p, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			ig.patterns = append(ig.patterns, p)
+		}
+	}
+	return ig, nil
+}
+
+// Root is the directory the Ignore applies to
+func (ig *Ignore) Root() string {
+	return ig.root
+}
+
+// Ignored tests if path, a file or a directory as told by isDir, is left
+// out either itself or by being inside an ignored directory. Paths outside
+// the root are never ignored.
+func (ig *Ignore) Ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(ig.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i <= len(parts); i++ {
+		dir := i < len(parts) || isDir
+		if ig.match(parts[:i], dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the patterns to a path without looking at it's parents
+func (ig *Ignore) match(parts []string, isDir bool) bool {
+	ignored := false
+	for _, p := range ig.patterns {
+		if p.match(parts, isDir) {
+			ignored = !p.negate
+		}
+	}
+	dir := ig.root
+	for i := 0; i < len(parts); i++ {
+		for _, p := range ig.fileFor(dir) {
+			if p.match(parts[i:], isDir) {
+				ignored = !p.negate
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return ignored
+}
+
+// fileFor returns the patterns of the ignore file in dir, reading it if it
+// isn't cached yet
+func (ig *Ignore) fileFor(dir string) []*ignorePattern {
+	if ig.noFiles {
+		return nil
+	}
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	if patterns, ok := ig.files[dir]; ok {
+		return patterns
+	}
+	patterns := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	ig.files[dir] = patterns
+	return patterns
+}
+
+// Forget drops the cached ignore file of dir so it is read again
+func (ig *Ignore) Forget(dir string) {
+	ig.mu.Lock()
+	delete(ig.files, dir)
+	ig.mu.Unlock()
+}
+
+// readIgnoreFile reads the patterns of an ignore file, a missing file has
+// none and bad patterns are skipped
+func readIgnoreFile(name string) []*ignorePattern {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []*ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p, err := parseIgnorePattern(scanner.Text())
+		if err == nil && p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
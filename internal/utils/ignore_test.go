@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"Trash", "Trash", true, true},
+		{"Trash", "a/b/Trash", true, true},
+		{"Trash", "a/Trash/song.mp3", false, true},
+		{"/Trash", "a/Trash", true, false},
+		{"_incoming/", "_incoming", true, true},
+		{"_incoming/", "_incoming", false, false},
+		{"*.wav", "a/b.wav", false, true},
+		{"*.wav", "a/b.mp3", false, false},
+		{"samples/*.wav", "samples/kick.wav", false, true},
+		{"samples/*.wav", "x/samples/kick.wav", false, false},
+		{"**/samples", "x/y/samples", true, true},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"packs/**", "packs/x.mp3", false, true},
+		{"# comment", "# comment", false, false},
+		{`\#hash`, "#hash", false, true},
+	}
+	for _, tc := range tests {
+		ig, err := NewIgnore("/music", []string{tc.pattern})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ig.Ignored(filepath.Join("/music", tc.path), tc.isDir)
+		if got != tc.want {
+			t.Errorf("pattern %q on %q: ignored %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+
+	if _, err := NewIgnore("/music", []string{"[a-"}); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	root := makeTree(t,
+		"a.mp3",
+		"b.wav",
+		"keep.wav",
+		"Trash/c.mp3",
+		"albums/d.mp3",
+		"albums/e.mp3",
+		"albums/deep/f.wav",
+	)
+	defer os.RemoveAll(root)
+
+	write := func(dir, content string) {
+		err := ioutil.WriteFile(filepath.Join(root, dir, IgnoreFileName), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".", "*.wav\n!keep.wav\n")
+	write("albums", "e.mp3\n!*.wav\n")
+
+	ig, err := NewIgnore(root, []string{"Trash/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := walkAll(t, root, WalkOptions{Extensions: []string{".mp3", ".wav"}, Ignore: ig})
+	want := []string{"a.mp3", "albums/d.mp3", "albums/deep/f.wav", "keep.wav"}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Fatalf("found %v, want %v", found, want)
+		}
+	}
+
+	// changed ignore files are only read again once forgotten
+	write("albums", "")
+	if !ig.Ignored(filepath.Join(root, "albums", "e.mp3"), false) {
+		t.Error("ignore file read again before it was forgotten")
+	}
+	ig.Forget(filepath.Join(root, "albums"))
+	if ig.Ignored(filepath.Join(root, "albums", "e.mp3"), false) {
+		t.Error("forgotten ignore file not read again")
+	}
+}
+
+func TestPatternIgnore(t *testing.T) {
+	ig, err := NewPatternIgnore("s3://library/music", []string{"Trash/", "*.wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ig.Root() != "s3://library/music" {
+		t.Errorf("root changed to %s", ig.Root())
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"s3://library/music/a.mp3", false},
+		{"s3://library/music/b.wav", true},
+		{"s3://library/music/Trash/c.mp3", true},
+		{"s3://library/other/d.wav", false},
+	}
+	for _, tc := range tests {
+		if got := ig.Ignored(tc.path, false); got != tc.want {
+			t.Errorf("%s: ignored %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Articles are the leading words dropped from names when normalising them,
+// names filed as "Beatles, The" have them trailing instead
+var Articles = []string{"the", "a", "an"}
+
+// letterFolds spells out the letters that don't decompose into a base letter
+// and accents
+var letterFolds = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "ð", "d", "þ", "th", "ı", "i",
+)
+
+// NormalizeName reduces an artist name or album title to a key that is
+// the same for the ways the name tends to be written. Case and accents are
+// folded, runs of whitespace are collapsed and a leading or trailing article
+// is dropped, so "The Beatles", "Beatles, The" and "the  beatles" are all
+// "beatles".
+func NormalizeName(name string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+	folded = letterFolds.Replace(strings.ToLower(folded))
+	words := strings.Fields(folded)
+	if len(words) < 2 {
+		return strings.Join(words, " ")
+	}
+
+	last := len(words) - 1
+	if strings.HasSuffix(words[last-1], ",") && StringInSlice(words[last], Articles) {
+		words[last-1] = strings.TrimSuffix(words[last-1], ",")
+		words = words[:last]
+	} else if StringInSlice(words[0], Articles) {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
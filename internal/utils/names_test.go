@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"The Beatles", "beatles"},
+		{"Beatles, The", "beatles"},
+		{"the  beatles ", "beatles"},
+		{"THE BEATLES", "beatles"},
+		{"Björk", "bjork"},
+		{"Sigur Rós", "sigur ros"},
+		{"Mötley Crüe", "motley crue"},
+		{"Die Ärzte", "die arzte"},
+		{"Straßenjungs", "strassenjungs"},
+		{"ｆｕｌｌ　ｗｉｄｔｈ", "full width"},
+		{"A Tribe Called Quest", "tribe called quest"},
+		{"The The", "the"},
+		{"The", "the"},
+		{"", ""},
+		{"Anathema", "anathema"},
+	}
+	for _, tc := range tests {
+		if got := NormalizeName(tc.name); got != tc.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WalkOptions control how a FileWalker walks a directory tree
+type WalkOptions struct {
+	// Extensions limits the walk to files ending in one of these
+	// extensions, compared case-insensitively. Empty returns every file.
+	Extensions []string
+	// FollowSymlinks makes the walk return symlinked files and descend
+	// into symlinked directories, directories already walked are skipped
+	// so links pointing back up the tree don't loop forever.
+	// Otherwise symlinks are ignored.
+	FollowSymlinks bool
+	// Ignore leaves out the files and directories it ignores, nothing
+	// inside an ignored directory is read
+	Ignore *Ignore
+}
+
+// WalkError is an error encountered at a path during a walk
+type WalkError struct {
+	Path string
+	Err  error
+}
+
+func (e *WalkError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// WalkErrors is the list of errors collected during a walk
+type WalkErrors []*WalkError
+
+func (e WalkErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d errors while walking, first: %s", len(e), e[0])
+}
+
+// Covers tests if path is at or below a path of one of the errors, what is
+// there may not have been seen by the walk
+func (e WalkErrors) Covers(path string) bool {
+	for _, werr := range e {
+		if path == werr.Path || strings.HasPrefix(path, werr.Path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkDir is a directory waiting to be read
+type walkDir struct {
+	path string
+	// real is the path with symlinks resolved, only tracked when
+	// following symlinks
+	real string
+}
+
+// FileWalker iterates over the files below a root directory, visiting
+// each one exactly once. Errors reading a part of the tree are collected
+// and the walk carries on with the rest, only a root that can't be walked
+// at all fails it.
+//
+//	w := utils.NewFileWalker(ctx, root, opts)
+//	for w.Next() {
+//		fmt.Println(w.Path())
+//	}
+//	if err := w.Err(); err != nil {
+//		...
+//	}
+//	for _, werr := range w.Errors() {
+//		...
+//	}
+type FileWalker struct {
+	ctx  context.Context
+	opts WalkOptions
+
+	dirs  []walkDir
+	files []string
+	info  []os.FileInfo
+
+	path    string
+	curInfo os.FileInfo
+
+	seen   map[string]struct{}
+	errs   WalkErrors
+	ctxErr error
+	// rootErr is why the root couldn't be walked
+	rootErr error
+}
+
+// NewFileWalker creates a FileWalker for the tree under root
+func NewFileWalker(ctx context.Context, root string, opts WalkOptions) *FileWalker {
+	w := &FileWalker{
+		ctx:  ctx,
+		opts: opts,
+	}
+
+	rootPath, err := filepath.Abs(root)
+	if err != nil {
+		w.failRoot(root, err)
+		return w
+	}
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		w.failRoot(rootPath, err)
+		return w
+	}
+	if !info.IsDir() {
+		w.failRoot(rootPath, fmt.Errorf("not a directory"))
+		return w
+	}
+
+	dir := walkDir{path: rootPath}
+	if opts.FollowSymlinks {
+		w.seen = make(map[string]struct{})
+		dir.real, err = filepath.EvalSymlinks(rootPath)
+		if err != nil {
+			w.failRoot(rootPath, err)
+			return w
+		}
+		w.seen[dir.real] = struct{}{}
+	}
+	w.dirs = append(w.dirs, dir)
+	return w
+}
+
+// Next advances the walk to the next file, returning false once there are
+// no more files or the context is cancelled
+func (w *FileWalker) Next() bool {
+	for {
+		if err := w.ctx.Err(); err != nil {
+			w.ctxErr = err
+			w.dirs = nil
+			w.files = nil
+			w.info = nil
+			return false
+		}
+
+		if len(w.files) > 0 {
+			w.path, w.files = w.files[0], w.files[1:]
+			w.curInfo, w.info = w.info[0], w.info[1:]
+			return true
+		}
+
+		if len(w.dirs) == 0 {
+			w.path = ""
+			w.curInfo = nil
+			return false
+		}
+
+		dir := w.dirs[len(w.dirs)-1]
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		w.readDir(dir)
+	}
+}
+
+// Path returns the path of the current file
+func (w *FileWalker) Path() string {
+	return w.path
+}
+
+// Info returns the file info of the current file, for a followed symlink
+// this describes the file linked to
+func (w *FileWalker) Info() os.FileInfo {
+	return w.curInfo
+}
+
+// Err returns the context error if the walk was cancelled, or why the root
+// couldn't be walked. Errors in parts of the tree don't fail the walk, they
+// are told by Errors.
+func (w *FileWalker) Err() error {
+	if w.ctxErr != nil {
+		return w.ctxErr
+	}
+	return w.rootErr
+}
+
+// Errors returns the errors collected so far during the walk, including the
+// error of the root
+func (w *FileWalker) Errors() WalkErrors {
+	return w.errs
+}
+
+func (w *FileWalker) addError(path string, err error) {
+	w.errs = append(w.errs, &WalkError{Path: path, Err: err})
+}
+
+func (w *FileWalker) failRoot(path string, err error) {
+	w.addError(path, err)
+	w.rootErr = w.errs[len(w.errs)-1]
+}
+
+// readDir queues the files of dir and pushes it's sub directories
+func (w *FileWalker) readDir(dir walkDir) {
+	entries, err := ioutil.ReadDir(dir.path)
+	if err != nil {
+		w.addError(dir.path, err)
+		return
+	}
+
+	var subdirs []walkDir
+	for _, info := range entries {
+		path := filepath.Join(dir.path, info.Name())
+		real := ""
+		if w.opts.FollowSymlinks {
+			real = filepath.Join(dir.real, info.Name())
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			real, err = filepath.EvalSymlinks(path)
+			if err == nil {
+				info, err = os.Stat(path)
+			}
+			if err != nil {
+				// a broken link is no directory, it's only an error if
+				// the file it stands for isn't ignored
+				if w.opts.Ignore == nil || !w.opts.Ignore.Ignored(path, false) {
+					w.addError(path, err)
+				}
+				continue
+			}
+		}
+
+		if w.opts.Ignore != nil && w.opts.Ignore.Ignored(path, info.IsDir()) {
+			continue
+		}
+
+		if info.IsDir() {
+			if w.opts.FollowSymlinks {
+				if _, ok := w.seen[real]; ok {
+					continue
+				}
+				w.seen[real] = struct{}{}
+			}
+			subdirs = append(subdirs, walkDir{path: path, real: real})
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if len(w.opts.Extensions) > 0 && !HasExtension(path, w.opts.Extensions) {
+			continue
+		}
+
+		if w.opts.FollowSymlinks {
+			// a file can be reached through more than one link
+			if _, ok := w.seen[real]; ok {
+				continue
+			}
+			w.seen[real] = struct{}{}
+		}
+		w.files = append(w.files, path)
+		w.info = append(w.info, info)
+	}
+
+	// push in reverse so sub directories are walked in name order
+	for i := len(subdirs) - 1; i >= 0; i-- {
+		w.dirs = append(w.dirs, subdirs[i])
+	}
+}
+
+// HasExtension tests if path ends in one of the extensions, compared
+// case-insensitively. The extensions may leave out the leading dot.
+func HasExtension(path string, extensions []string) bool {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if e != "" && !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func makeTree(t *testing.T, files ...string) string {
+	root, err := ioutil.TempDir("", "gobcast-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func walkAll(t *testing.T, root string, opts WalkOptions) []string {
+	var found []string
+	w := NewFileWalker(context.Background(), root, opts)
+	for w.Next() {
+		rel, err := filepath.Rel(root, w.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, filepath.ToSlash(rel))
+	}
+	if err := w.Err(); err != nil {
+		t.Error(err)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func TestFileWalkerVisitsOnce(t *testing.T) {
+	root := makeTree(t,
+		"a.mp3",
+		"b.txt",
+		"one/c.MP3",
+		"one/two/d.flac",
+		"one/two/three/e.Mp3",
+	)
+	defer os.RemoveAll(root)
+
+	found := walkAll(t, root, WalkOptions{Extensions: []string{".mp3", "flac"}})
+	want := []string{"a.mp3", "one/c.MP3", "one/two/d.flac", "one/two/three/e.Mp3"}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("found %v, want %v", found, want)
+			break
+		}
+	}
+}
+
+func TestFileWalkerSymlinks(t *testing.T) {
+	root := makeTree(t, "music/a.mp3", "other/b.mp3")
+	defer os.RemoveAll(root)
+
+	// a loop back up the tree, a link to a directory outside of the walk
+	// and a second link to a file that is already walked
+	links := map[string]string{
+		"music/loop":      "..",
+		"music/other":     filepath.Join(root, "other"),
+		"music/again.mp3": filepath.Join(root, "music", "a.mp3"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	musicRoot := filepath.Join(root, "music")
+
+	found := walkAll(t, musicRoot, WalkOptions{Extensions: []string{".mp3"}})
+	if len(found) != 1 || found[0] != "a.mp3" {
+		t.Errorf("without following symlinks found %v", found)
+	}
+
+	found = walkAll(t, musicRoot, WalkOptions{
+		Extensions:     []string{".mp3"},
+		FollowSymlinks: true,
+	})
+	if len(found) != 2 || found[0] != "a.mp3" || found[1] != "other/b.mp3" {
+		t.Errorf("following symlinks found %v", found)
+	}
+}
+
+func TestFileWalkerCollectsErrors(t *testing.T) {
+	root := makeTree(t, "a.mp3")
+	defer os.RemoveAll(root)
+
+	if err := os.Symlink(filepath.Join(root, "nowhere"), filepath.Join(root, "dangling.mp3")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	w := NewFileWalker(context.Background(), root, WalkOptions{FollowSymlinks: true})
+	count := 0
+	for w.Next() {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("found %d files, want 1", count)
+	}
+	if len(w.Errors()) != 1 {
+		t.Errorf("got errors %v, want 1", w.Errors())
+	}
+	// a broken part of the tree doesn't fail the walk
+	if err := w.Err(); err != nil {
+		t.Errorf("walk failed with %v", err)
+	}
+
+	// nor is an ignored broken link an error
+	ignore, err := NewIgnore(root, []string{"dangling.mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = NewFileWalker(context.Background(), root, WalkOptions{FollowSymlinks: true, Ignore: ignore})
+	for w.Next() {
+	}
+	if len(w.Errors()) != 0 {
+		t.Errorf("ignored link gave errors %v", w.Errors())
+	}
+}
+
+func TestFileWalkerRootError(t *testing.T) {
+	root := makeTree(t, "a.mp3")
+	defer os.RemoveAll(root)
+
+	for _, missing := range []string{filepath.Join(root, "nowhere"), filepath.Join(root, "a.mp3")} {
+		w := NewFileWalker(context.Background(), missing, WalkOptions{})
+		if w.Next() {
+			t.Errorf("walked a file of %s", missing)
+		}
+		if w.Err() == nil || len(w.Errors()) != 1 {
+			t.Errorf("walking %s failed with %v, errors %v", missing, w.Err(), w.Errors())
+		}
+	}
+}
+
+func TestWalkErrorsCovers(t *testing.T) {
+	sep := string(filepath.Separator)
+	errs := WalkErrors{
+		{Path: sep + filepath.Join("music", "locked")},
+		{Path: sep + filepath.Join("music", "link.mp3")},
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(sep+"music", "locked"), true},
+		{filepath.Join(sep+"music", "locked", "a", "b.mp3"), true},
+		{filepath.Join(sep+"music", "link.mp3"), true},
+		{filepath.Join(sep+"music", "lockedout", "b.mp3"), false},
+		{filepath.Join(sep+"music", "a.mp3"), false},
+	}
+	for _, test := range tests {
+		if got := errs.Covers(test.path); got != test.want {
+			t.Errorf("Covers(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestFileWalkerCancel(t *testing.T) {
+	root := makeTree(t, "a.mp3", "b.mp3", "c.mp3")
+	defer os.RemoveAll(root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewFileWalker(ctx, root, WalkOptions{})
+	if !w.Next() {
+		t.Fatal("expected a file")
+	}
+	cancel()
+	if w.Next() {
+		t.Error("walk continued after cancel")
+	}
+	if w.Err() != context.Canceled {
+		t.Errorf("got error %v, want %v", w.Err(), context.Canceled)
+	}
+}